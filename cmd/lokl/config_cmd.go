@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the lokl configuration",
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Print the fully merged and defaulted config",
+	RunE:  runConfigView,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Report every error and warning in the config",
+	// Validation failures are not usage errors.
+	SilenceUsage: true,
+	RunE:         runConfigValidate,
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print a JSON Schema for lokl.yaml",
+	RunE:  runConfigSchema,
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite the config to the current config version",
+	Long: `Rewrite lokl.yaml, and the files it includes or is overridden by, to the
+current config version.
+
+Changed files are re-encoded as a whole: comments are kept, but quoting,
+blank lines and indentation are normalized across the file. Review the
+diff before committing it.`,
+	RunE: runConfigMigrate,
+}
+
+var viewFormat string
+
+func init() {
+	configViewCmd.Flags().StringVarP(&viewFormat, "format", "f", config.FormatYAML, "output format (yaml or json)")
+	configCmd.AddCommand(configViewCmd, configValidateCmd, configSchemaCmd, configMigrateCmd)
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	_, issues, err := config.LoadAll(configFile)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	errs, warnings := len(issues.Errors()), len(issues.Warnings())
+	if errs > 0 {
+		return fmt.Errorf("%s is invalid: %d error(s), %d warning(s)", configFile, errs, warnings)
+	}
+
+	if warnings > 0 {
+		fmt.Printf("⚠ %s is valid with %d warning(s)\n", configFile, warnings)
+		return nil
+	}
+	fmt.Printf("✓ %s is valid\n", configFile)
+	return nil
+}
+
+func runConfigSchema(cmd *cobra.Command, args []string) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(config.Schema()); err != nil {
+		return fmt.Errorf("encoding schema: %w", err)
+	}
+	return nil
+}
+
+func runConfigView(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := config.Marshal(cfg, viewFormat)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) error {
+	changed, applied, err := config.Migrate(configFile)
+	if err != nil {
+		return err
+	}
+
+	if len(changed) == 0 {
+		fmt.Printf("✓ %s is already at version %d\n", configFile, config.CurrentVersion)
+		return nil
+	}
+
+	for _, description := range applied {
+		fmt.Printf("  %s\n", description)
+	}
+	for _, file := range changed {
+		fmt.Printf("✓ Migrated %s\n", file)
+	}
+	return nil
+}
@@ -12,7 +12,28 @@ import (
 
 var dnsCmd = &cobra.Command{
 	Use:   "dns",
-	Short: "Manage DNS entries",
+	Short: "Manage how project domains resolve",
+}
+
+var dnsInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Route the project domain to lokl's DNS server",
+	Long: `Point the system resolver at lokl's embedded DNS server for the project
+domain and any service hosts outside it, so every subdomain resolves to
+this machine while lokl runs. This is needed once per domain; steps that
+need root are run through sudo.
+
+Uses systemd-resolved or NetworkManager's dnsmasq on Linux and
+/etc/resolver on macOS.`,
+	SilenceUsage: true,
+	RunE:         runDNSInstall,
+}
+
+var dnsUninstallCmd = &cobra.Command{
+	Use:          "uninstall",
+	Short:        "Stop routing the project domain to lokl's DNS server",
+	SilenceUsage: true,
+	RunE:         runDNSUninstall,
 }
 
 var dnsSetupCmd = &cobra.Command{
@@ -27,8 +48,70 @@ var dnsRemoveCmd = &cobra.Command{
 	RunE:  runDNSRemove,
 }
 
+var dnsDoctorFix bool
+
+var dnsDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Find and repair broken lokl entries in /etc/hosts",
+	Long: `Check /etc/hosts for lokl blocks of any project that are duplicated, are
+missing a marker, or claim domains that a later block also claims.
+
+With --fix, repair them, keeping the most recent entries. The previous
+file is backed up next to /etc/hosts first.`,
+	SilenceUsage: true,
+	RunE:         runDNSDoctor,
+}
+
 func init() {
-	dnsCmd.AddCommand(dnsSetupCmd, dnsRemoveCmd)
+	dnsDoctorCmd.Flags().BoolVar(&dnsDoctorFix, "fix", false, "repair the problems found")
+	dnsCmd.AddCommand(dnsInstallCmd, dnsUninstallCmd, dnsSetupCmd, dnsRemoveCmd, dnsDoctorCmd)
+}
+
+func runDNSInstall(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	if cfg.Proxy.Domain == "" {
+		return fmt.Errorf("no proxy domain configured")
+	}
+
+	for _, zone := range proxy.New(cfg).Zones() {
+		path, err := proxy.InstallResolver(zone)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Configured %s\n", path)
+		fmt.Printf("  *.%s now resolves through lokl's DNS server at %s while lokl runs\n", zone, proxy.DNSServerAddr())
+	}
+	if cfg.Proxy.DNS == config.DNSHosts {
+		fmt.Println("\nSet proxy.dns: server in the config to start lokl's DNS server.")
+	}
+	return nil
+}
+
+func runDNSUninstall(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	if cfg.Proxy.Domain == "" {
+		return fmt.Errorf("no proxy domain configured")
+	}
+
+	for _, zone := range proxy.New(cfg).Zones() {
+		path, err := proxy.UninstallResolver(zone)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			fmt.Printf("Nothing to remove for %s\n", zone)
+			continue
+		}
+		fmt.Printf("✓ Removed %s\n", path)
+	}
+	return nil
 }
 
 func runDNSSetup(cmd *cobra.Command, args []string) error {
@@ -74,3 +157,34 @@ func runDNSRemove(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+func runDNSDoctor(cmd *cobra.Command, args []string) error {
+	if dnsDoctorFix {
+		problems, err := proxy.RepairHosts()
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			fmt.Println("✓ No problems found in /etc/hosts")
+			return nil
+		}
+		for _, p := range problems {
+			fmt.Printf("✓ Fixed %s\n", p)
+		}
+		return nil
+	}
+
+	problems, err := proxy.CheckHosts()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Println("✓ No problems found in /etc/hosts")
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Printf("✗ %s\n", p)
+	}
+	fmt.Println("\nRun: sudo lokl dns doctor --fix")
+	return fmt.Errorf("/etc/hosts has %d problem(s)", len(problems))
+}
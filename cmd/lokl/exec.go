@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+	"github.com/shahin-bayat/lokl/internal/process"
+)
+
+const (
+	envFormatShell  = "shell"
+	envFormatDotenv = "dotenv"
+	envFormatJSON   = "json"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <service> -- <command> [args...]",
+	Short: "Run a command in a service's directory and environment",
+	Long: `Run a one-off command in the service's path with the environment the
+service itself gets: env_from, discovery variables and env.
+
+Discovery variables describe every service as running locally. Services
+with a dynamic port have no PORT outside lokl up.`,
+	Example: `  lokl exec api -- pnpm prisma studio
+  lokl exec db -- psql`,
+	Args:         cobra.MinimumNArgs(2),
+	SilenceUsage: true,
+	RunE:         runExec,
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env <service>",
+	Short: "Print the environment lokl gives a service",
+	Long: `Print the variables lokl sets for a service, that is everything that
+differs from the current environment. Use --all to include the inherited
+environment as well.`,
+	Example: `  eval "$(lokl env api)"
+  lokl env api --format dotenv > .env.local`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runEnv,
+}
+
+var (
+	envFormat string
+	envAll    bool
+)
+
+func init() {
+	execCmd.Flags().SetInterspersed(false)
+	envCmd.Flags().StringVarP(&envFormat, "format", "f", envFormatShell, "output format (shell, dotenv or json)")
+	envCmd.Flags().BoolVar(&envAll, "all", false, "include variables inherited from the current environment")
+}
+
+// serviceEnv loads the config and builds the environment of one service the
+// same way the process runner does.
+func serviceEnv(name string) (config.Service, []string, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return config.Service{}, nil, err
+	}
+
+	svc, ok := cfg.Services[name]
+	if !ok {
+		return config.Service{}, nil, fmt.Errorf("unknown service %q", name)
+	}
+	if svc.Image != "" {
+		return config.Service{}, nil, fmt.Errorf("service %q runs an image; exec only supports command services", name)
+	}
+
+	discovery, err := cfg.DiscoveryEnv(nil)
+	if err != nil {
+		return config.Service{}, nil, err
+	}
+
+	env, err := process.Environ(svc, discovery)
+	if err != nil {
+		return config.Service{}, nil, fmt.Errorf("service %q: %w", name, err)
+	}
+	return svc, env, nil
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	// Flag parsing stops at the service name, so a "--" reaches us as an
+	// argument.
+	name, command := args[0], args[1:]
+	if command[0] == "--" {
+		command = command[1:]
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("no command given")
+	}
+
+	svc, env, err := serviceEnv(name)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the command with the service's PATH, which env_from may have
+	// changed, and from its directory so relative commands work.
+	if err := os.Chdir(svc.Path); err != nil {
+		return fmt.Errorf("changing to %s: %w", svc.Path, err)
+	}
+	for _, kv := range env {
+		if path, ok := strings.CutPrefix(kv, "PATH="); ok {
+			_ = os.Setenv("PATH", path)
+		}
+	}
+	bin, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+
+	// Replace lokl so the command owns the terminal and receives signals
+	// directly, as if it had been started by the shell.
+	if err := syscall.Exec(bin, command, env); err != nil {
+		return fmt.Errorf("running %s: %w", command[0], err)
+	}
+	return nil
+}
+
+func runEnv(cmd *cobra.Command, args []string) error {
+	_, env, err := serviceEnv(args[0])
+	if err != nil {
+		return err
+	}
+
+	vars := envVars(env)
+	if !envAll {
+		for _, kv := range os.Environ() {
+			key, value, _ := strings.Cut(kv, "=")
+			if v, ok := vars[key]; ok && v == value {
+				delete(vars, key)
+			}
+		}
+	}
+
+	out, err := formatEnv(vars, envFormat)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
+
+func envVars(env []string) map[string]string {
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		vars[key] = value
+	}
+	return vars
+}
+
+func formatEnv(vars map[string]string, format string) (string, error) {
+	if format == envFormatJSON {
+		data, err := json.MarshalIndent(vars, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("encoding environment: %w", err)
+		}
+		return string(data) + "\n", nil
+	}
+
+	var quote func(string) string
+	prefix := ""
+	switch format {
+	case envFormatShell:
+		quote, prefix = shellQuote, "export "
+	case envFormatDotenv:
+		quote = dotenvQuote
+	default:
+		return "", fmt.Errorf("unknown format %q (want %s, %s or %s)", format, envFormatShell, envFormatDotenv, envFormatJSON)
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s%s=%s\n", prefix, k, quote(vars[k]))
+	}
+	return b.String(), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dotenvQuote double-quotes s using the escapes lokl's env_file parser
+// understands.
+func dotenvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
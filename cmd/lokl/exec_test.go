@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+// trickyVars hold values that need quoting in every format.
+var trickyVars = map[string]string{
+	"PLAIN":     "value",
+	"EMPTY":     "",
+	"QUOTE":     "it's",
+	"QUOTES":    `'a' "b"`,
+	"NEWLINE":   "line1\nline2",
+	"DOLLAR":    "$HOME ${USER} $$ $(id)",
+	"BACKSLASH": `C:\path\n`,
+	"TAB":       "a\tb",
+}
+
+func TestFormatEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "shell",
+			vars:   map[string]string{"B": "2", "A": "1"},
+			format: envFormatShell,
+			want:   "export A='1'\nexport B='2'\n",
+		},
+		{
+			name:   "shell single quote",
+			vars:   map[string]string{"QUOTE": "it's"},
+			format: envFormatShell,
+			want:   `export QUOTE='it'\''s'` + "\n",
+		},
+		{
+			name:   "shell newline",
+			vars:   map[string]string{"NEWLINE": "line1\nline2"},
+			format: envFormatShell,
+			want:   "export NEWLINE='line1\nline2'\n",
+		},
+		{
+			name:   "shell dollar",
+			vars:   map[string]string{"DOLLAR": "$HOME ${USER}"},
+			format: envFormatShell,
+			want:   "export DOLLAR='$HOME ${USER}'\n",
+		},
+		{
+			name:   "dotenv",
+			vars:   map[string]string{"B": "2", "A": "1"},
+			format: envFormatDotenv,
+			want:   "A=\"1\"\nB=\"2\"\n",
+		},
+		{
+			name:   "dotenv quotes",
+			vars:   map[string]string{"QUOTES": `'a' "b"`},
+			format: envFormatDotenv,
+			want:   `QUOTES="'a' \"b\""` + "\n",
+		},
+		{
+			name:   "dotenv newline and tab",
+			vars:   map[string]string{"NEWLINE": "line1\nline2\tend"},
+			format: envFormatDotenv,
+			want:   `NEWLINE="line1\nline2\tend"` + "\n",
+		},
+		{
+			name:   "dotenv dollar",
+			vars:   map[string]string{"DOLLAR": "$HOME ${USER}"},
+			format: envFormatDotenv,
+			want:   `DOLLAR="$HOME ${USER}"` + "\n",
+		},
+		{
+			name:   "dotenv backslash",
+			vars:   map[string]string{"BACKSLASH": `C:\path\n`},
+			format: envFormatDotenv,
+			want:   `BACKSLASH="C:\\path\\n"` + "\n",
+		},
+		{
+			name:   "json",
+			vars:   map[string]string{"QUOTE": "it's", "NEWLINE": "a\nb", "DOLLAR": "$HOME"},
+			format: envFormatJSON,
+			want:   "{\n  \"DOLLAR\": \"$HOME\",\n  \"NEWLINE\": \"a\\nb\",\n  \"QUOTE\": \"it's\"\n}\n",
+		},
+		{
+			name:   "empty",
+			vars:   map[string]string{},
+			format: envFormatShell,
+			want:   "",
+		},
+		{
+			name:    "unknown format",
+			vars:    map[string]string{"A": "1"},
+			format:  "yaml",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatEnv(tt.vars, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("formatEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("formatEnv() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFormatEnvRoundTrip reads each format back the way it is consumed and
+// expects the original values.
+func TestFormatEnvRoundTrip(t *testing.T) {
+	tests := []struct {
+		format string
+		read   func(t *testing.T, out string) map[string]string
+	}{
+		{format: envFormatShell, read: evalShell},
+		{format: envFormatDotenv, read: readDotenv},
+		{format: envFormatJSON, read: func(t *testing.T, out string) map[string]string {
+			var vars map[string]string
+			if err := json.Unmarshal([]byte(out), &vars); err != nil {
+				t.Fatal(err)
+			}
+			return vars
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			out, err := formatEnv(trickyVars, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tt.read(t, out)
+			for k, want := range trickyVars {
+				if got[k] != want {
+					t.Errorf("%s = %q, want %q\noutput:\n%s", k, got[k], want, out)
+				}
+			}
+		})
+	}
+}
+
+// evalShell evaluates out in sh and returns the exported variables.
+func evalShell(t *testing.T, out string) map[string]string {
+	t.Helper()
+
+	// NUL-separated, so values with newlines survive.
+	keys := slices.Sorted(maps.Keys(trickyVars))
+	script := out + "for k in " + strings.Join(keys, " ") + `; do eval "printf '%s=%s\0' \"\$k\" \"\$$k\""; done`
+	data, err := exec.Command("sh", "-c", script).Output()
+	if err != nil {
+		t.Fatalf("sh: %v", err)
+	}
+
+	vars := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00") {
+		key, value, _ := strings.Cut(kv, "=")
+		vars[key] = value
+	}
+	return vars
+}
+
+// readDotenv reads out with the parser lokl uses for env_file.
+func readDotenv(t *testing.T, out string) map[string]string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := config.ReadEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vars
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 
+	"github.com/shahin-bayat/lokl/internal/config"
 	"github.com/shahin-bayat/lokl/internal/inspect"
 )
 
@@ -184,7 +185,7 @@ func saveConfig(projectName, domain string, services map[string]serviceConfig) e
 
 	cfg := map[string]any{
 		"name":    projectName,
-		"version": "1",
+		"version": strconv.Itoa(config.CurrentVersion),
 		"proxy": map[string]string{
 			"domain": domain,
 		},
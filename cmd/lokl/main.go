@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -8,15 +9,20 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/shahin-bayat/lokl/internal/config"
 	"github.com/shahin-bayat/lokl/internal/version"
 )
 
-const defaultConfigFile = "lokl.yaml"
+const defaultConfigFile = config.DefaultFile
 
 var configFile string
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -26,6 +32,11 @@ var rootCmd = &cobra.Command{
 	Short:   "Local development environment orchestrator",
 	Long:    "lokl - Define and run your local development environment with a single command.",
 	Version: version.Version,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("config") {
+			configFile = findConfigFile()
+		}
+	},
 }
 
 var downCmd = &cobra.Command{
@@ -49,7 +60,22 @@ var statusCmd = &cobra.Command{
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", defaultConfigFile, "config file path")
-	rootCmd.AddCommand(upCmd, downCmd, statusCmd, dnsCmd, initCmd)
+	rootCmd.AddCommand(upCmd, downCmd, statusCmd, dnsCmd, initCmd, configCmd, runWithCmd, execCmd, envCmd, trustCmd, setupPortCmd, proxyCmd)
+}
+
+// findConfigFile walks up from the working directory to the nearest
+// lokl.yaml. If there is none, the default name is kept so commands report
+// the usual missing-file error.
+func findConfigFile() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return defaultConfigFile
+	}
+	path, err := config.Find(cwd)
+	if err != nil {
+		return defaultConfigFile
+	}
+	return path
 }
 
 func waitForSignal() {
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+	"github.com/shahin-bayat/lokl/internal/proxy"
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Manage the shared proxy used by projects with proxy.shared",
+}
+
+var proxyServe struct {
+	listen       string
+	https        bool
+	httpRedirect bool
+	publicPort   int
+	ca           string
+	dns          string
+}
+
+var proxyServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the shared proxy in the foreground",
+	Long: `Run the machine-wide proxy that projects with proxy.shared: true register
+their routes with. lokl up starts it in the background with the project's
+proxy settings when it is not running, so this is rarely needed by hand.`,
+	SilenceUsage: true,
+	RunE:         runProxyServe,
+}
+
+var proxyLsCmd = &cobra.Command{
+	Use:          "ls",
+	Short:        "List the projects and routes registered with the shared proxy",
+	SilenceUsage: true,
+	RunE:         runProxyLs,
+}
+
+var proxyStopCmd = &cobra.Command{
+	Use:          "stop",
+	Short:        "Stop the shared proxy",
+	SilenceUsage: true,
+	RunE:         runProxyStop,
+}
+
+func init() {
+	f := proxyServeCmd.Flags()
+	f.StringVar(&proxyServe.listen, "listen", "", "address to listen on, as host:port or a port (default 127.0.0.1:443, or :80 without HTTPS)")
+	f.BoolVar(&proxyServe.https, "https", true, "serve HTTPS")
+	f.BoolVar(&proxyServe.httpRedirect, "http-redirect", false, "redirect port 80 to HTTPS")
+	f.IntVar(&proxyServe.publicPort, "public-port", 0, "port browsers connect to, when it is forwarded to the listen port")
+	f.StringVar(&proxyServe.ca, "ca", config.CALokl, "certificate authority: lokl or mkcert")
+	f.StringVar(&proxyServe.dns, "dns", config.DNSHosts, "run the DNS server (server) or not (hosts)")
+
+	proxyCmd.AddCommand(proxyServeCmd, proxyLsCmd, proxyStopCmd)
+}
+
+func runProxyServe(cmd *cobra.Command, args []string) error {
+	https := proxyServe.https
+	d, err := proxy.NewDaemon(config.ProxyConfig{
+		HTTPS:        &https,
+		CA:           proxyServe.ca,
+		HTTPRedirect: proxyServe.httpRedirect,
+		Listen:       proxyServe.listen,
+		PublicPort:   proxyServe.publicPort,
+		DNS:          proxyServe.dns,
+	})
+	if err != nil {
+		return err
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		_ = d.Stop()
+	}()
+
+	fmt.Printf("Shared proxy listening on %s\n", d.Addr())
+	return d.Run()
+}
+
+func runProxyLs(cmd *cobra.Command, args []string) error {
+	status, err := proxy.SharedProxyStatus()
+	if err != nil {
+		fmt.Println("Shared proxy is not running")
+		return nil
+	}
+
+	scheme := "http"
+	if status.HTTPS {
+		scheme = "https"
+	}
+	fmt.Printf("Shared proxy on %s (%s, pid %d)\n", status.Addr, scheme, status.PID)
+	if len(status.Projects) == 0 {
+		fmt.Println("\nNo projects registered")
+		return nil
+	}
+
+	for _, reg := range status.Projects {
+		fmt.Printf("\n%s  %s\n", reg.Project, reg.Dir)
+		if len(reg.Routes) == 0 {
+			fmt.Println("  no routes")
+		}
+		for _, rt := range reg.Routes {
+			target := "remote"
+			switch {
+			case !rt.Enabled:
+			case rt.Port == 0:
+				target = "not started"
+			default:
+				target = fmt.Sprintf("localhost:%d", rt.Port)
+			}
+			fmt.Printf("  %s%s → %s (%s)\n", rt.Domain, rt.PathPrefix, target, rt.Service)
+		}
+	}
+	return nil
+}
+
+func runProxyStop(cmd *cobra.Command, args []string) error {
+	if _, err := proxy.SharedProxyStatus(); err != nil {
+		fmt.Println("Shared proxy is not running")
+		return nil
+	}
+	if err := proxy.StopSharedProxy(); err != nil {
+		return err
+	}
+	fmt.Println("✓ Stopped shared proxy")
+	return nil
+}
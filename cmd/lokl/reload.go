@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/supervisor"
+)
+
+const configPollInterval = time.Second
+
+// watchConfig reloads the supervisor when any file the config is composed
+// from changes on disk or lokl receives SIGHUP. onReload is called after
+// every reload attempt. The returned function stops watching.
+func watchConfig(sup *supervisor.Supervisor, onReload func(error)) func() {
+	done := make(chan struct{})
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+
+		last := fileStamps(sup.ConfigFiles())
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+			case <-ticker.C:
+				stamps := fileStamps(sup.ConfigFiles())
+				if stamps == last {
+					continue
+				}
+				last = stamps
+			}
+
+			err := sup.ReloadConfig()
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		close(done)
+	}
+}
+
+// fileStamps fingerprints a set of files; missing files contribute nothing,
+// so creating an override file counts as a change.
+func fileStamps(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:-;", path)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String()
+}
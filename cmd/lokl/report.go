@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shahin-bayat/lokl/pkg/lokl"
+)
+
+// report summarizes a run-with session for CI.
+type report struct {
+	Project         string
+	Command         string
+	CommandRan      bool
+	ExitCode        int
+	CommandDuration time.Duration
+	Duration        time.Duration
+	Services        []lokl.ServiceStatus
+	Error           string
+}
+
+func (r *report) write(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if filepath.Ext(path) == ".xml" {
+		data, err = r.junit()
+	} else {
+		data, err = r.json()
+	}
+	if err != nil {
+		return fmt.Errorf("encoding report: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+type jsonService struct {
+	Name      string  `json:"name"`
+	Running   bool    `json:"running"`
+	Healthy   bool    `json:"healthy"`
+	StartupMS float64 `json:"startup_ms,omitempty"`
+}
+
+type jsonReport struct {
+	Project    string        `json:"project"`
+	Passed     bool          `json:"passed"`
+	DurationMS float64       `json:"duration_ms"`
+	Services   []jsonService `json:"services"`
+	Command    struct {
+		Args       string  `json:"args"`
+		Ran        bool    `json:"ran"`
+		ExitCode   int     `json:"exit_code"`
+		DurationMS float64 `json:"duration_ms"`
+	} `json:"command"`
+	Error string `json:"error,omitempty"`
+}
+
+func (r *report) passed() bool {
+	return r.Error == "" && r.CommandRan && r.ExitCode == 0
+}
+
+func (r *report) json() ([]byte, error) {
+	out := jsonReport{
+		Project:    r.Project,
+		Passed:     r.passed(),
+		DurationMS: ms(r.Duration),
+		Services:   []jsonService{},
+		Error:      r.Error,
+	}
+	for _, st := range r.Services {
+		out.Services = append(out.Services, jsonService{
+			Name:      st.Name,
+			Running:   st.Running,
+			Healthy:   st.Healthy,
+			StartupMS: ms(st.HealthyAfter),
+		})
+	}
+	out.Command.Args = r.Command
+	out.Command.Ran = r.CommandRan
+	out.Command.ExitCode = r.ExitCode
+	out.Command.DurationMS = ms(r.CommandDuration)
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	return append(data, '\n'), err
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// junit reports each service as a test case that passes once healthy, and
+// the command as a final test case.
+func (r *report) junit() ([]byte, error) {
+	suite := junitSuite{Name: "lokl." + r.Project, Time: seconds(r.Duration)}
+
+	for _, st := range r.Services {
+		c := junitCase{ClassName: "services", Name: st.Name, Time: seconds(st.HealthyAfter)}
+		switch {
+		case !st.Running:
+			c.Failure = &junitFailure{Message: "service is not running"}
+		case !st.Healthy:
+			c.Failure = &junitFailure{Message: "service is not healthy"}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	command := junitCase{ClassName: "command", Name: r.Command, Time: seconds(r.CommandDuration)}
+	switch {
+	case r.Error != "":
+		command.Failure = &junitFailure{Message: r.Error}
+	case !r.CommandRan:
+		command.Failure = &junitFailure{Message: "command did not run"}
+	case r.ExitCode != 0:
+		command.Failure = &junitFailure{Message: fmt.Sprintf("exit status %d", r.ExitCode)}
+	}
+	suite.Cases = append(suite.Cases, command)
+
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	data, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
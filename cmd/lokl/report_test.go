@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahin-bayat/lokl/pkg/lokl"
+)
+
+func TestReport(t *testing.T) {
+	services := []lokl.ServiceStatus{
+		{Name: "api", Running: true, Healthy: true, HealthyAfter: 1500 * time.Millisecond},
+		{Name: "db", Running: true},
+		{Name: "worker"},
+	}
+
+	tests := []struct {
+		name       string
+		report     report
+		wantPassed bool
+		// wantFailures maps failed JUnit cases to their failure message.
+		wantFailures map[string]string
+	}{
+		{
+			name: "passed",
+			report: report{
+				CommandRan: true,
+				Services:   services[:1],
+			},
+			wantPassed:   true,
+			wantFailures: map[string]string{},
+		},
+		{
+			name: "command failed",
+			report: report{
+				CommandRan: true,
+				ExitCode:   3,
+				Services:   services[:1],
+			},
+			wantFailures: map[string]string{"pnpm e2e": "exit status 3"},
+		},
+		{
+			name: "services failed",
+			report: report{
+				Services: services,
+				Error:    "waiting for db, worker to become healthy: context deadline exceeded",
+			},
+			wantFailures: map[string]string{
+				"db":       "service is not healthy",
+				"worker":   "service is not running",
+				"pnpm e2e": "waiting for db, worker to become healthy: context deadline exceeded",
+			},
+		},
+		{
+			name:         "command did not run",
+			report:       report{Services: services[:1]},
+			wantFailures: map[string]string{"pnpm e2e": "command did not run"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.report
+			r.Project, r.Command = "shop", "pnpm e2e"
+			r.Duration = 2 * time.Second
+			dir := t.TempDir()
+
+			jsonPath := filepath.Join(dir, "report.json")
+			if err := r.write(jsonPath); err != nil {
+				t.Fatal(err)
+			}
+			rep := readJSONReport(t, jsonPath)
+			if rep.Project != "shop" || rep.Command.Args != "pnpm e2e" || rep.DurationMS != 2000 {
+				t.Errorf("json report = %+v", rep)
+			}
+			if rep.Passed != tt.wantPassed || rep.Error != r.Error || rep.Command.ExitCode != r.ExitCode {
+				t.Errorf("json report = %+v, want passed %v", rep, tt.wantPassed)
+			}
+			if len(rep.Services) != len(r.Services) {
+				t.Fatalf("json services = %+v, want %d", rep.Services, len(r.Services))
+			}
+			if got := rep.Services[0].StartupMS; got != 1500 {
+				t.Errorf("json startup_ms = %v, want 1500", got)
+			}
+
+			xmlPath := filepath.Join(dir, "report.xml")
+			if err := r.write(xmlPath); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(xmlPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), xml.Header) {
+				t.Errorf("junit report lacks the XML header:\n%s", data)
+			}
+			var suites junitSuites
+			if err := xml.Unmarshal(data, &suites); err != nil {
+				t.Fatal(err)
+			}
+			if len(suites.Suites) != 1 {
+				t.Fatalf("junit suites = %+v, want one", suites.Suites)
+			}
+			suite := suites.Suites[0]
+			if suite.Name != "lokl.shop" || suite.Tests != len(r.Services)+1 || suite.Failures != len(tt.wantFailures) {
+				t.Errorf("junit suite = %s with %d tests, %d failures", suite.Name, suite.Tests, suite.Failures)
+			}
+			for _, c := range suite.Cases {
+				want, fails := tt.wantFailures[c.Name]
+				switch {
+				case fails && (c.Failure == nil || c.Failure.Message != want):
+					t.Errorf("junit case %s failure = %+v, want %q", c.Name, c.Failure, want)
+				case !fails && c.Failure != nil:
+					t.Errorf("junit case %s failed: %q", c.Name, c.Failure.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestReportNoPath(t *testing.T) {
+	r := &report{Project: "shop"}
+	if err := r.write(""); err != nil {
+		t.Errorf("write(\"\") = %v", err)
+	}
+}
+
+// The JSON report lists services as an array even when none started.
+func TestReportEmptyServices(t *testing.T) {
+	data, err := (&report{Project: "shop"}).json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if services, ok := out["services"].([]any); !ok || len(services) != 0 {
+		t.Errorf("services = %#v, want []", out["services"])
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shahin-bayat/lokl/pkg/config"
+	"github.com/shahin-bayat/lokl/pkg/lokl"
+)
+
+var (
+	runTimeout  time.Duration
+	runServices []string
+	runProfiles []string
+	runProxy    bool
+	runReport   string
+)
+
+var runWithCmd = &cobra.Command{
+	Use:     "run-with [flags] -- <command> [args...]",
+	Aliases: []string{"test"},
+	Short:   "Start services, run a command against them, and tear down",
+	Long: `Start services without the TUI, wait until they are healthy, run a
+command, then stop everything. lokl exits with the command's exit status.
+
+The command gets the LOKL_<SERVICE>_URL, _HOST and _PORT variables of the
+running services. Output of services that failed is printed at the end.`,
+	Example: `  lokl run-with -- pnpm e2e
+  lokl test --timeout 5m --report report.xml -- go test ./e2e/...`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runRunWith,
+}
+
+func init() {
+	runWithCmd.Flags().DurationVar(&runTimeout, "timeout", 15*time.Minute, "overall time limit for startup and the command")
+	runWithCmd.Flags().StringSliceVarP(&runServices, "service", "s", nil, "start only this service and its dependencies (repeatable)")
+	runWithCmd.Flags().StringSliceVarP(&runProfiles, "profile", "p", nil, "start services in profile (repeatable)")
+	runWithCmd.Flags().BoolVar(&runProxy, "proxy", false, "run the HTTPS proxy (services are reached on localhost otherwise)")
+	runWithCmd.Flags().StringVar(&runReport, "report", "", "write a report of service startup and health (.xml for JUnit, otherwise JSON)")
+}
+
+// exitError makes lokl exit with a specific status instead of 1.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func runRunWith(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+
+	// sigs records which signal ended the run, so it can be forwarded to
+	// the command; sigCtx stops startup and the health wait.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(sigCtx, runTimeout)
+	defer cancel()
+
+	rep := &report{Project: cfg.Name, Command: strings.Join(args, " ")}
+	started := time.Now()
+
+	fmt.Printf("Starting %s...\n", cfg.Name)
+	env, err := lokl.Up(ctx, cfg, lokl.Options{
+		Services: runServices,
+		Profiles: runProfiles,
+		Proxy:    runProxy,
+		Log:      os.Stdout,
+	})
+	if err != nil {
+		if sigCtx.Err() != nil {
+			err = errInterrupted
+		}
+		rep.Error = err.Error()
+		return errors.Join(err, rep.write(runReport))
+	}
+
+	code, runErr := runAgainst(ctx, sigCtx, sigs, env, args, rep)
+
+	rep.Services = env.Status()
+	rep.Duration = time.Since(started)
+	dumpFailedLogs(env, rep.Services)
+
+	fmt.Println("\nShutting down...")
+	if err := env.Down(); err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Shutdown: %v\n", err)
+	}
+
+	if err := rep.write(runReport); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if code != 0 {
+		return &exitError{code: code}
+	}
+	return nil
+}
+
+// errInterrupted is reported when SIGINT or SIGTERM ends a run.
+var errInterrupted = errors.New("interrupted")
+
+// commandStopGrace is how long the command has to exit after a forwarded
+// signal before it is killed.
+const commandStopGrace = 10 * time.Second
+
+// runAgainst waits for env to become healthy and runs the command with the
+// service-discovery variables. It returns the command's exit code. A signal
+// that cancels sigCtx is forwarded to the command; a timeout kills it.
+func runAgainst(ctx, sigCtx context.Context, sigs <-chan os.Signal, env *lokl.Env, args []string, rep *report) (int, error) {
+	if err := env.WaitHealthy(ctx); err != nil {
+		if sigCtx.Err() != nil {
+			err = errInterrupted
+		}
+		rep.Error = err.Error()
+		return 0, err
+	}
+	fmt.Println("✓ All services healthy")
+
+	discovery, err := env.DiscoveryEnv()
+	if err != nil {
+		rep.Error = err.Error()
+		return 0, err
+	}
+
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Cancel = func() error {
+		if sigCtx.Err() == nil {
+			return c.Process.Kill()
+		}
+		sig := os.Signal(syscall.SIGTERM)
+		select {
+		case sig = <-sigs:
+		default:
+		}
+		return c.Process.Signal(sig)
+	}
+	c.WaitDelay = commandStopGrace
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Env = os.Environ()
+	for k, v := range discovery {
+		c.Env = append(c.Env, k+"="+v)
+	}
+
+	fmt.Printf("\nRunning %s\n\n", strings.Join(args, " "))
+	commandStarted := time.Now()
+	err = c.Run()
+	rep.CommandDuration = time.Since(commandStarted)
+	rep.CommandRan = true
+
+	var exit *exec.ExitError
+	switch {
+	case sigCtx.Err() != nil:
+		rep.Error = errInterrupted.Error()
+		if errors.As(err, &exit) {
+			rep.ExitCode = exitCode(exit)
+		}
+		return 0, errInterrupted
+	case ctx.Err() != nil:
+		rep.Error = fmt.Sprintf("timed out after %s", runTimeout)
+		return 0, fmt.Errorf("command %s", rep.Error)
+	case errors.As(err, &exit):
+		rep.ExitCode = exitCode(exit)
+		return rep.ExitCode, nil
+	case err != nil:
+		rep.Error = err.Error()
+		return 0, fmt.Errorf("running %s: %w", args[0], err)
+	}
+	return 0, nil
+}
+
+// exitCode returns the command's exit status, or 128 plus the signal number
+// when a signal killed it, as shells report it.
+func exitCode(exit *exec.ExitError) int {
+	if ws, ok := exit.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return exit.ExitCode()
+}
+
+func dumpFailedLogs(env *lokl.Env, statuses []lokl.ServiceStatus) {
+	for _, st := range statuses {
+		if st.Running && st.Healthy {
+			continue
+		}
+		fmt.Printf("\n✗ %s failed; output:\n", st.Name)
+		for _, line := range env.Logs(st.Name) {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
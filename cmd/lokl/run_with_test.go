@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// setupRunWith writes a config with one service, api, listening on a free
+// port, and points the run-with flags at it. It returns the port and the
+// path of the JSON report.
+func setupRunWith(t *testing.T) (int, string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, defaultConfigFile)
+	data := fmt.Sprintf("name: runwith\nservices:\n  api:\n    command: sleep 30\n    port: %d\n", port)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prevConfig, prevReport, prevTimeout := configFile, runReport, runTimeout
+	configFile = path
+	runReport = filepath.Join(dir, "report.json")
+	runTimeout = time.Minute
+	t.Cleanup(func() { configFile, runReport, runTimeout = prevConfig, prevReport, prevTimeout })
+
+	return port, runReport
+}
+
+func readJSONReport(t *testing.T, path string) jsonReport {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep jsonReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("report %s: %v", data, err)
+	}
+	return rep
+}
+
+func TestRunWith(t *testing.T) {
+	tests := []struct {
+		name string
+		// script is run with sh -c; it sees LOKL_API_PORT.
+		script   string
+		wantCode int // exit status lokl returns through exitError
+	}{
+		{name: "success", script: `test "$LOKL_API_PORT" = "$WANT_PORT"`},
+		{name: "exit status", script: "exit 3", wantCode: 3},
+		{name: "killed by signal", script: "kill -KILL $$", wantCode: 128 + int(syscall.SIGKILL)},
+		{name: "terminated by signal", script: "kill -TERM $$", wantCode: 128 + int(syscall.SIGTERM)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, report := setupRunWith(t)
+			t.Setenv("WANT_PORT", fmt.Sprint(port))
+
+			err := runRunWith(runWithCmd, []string{"sh", "-c", tt.script})
+
+			var exit *exitError
+			switch {
+			case tt.wantCode == 0 && err != nil:
+				t.Fatalf("runRunWith() error = %v", err)
+			case tt.wantCode != 0 && (!errors.As(err, &exit) || exit.code != tt.wantCode):
+				t.Fatalf("runRunWith() error = %v, want exit status %d", err, tt.wantCode)
+			}
+
+			rep := readJSONReport(t, report)
+			if !rep.Command.Ran || rep.Command.ExitCode != tt.wantCode {
+				t.Errorf("report command = %+v, want exit code %d", rep.Command, tt.wantCode)
+			}
+			if rep.Passed != (tt.wantCode == 0) {
+				t.Errorf("report passed = %v", rep.Passed)
+			}
+			if len(rep.Services) != 1 || !rep.Services[0].Healthy {
+				t.Errorf("report services = %+v, want healthy api", rep.Services)
+			}
+		})
+	}
+}
+
+func TestRunWithCommandNotFound(t *testing.T) {
+	_, report := setupRunWith(t)
+
+	err := runRunWith(runWithCmd, []string{"lokl-no-such-command"})
+	var exit *exitError
+	if err == nil || errors.As(err, &exit) {
+		t.Fatalf("runRunWith() error = %v, want a start error", err)
+	}
+
+	rep := readJSONReport(t, report)
+	if rep.Passed || rep.Error == "" {
+		t.Errorf("report = %+v, want a failure with an error", rep)
+	}
+}
+
+func TestRunWithForwardsSignal(t *testing.T) {
+	_, report := setupRunWith(t)
+	ready := filepath.Join(t.TempDir(), "ready")
+
+	// The command exits 7 on SIGTERM, so its status shows it got the signal.
+	script := fmt.Sprintf(`trap 'kill $!; exit 7' TERM; touch %q; sleep 30 & wait`, ready)
+	done := make(chan error, 1)
+	go func() { done <- runRunWith(runWithCmd, []string{"sh", "-c", script}) }()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command did not start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errInterrupted) {
+			t.Fatalf("runRunWith() error = %v, want %v", err, errInterrupted)
+		}
+	case <-time.After(commandStopGrace + 10*time.Second):
+		t.Fatal("run-with did not stop after SIGTERM")
+	}
+
+	rep := readJSONReport(t, report)
+	if rep.Command.ExitCode != 7 || rep.Error != errInterrupted.Error() {
+		t.Errorf("report = %+v, want exit code 7 and %q", rep, errInterrupted)
+	}
+}
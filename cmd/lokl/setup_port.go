@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+	"github.com/shahin-bayat/lokl/internal/proxy"
+)
+
+var setupPortForward bool
+
+var setupPortCmd = &cobra.Command{
+	Use:   "setup-port",
+	Short: "Let the proxy use port 443 without sudo",
+	Long: `Ports below 1024 normally need root. Run this once so lokl up does not.
+
+On Linux the lokl binary is granted CAP_NET_BIND_SERVICE, which lets it
+bind port 443 directly. Run it again after upgrading lokl.
+
+With --forward (the default on macOS), firewall rules forward port 443 to
+the unprivileged port in proxy.listen instead, over IPv4 and IPv6. The
+rules last until the next reboot.`,
+	SilenceUsage: true,
+	RunE:         runSetupPort,
+}
+
+func init() {
+	setupPortCmd.Flags().BoolVar(&setupPortForward, "forward", runtime.GOOS != "linux", "forward the standard port to proxy.listen instead of granting a capability")
+}
+
+func runSetupPort(cmd *cobra.Command, args []string) error {
+	if setupPortForward {
+		return setupPortForwarding()
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding lokl binary: %w", err)
+	}
+	if bin, err = filepath.EvalSymlinks(bin); err != nil {
+		return fmt.Errorf("finding lokl binary: %w", err)
+	}
+
+	if err := proxy.GrantBindCapability(bin); err != nil {
+		return err
+	}
+	fmt.Printf("✓ %s can bind ports below 1024 without sudo\n", bin)
+	fmt.Println("  Run lokl setup-port again after upgrading lokl.")
+	return nil
+}
+
+func setupPortForwarding() error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+
+	from := cfg.Proxy.DefaultPort()
+	_, to, err := cfg.Proxy.ListenAddr()
+	if err != nil {
+		return err
+	}
+	if to < 1024 {
+		return fmt.Errorf("proxy.listen uses port %d; set it to an unprivileged port first, for example:\n\nproxy:\n  listen: 8443\n  public_port: %d", to, from)
+	}
+	if !slices.Contains(cfg.Proxy.ListenHosts(), "::1") {
+		fmt.Printf("⚠ proxy.listen binds %s only, so clients that connect to ::1 are refused.\n", strings.Join(cfg.Proxy.ListenHosts(), ", "))
+		fmt.Printf("  Set it to a bare port, such as %d, to listen on both loopback addresses.\n\n", to)
+	}
+
+	if err := proxy.ForwardPort(from, to); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Forwarding port %d to %d\n", from, to)
+	if cfg.Proxy.PublicPort != from {
+		fmt.Printf("\nAdd public_port: %d under proxy so URLs leave out the port.\n", from)
+	}
+	return nil
+}
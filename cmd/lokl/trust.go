@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/shahin-bayat/lokl/internal/proxy"
+)
+
+var trustUninstall bool
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Install lokl's root CA into the system and browser trust stores",
+	Long: `Create lokl's root certificate authority if needed and install it into
+the system trust store and the NSS databases of Firefox and Chrome, so the
+proxy's certificates are accepted without warnings. Steps that need root
+are run through sudo.
+
+Run it once per machine. Projects using proxy.ca: mkcert do not need it.`,
+	SilenceUsage: true,
+	RunE:         runTrust,
+}
+
+func init() {
+	trustCmd.Flags().BoolVar(&trustUninstall, "uninstall", false, "remove the root CA from the trust stores")
+}
+
+func runTrust(cmd *cobra.Command, args []string) error {
+	dir, err := proxy.CADir()
+	if err != nil {
+		return err
+	}
+
+	if trustUninstall {
+		removed, err := proxy.Untrust()
+		for _, store := range removed {
+			fmt.Printf("✓ Removed from %s\n", store)
+		}
+		return err
+	}
+
+	installed, err := proxy.Trust()
+	for _, store := range installed {
+		fmt.Printf("✓ Installed in %s\n", store)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nRoot CA: %s\n", dir)
+	fmt.Println("Restart your browser to pick up the change.")
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -13,49 +14,84 @@ import (
 	"github.com/shahin-bayat/lokl/internal/tui"
 )
 
-var detach bool
+var (
+	detach   bool
+	profiles []string
+)
 
 var upCmd = &cobra.Command{
 	Use:   "up [services...]",
 	Short: "Start the development environment",
-	RunE:  runUp,
+	Long: `Start the development environment.
+
+With no arguments, every service with autostart enabled is started. Naming
+services or profiles starts only those services plus their dependencies.`,
+	RunE: runUp,
 }
 
 func init() {
 	upCmd.Flags().BoolVarP(&detach, "detach", "d", false, "run without TUI")
+	upCmd.Flags().StringSliceVarP(&profiles, "profile", "p", nil, "start services in profile (repeatable)")
 }
 
 func runUp(cmd *cobra.Command, args []string) error {
-	cfg, err := config.Load(configFile)
+	log := logger.New(os.Stdout)
+
+	cfg, issues, err := config.LoadAll(configFile)
 	if err != nil {
 		return err
 	}
+	for _, w := range issues.Warnings() {
+		log.Infof("⚠ %s\n", w)
+	}
+	if err := issues.Err(); err != nil {
+		return fmt.Errorf("validating config: %w", err)
+	}
+	if len(issues) > 0 {
+		log.Infof("\n")
+	}
 
-	processFactory := func(name string, svc config.Service, onChange func()) supervisor.ProcessRunner {
-		return process.New(name, svc, onChange)
+	processFactory := func(name string, svc config.Service, discovery map[string]string, onChange func()) supervisor.ProcessRunner {
+		return process.New(name, svc, discovery, onChange)
 	}
 
-	log := logger.New(os.Stdout)
 	prx := proxy.New(cfg)
 
 	if cfg.Proxy.Domain != "" {
-		if unresolved := prx.UnresolvedDomains(); len(unresolved) > 0 {
+		// The embedded DNS server only answers once the proxy is set up,
+		// so only hosts mode can be checked this early.
+		if cfg.Proxy.DNS == config.DNSHosts && len(prx.UnresolvedDomains()) > 0 {
 			log.Infof("⚠ DNS not configured for %s\n", cfg.Proxy.Domain)
 			log.Infof("  Run: sudo lokl dns setup\n\n")
 		}
+		if !prx.CATrusted() {
+			log.Infof("⚠ lokl's root CA is not trusted; browsers will warn about certificates\n")
+			log.Infof("  Run: lokl trust\n\n")
+		}
 	}
 
 	sup := supervisor.New(cfg, processFactory, prx, log)
+	sup.SetConfigLoader(func() (*config.Config, error) {
+		return config.Load(configFile)
+	})
 
-	if err := sup.Start(); err != nil {
+	if err := sup.Start(args, profiles); err != nil {
 		return err
 	}
 
 	if detach {
+		stopWatch := watchConfig(sup, func(error) {
+			log.Infof("%s\n", sup.Notice())
+		})
+		defer stopWatch()
+
 		log.Infof("\nPress Ctrl+C to stop\n")
 		waitForSignal()
 		log.Infof("\nShutting down...\n")
 	} else {
+		stopWatch := watchConfig(sup, nil)
+		defer stopWatch()
+
 		app := tui.New(sup)
 		if err := app.Run(); err != nil {
 			_ = sup.Stop()
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	includeKey   = "include"
+	templatesKey = "templates"
+	extendsKey   = "extends"
+)
+
+// overrideSuffixes are merged on top of the main config file when present,
+// in this order: lokl.yaml -> lokl.override.yaml -> lokl.local.yaml.
+var overrideSuffixes = []string{".override", ".local"}
+
+// loadDocument reads the config at path and composes it into a single
+// mapping node:
+//
+//  1. Files listed under include are merged beneath the including file, in
+//     order, with paths relative to the including file.
+//  2. Override files next to the main config are merged on top.
+//  3. Services with extends are merged on top of the service or template
+//     they extend.
+//
+// Merging is recursive for mappings; scalars and lists are replaced by the
+// overriding value, and an explicit null removes the key.
+//
+// The document records every file that contributes to it, including
+// override files that do not exist yet.
+func loadDocument(path string) (*document, error) {
+	rootDir := filepath.Dir(path)
+	d := &document{origins: make(map[*yaml.Node]string)}
+
+	root, err := d.read(path, rootDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, override := range OverrideFiles(path) {
+		if _, err := os.Stat(override); err != nil {
+			d.files = append(d.files, override)
+			continue
+		}
+		node, err := d.read(override, rootDir, nil)
+		if err != nil {
+			return nil, err
+		}
+		root = mergeNodes(root, node)
+	}
+
+	if err := resolveExtends(root); err != nil {
+		return nil, err
+	}
+
+	d.root = root
+	return d, nil
+}
+
+// document is a composed config tree. origins maps parsed nodes back to the
+// file they came from; merged mapping nodes are copies, but their key and
+// scalar nodes are the originals.
+type document struct {
+	root    *yaml.Node
+	files   []string
+	origins map[*yaml.Node]string
+	// version is the config version the files were written for, before
+	// migrations were applied.
+	version int
+}
+
+// locate fills in the file position of each issue from its path. The
+// deepest key found along the path is used.
+func (d *document) locate(issues Issues) {
+	for i := range issues {
+		node := d.root
+		var key *yaml.Node
+		for _, segment := range issues[i].Path {
+			idx := mapIndex(node, segment)
+			if idx == -1 {
+				break
+			}
+			key, node = node.Content[idx], node.Content[idx+1]
+		}
+		if key == nil {
+			continue
+		}
+		issues[i].File = d.origins[key]
+		issues[i].Line = key.Line
+		issues[i].Column = key.Column
+	}
+}
+
+// decodeIssue turns a yaml type error message ("line N: ...") into an
+// issue positioned at the first node on that line.
+func (d *document) decodeIssue(msg string) Issue {
+	issue := Issue{Severity: SeverityError, Message: msg}
+
+	var line int
+	if _, err := fmt.Sscanf(msg, "line %d:", &line); err != nil {
+		return issue
+	}
+	issue.Message = strings.TrimSpace(strings.SplitN(msg, ":", 2)[1])
+
+	if n := findLine(d.root, line); n != nil {
+		issue.File = d.origins[n]
+		issue.Line = n.Line
+		issue.Column = n.Column
+	}
+	return issue
+}
+
+func findLine(n *yaml.Node, line int) *yaml.Node {
+	if n.Line == line {
+		return n
+	}
+	for _, child := range n.Content {
+		if found := findLine(child, line); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// typeErrorf reports a bad value from an UnmarshalYAML method so decoding
+// continues and the problem is collected with the others.
+func typeErrorf(node *yaml.Node, format string, args ...any) error {
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %s", node.Line, fmt.Sprintf(format, args...))}}
+}
+
+func (d *document) track(n *yaml.Node, file string) {
+	d.origins[n] = file
+	for _, child := range n.Content {
+		d.track(child, file)
+	}
+}
+
+// OverrideFiles returns the local override paths for a config file.
+func OverrideFiles(path string) []string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	paths := make([]string, 0, len(overrideSuffixes))
+	for _, suffix := range overrideSuffixes {
+		paths = append(paths, base+suffix+ext)
+	}
+	return paths
+}
+
+// read parses path and merges its includes beneath it.
+func (d *document) read(path, rootDir string, stack []string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", path, err)
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+	}
+	stack = append(stack, abs)
+
+	body, err := readMapping(path)
+	if err != nil {
+		return nil, err
+	}
+	d.files = append(d.files, path)
+	d.track(body, path)
+
+	dir := filepath.Dir(path)
+	if err := rebasePaths(body, dir, rootDir); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+	if includes := mapRemove(body, includeKey); includes != nil {
+		var list StringList
+		if err := includes.Decode(&list); err != nil {
+			return nil, fmt.Errorf("%s: include: %w", path, err)
+		}
+		for _, inc := range list {
+			if !filepath.IsAbs(inc) {
+				inc = filepath.Join(dir, inc)
+			}
+			node, err := d.read(inc, rootDir, stack)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeNodes(merged, node)
+		}
+	}
+
+	return mergeNodes(merged, body), nil
+}
+
+// readMapping parses a config file into a mapping node. The format is
+// chosen by extension: .toml and .json are supported alongside YAML.
+func readMapping(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case extTOML:
+		body, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		return body, nil
+	case extJSON:
+		// JSON is valid YAML, so the YAML parser keeps node positions; check
+		// it first so JSON syntax errors are reported as such.
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	body := doc.Content[0]
+	if body.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parsing config file %s: top level must be a mapping", path)
+	}
+	return body, nil
+}
+
+// rebasePaths rewrites relative path and env_file values of a file in dir so
+// they stay correct once merged into the config rooted at rootDir.
+func rebasePaths(body *yaml.Node, dir, rootDir string) error {
+	rel, err := filepath.Rel(rootDir, dir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	rebase := func(n *yaml.Node) {
+		if n == nil {
+			return
+		}
+		scalars := []*yaml.Node{n}
+		if n.Kind == yaml.SequenceNode {
+			scalars = n.Content
+		}
+		for _, s := range scalars {
+			if s.Kind == yaml.ScalarNode && s.Value != "" && !filepath.IsAbs(s.Value) && !strings.HasPrefix(s.Value, "$") {
+				s.Value = filepath.Join(rel, s.Value)
+			}
+		}
+	}
+
+	rebase(mapGet(body, "env_file"))
+	for _, section := range []string{"services", templatesKey} {
+		services := mapGet(body, section)
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(services.Content); i += 2 {
+			svc := services.Content[i]
+			rebase(mapGet(svc, "path"))
+			rebase(mapGet(svc, "env_file"))
+		}
+	}
+	return nil
+}
+
+// resolveExtends merges every service with extends on top of its base.
+// Bases are looked up in templates first, then in services. The templates
+// section is removed from the document afterwards.
+func resolveExtends(root *yaml.Node) error {
+	templates := mapRemove(root, templatesKey)
+	services := mapGet(root, "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	lookup := func(name string) *yaml.Node {
+		if n := mapGet(templates, name); n != nil {
+			return n
+		}
+		return mapGet(services, name)
+	}
+
+	resolved := make(map[*yaml.Node]*yaml.Node)
+	var resolve func(name string, node *yaml.Node, stack []string) (*yaml.Node, error)
+	resolve = func(name string, node *yaml.Node, stack []string) (*yaml.Node, error) {
+		if r, ok := resolved[node]; ok {
+			return r, nil
+		}
+		if slices.Contains(stack, name) {
+			return nil, fmt.Errorf("extends cycle: %s -> %s", strings.Join(stack, " -> "), name)
+		}
+
+		ext := mapGet(node, extendsKey)
+		if ext == nil {
+			resolved[node] = node
+			return node, nil
+		}
+		if ext.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: extends must be a service or template name", ext.Line)
+		}
+
+		base := lookup(ext.Value)
+		if base == nil {
+			return nil, fmt.Errorf("service %q extends unknown service or template %q", name, ext.Value)
+		}
+		base, err := resolve(ext.Value, base, append(stack, name))
+		if err != nil {
+			return nil, err
+		}
+
+		own := copyMapping(node)
+		mapRemove(own, extendsKey)
+		merged := mergeNodes(base, own)
+		resolved[node] = merged
+		return merged, nil
+	}
+
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name := services.Content[i].Value
+		merged, err := resolve(name, services.Content[i+1], nil)
+		if err != nil {
+			return err
+		}
+		services.Content[i+1] = merged
+	}
+
+	return nil
+}
+
+// mergeNodes merges over on top of base and returns the result. Neither
+// input is modified.
+func mergeNodes(base, over *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over
+	}
+
+	merged := copyMapping(base)
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, value := over.Content[i], over.Content[i+1]
+
+		if isNull(value) {
+			mapRemove(merged, key.Value)
+			continue
+		}
+
+		idx := mapIndex(merged, key.Value)
+		if idx == -1 {
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+		merged.Content[idx+1] = mergeNodes(merged.Content[idx+1], value)
+	}
+	return merged
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null"
+}
+
+func copyMapping(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = slices.Clone(n.Content)
+	return &c
+}
+
+func mapIndex(m *yaml.Node, key string) int {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mapGet(m *yaml.Node, key string) *yaml.Node {
+	idx := mapIndex(m, key)
+	if idx == -1 {
+		return nil
+	}
+	return m.Content[idx+1]
+}
+
+func mapRemove(m *yaml.Node, key string) *yaml.Node {
+	idx := mapIndex(m, key)
+	if idx == -1 {
+		return nil
+	}
+	value := m.Content[idx+1]
+	m.Content = slices.Delete(m.Content, idx, idx+2)
+	return value
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadComposed(t *testing.T) {
+	cfg, err := Load("testdata/compose/lokl.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	web := cfg.Services["web"]
+	if web.Path != filepath.Join(cfg.Dir, "apps", "web") {
+		t.Errorf("web.path = %q, want path rebased to the including file", web.Path)
+	}
+	if web.Port != 5173 {
+		t.Errorf("web.port = %d, want 5173 from include", web.Port)
+	}
+	if web.Env["API_URL"] != "https://api.test.dev" {
+		t.Errorf("web.env[API_URL] = %q, including file should win", web.Env["API_URL"])
+	}
+	if _, ok := web.Env["THEME"]; ok {
+		t.Error("web.env[THEME] should be removed by null in lokl.local.yaml")
+	}
+	if web.Env["FROM_WEB_ENV"] != "1" {
+		t.Errorf("web.env[FROM_WEB_ENV] = %q, env_file should be rebased", web.Env["FROM_WEB_ENV"])
+	}
+
+	api := cfg.Services["api"]
+	if api.Command != "pnpm dev" || strings.Join(api.Shell, " ") != "bash -lc" {
+		t.Errorf("api should inherit command and shell from template, got %q / %q", api.Command, api.Shell)
+	}
+	if api.Port != 3100 {
+		t.Errorf("api.port = %d, want 3100 from lokl.override.yaml", api.Port)
+	}
+	if api.Env["LOG_LEVEL"] != "trace" || api.Env["NODE_ENV"] != "development" {
+		t.Errorf("api.env = %v, want merged template env with local override", api.Env)
+	}
+
+	worker := cfg.Services["worker"]
+	if worker.Command != "pnpm worker" || worker.Path != filepath.Join(cfg.Dir, "apps", "api") {
+		t.Errorf("worker = %+v, want extends of api with own command", worker)
+	}
+	if worker.Port != 0 {
+		t.Errorf("worker.port = %d, null should remove the inherited port", worker.Port)
+	}
+	// extends is resolved after override files, so worker sees api's final env
+	if worker.Env["LOG_LEVEL"] != "trace" {
+		t.Errorf("worker.env[LOG_LEVEL] = %q, want api's overridden value", worker.Env["LOG_LEVEL"])
+	}
+
+	if _, ok := cfg.Services["node"]; ok {
+		t.Error("templates must not become services")
+	}
+
+	if len(cfg.Files) < 4 {
+		t.Errorf("files = %v, want main, include and override files", cfg.Files)
+	}
+}
+
+func TestLoadComposeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"lokl.yaml": "name: x\ninclude: [a.yaml]\nservices: {s: {command: x}}\n",
+				"a.yaml":    "include: [lokl.yaml]\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "extends cycle",
+			files: map[string]string{
+				"lokl.yaml": "name: x\nservices:\n  a: {extends: b}\n  b: {extends: a}\n",
+			},
+			wantErr: "extends cycle",
+		},
+		{
+			name: "extends unknown",
+			files: map[string]string{
+				"lokl.yaml": "name: x\nservices:\n  a: {extends: nope}\n",
+			},
+			wantErr: `extends unknown service or template "nope"`,
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"lokl.yaml": "name: x\ninclude: missing.yaml\nservices: {s: {command: x}}\n",
+			},
+			wantErr: "reading config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := Load(filepath.Join(dir, "lokl.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergeNodesScalarsAndLists(t *testing.T) {
+	base := mustParse(t, "a: 1\nlist: [x, y]\nnested: {k: v, keep: 1}\n")
+	over := mustParse(t, "a: 2\nlist: [z]\nnested: {k: w}\n")
+
+	var got struct {
+		A      int
+		List   []string
+		Nested map[string]string
+	}
+	if err := mergeNodes(base, over).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.A != 2 {
+		t.Errorf("a = %d, want 2", got.A)
+	}
+	if strings.Join(got.List, ",") != "z" {
+		t.Errorf("list = %v, lists should be replaced", got.List)
+	}
+	if got.Nested["k"] != "w" || got.Nested["keep"] != "1" {
+		t.Errorf("nested = %v, mappings should merge", got.Nested)
+	}
+}
+
+func mustParse(t *testing.T, s string) *yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Content[0]
+}
@@ -2,92 +2,255 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Name     string             `yaml:"name"`
-	Version  string             `yaml:"version"`
-	Proxy    ProxyConfig        `yaml:"proxy"`
-	Env      map[string]string  `yaml:"env"`
-	Services map[string]Service `yaml:"services"`
+	Name      string             `yaml:"name"`
+	Version   string             `yaml:"version,omitempty"`
+	Proxy     ProxyConfig        `yaml:"proxy,omitempty"`
+	Discovery DiscoveryConfig    `yaml:"discovery,omitempty"`
+	Shell     Shell              `yaml:"shell,omitempty"`
+	EnvFrom   string             `yaml:"env_from,omitempty"`
+	EnvFile   StringList         `yaml:"env_file,omitempty"`
+	Env       map[string]string  `yaml:"env,omitempty"`
+	Services  map[string]Service `yaml:"services"`
+
+	// Files lists every file the config was composed from.
+	Files []string `yaml:"-"`
+	// Dir is the absolute directory of the main config file. Service paths,
+	// env files and the state directory are relative to it.
+	Dir string `yaml:"-"`
 }
 
 type ProxyConfig struct {
-	Domain string `yaml:"domain"`
-	HTTPS  *bool  `yaml:"https"` // TODO: not yet implemented, proxy always uses HTTPS
+	Domain string `yaml:"domain,omitempty"`
+	HTTPS  *bool  `yaml:"https,omitempty"`
+	CA     string `yaml:"ca,omitempty"`
+	// HTTPRedirect adds a :80 listener that redirects to HTTPS.
+	HTTPRedirect bool `yaml:"http_redirect,omitempty"`
+	// Listen is the address the proxy binds, as host:port or a bare port.
+	Listen string `yaml:"listen,omitempty"`
+	// PublicPort is the port browsers connect to when a forwarding rule
+	// sends it to Listen. It defaults to the listen port.
+	PublicPort int `yaml:"public_port,omitempty"`
+	// DNS selects how project domains resolve: entries in /etc/hosts (the
+	// default) or the embedded DNS server.
+	DNS string `yaml:"dns,omitempty"`
+	// Shared registers the project's routes with the machine-wide proxy
+	// daemon instead of running a proxy of its own, so several projects
+	// can run at once.
+	Shared bool `yaml:"shared,omitempty"`
+	// RemotePort is the HTTPS port of the remote environment services are
+	// toggled to. It defaults to 443.
+	RemotePort int `yaml:"remote_port,omitempty"`
 }
 
 type Service struct {
-	Command string `yaml:"command"`
-	Image   string `yaml:"image"`
-	Path    string `yaml:"path"`
+	Command string `yaml:"command,omitempty"`
+	Image   string `yaml:"image,omitempty"`
+	Path    string `yaml:"path,omitempty"`
+
+	// Shell overrides the project shell; "none" runs the command as a plain argv.
+	Shell Shell `yaml:"shell,omitempty"`
+	// EnvFrom is a wrapper command (e.g. "direnv exec .") whose environment
+	// is captured and used as the base environment for the service.
+	EnvFrom string `yaml:"env_from,omitempty"`
 
-	Port      int    `yaml:"port"`
-	Subdomain string `yaml:"subdomain"`
+	Port int `yaml:"port,omitempty"`
+	// PortRange is set for "port: auto" or "port: min-max"; the port is
+	// allocated when the service starts.
+	PortRange *PortRange `yaml:"-"`
+	Subdomain string     `yaml:"subdomain,omitempty"`
+	// Hosts are more names the service answers on, as subdomains or full
+	// domains. A leading "*." matches any single label, e.g. *.app for
+	// tenant subdomains.
+	Hosts []string `yaml:"hosts,omitempty"`
+	// Routes mount the service under path prefixes of proxy hosts, in
+	// addition to its subdomain and hosts.
+	Routes []RouteConfig `yaml:"routes,omitempty"`
 
-	Rewrite *RewriteConfig `yaml:"rewrite"`
+	Rewrite *RewriteConfig `yaml:"rewrite,omitempty"`
 
-	Env map[string]string `yaml:"env"`
+	EnvFile StringList        `yaml:"env_file,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
 
-	DependsOn []string `yaml:"depends_on"`
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	Profiles  []string `yaml:"profiles,omitempty"`
 
-	Health *HealthConfig `yaml:"health"`
+	Health *HealthConfig `yaml:"health,omitempty"`
 
-	AutoStart    *bool  `yaml:"autostart"`
-	Restart      string `yaml:"restart"`
-	ReadyTimeout string `yaml:"ready_timeout"`
+	AutoStart    *bool  `yaml:"autostart,omitempty"`
+	Restart      string `yaml:"restart,omitempty"`
+	ReadyTimeout string `yaml:"ready_timeout,omitempty"`
 
-	Volumes []string `yaml:"volumes"`
-	Ports   []string `yaml:"ports"`
+	Volumes []string `yaml:"volumes,omitempty"`
+	Ports   []string `yaml:"ports,omitempty"`
 
-	Limits *LimitsConfig `yaml:"limits"`
+	Limits *LimitsConfig `yaml:"limits,omitempty"`
+
+	// decodeErrors are values of the wrong type found while decoding. They
+	// are kept here rather than failing the decode, which would drop the
+	// whole service from the map.
+	decodeErrors []string
+}
+
+// RouteConfig mounts a service under a path of a host, so several services
+// can share one origin.
+type RouteConfig struct {
+	// Host is a subdomain or full domain, like Subdomain. It defaults to
+	// the service's subdomain.
+	Host       string `yaml:"host,omitempty"`
+	PathPrefix string `yaml:"path_prefix,omitempty"`
+	// StripPrefix removes PathPrefix before the request is forwarded.
+	StripPrefix bool `yaml:"strip_prefix,omitempty"`
 }
 
 type RewriteConfig struct {
-	StripPrefix string `yaml:"strip_prefix"`
-	Fallback    string `yaml:"fallback"`
+	StripPrefix string `yaml:"strip_prefix,omitempty"`
+	Fallback    string `yaml:"fallback,omitempty"`
+	// Rules run in order after StripPrefix and before Fallback.
+	Rules []RewriteRule `yaml:"rules,omitempty"`
+}
+
+// RewriteRule rewrites, redirects or falls back requests whose path
+// matches Match. Exactly one of Rewrite, Redirect and Fallback is set.
+type RewriteRule struct {
+	// Match is a regular expression tested against the path. A fallback
+	// rule without one applies to every path.
+	Match string `yaml:"match,omitempty"`
+	// Rewrite replaces the path, with $1 or ${name} for capture groups.
+	// Later rules see the rewritten path.
+	Rewrite string `yaml:"rewrite,omitempty"`
+	// Redirect sends the client to a path or URL, with capture groups.
+	Redirect string `yaml:"redirect,omitempty"`
+	// Status is the redirect status: 301, 302 (default), 307 or 308.
+	Status int `yaml:"status,omitempty"`
+	// Fallback is the path served instead, as for a single-page app.
+	Fallback string `yaml:"fallback,omitempty"`
+	// Except lists regular expressions for paths the fallback skips. When
+	// empty, common asset paths are skipped.
+	Except []string `yaml:"except,omitempty"`
+	// OnNotFound falls back only when the service answers 404 to a GET
+	// that accepts text/html.
+	OnNotFound bool `yaml:"on_not_found,omitempty"`
 }
 
 type HealthConfig struct {
-	Path     string `yaml:"path"`
-	Interval string `yaml:"interval"`
-	Timeout  string `yaml:"timeout"`
-	Retries  *int   `yaml:"retries"`
+	Path     string `yaml:"path,omitempty"`
+	Interval string `yaml:"interval,omitempty"`
+	Timeout  string `yaml:"timeout,omitempty"`
+	Retries  *int   `yaml:"retries,omitempty"`
 }
 
 type LimitsConfig struct {
-	Memory string `yaml:"memory"`
+	Memory string `yaml:"memory,omitempty"`
 }
 
+// Load reads a config file, merges includes, override files and extends
+// (see loadDocument), applies env files, defaults and service references,
+// and validates the result.
+//
+// Env precedence, lowest to highest: project env_file, project env,
+// service env_file, service env. ${VAR} and ${VAR:-default} are expanded
+// from the host environment before decoding, except in env and service
+// commands, which are expanded after defaults together with
+// ${services.<name>.port|host|url} references. Env file values are literal.
 func Load(path string) (*Config, error) {
-	cfg, err := parse(path)
+	cfg, issues, err := LoadAll(path)
 	if err != nil {
 		return nil, err
 	}
 
-	ApplyDefaults(cfg)
-
-	if err := Validate(cfg); err != nil {
+	if err := issues.Err(); err != nil {
 		return nil, fmt.Errorf("validating config: %w", err)
 	}
 
 	return cfg, nil
 }
 
-func parse(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// LoadAll is like Load but does not fail on validation problems. It returns
+// every error and warning, with file positions, alongside the config.
+// Values of the wrong type, unreadable env files and broken service
+// references are reported as issues too; only files that cannot be read
+// or parsed at all are returned as an error.
+func LoadAll(path string) (*Config, Issues, error) {
+	cfg, doc, issues, err := parse(path)
 	if err != nil {
-		return nil, fmt.Errorf("reading config file: %w", err)
+		return nil, nil, err
 	}
 
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving config directory: %w", err)
+	}
+	cfg.Dir = dir
+
+	issues = append(issues, Resolve(cfg)...)
+	issues = append(issues, ValidateAll(cfg)...)
+	issues = append(issues, doc.lint(cfg)...)
+	doc.locate(issues)
+	issues.sortByPosition()
+
+	return cfg, issues, nil
+}
+
+// Resolve does what Load does after decoding a file: it reads env files,
+// applies defaults, makes service paths absolute relative to cfg.Dir and
+// expands the env and service commands. It is for configs built in code;
+// a loaded config must not be resolved again, or $$ escapes would be
+// unescaped twice.
+func Resolve(cfg *Config) Issues {
+	issues := loadEnvFiles(cfg, cfg.Dir)
+	ApplyDefaults(cfg)
+	anchorPaths(cfg)
+	return append(issues, interpolateValues(cfg, os.Getenv)...)
+}
+
+func parse(path string) (*Config, *document, Issues, error) {
+	doc, err := loadDocument(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Older files are migrated in memory; lokl config migrate rewrites them.
+	doc.version, err = documentVersion(doc.root)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	upgrade(doc.root, doc.version)
+	setVersion(doc.root, CurrentVersion)
+
+	if err := interpolateDocument(doc.root, os.Getenv); err != nil {
+		return nil, nil, nil, fmt.Errorf("interpolating config file: %w", err)
+	}
+
+	// Values of the wrong type are left at their zero value and reported,
+	// so the rest of the config is still checked.
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parsing config file: %w", err)
+	var issues Issues
+	if err := doc.root.Decode(&cfg); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, nil, nil, fmt.Errorf("parsing config file: %w", err)
+		}
+		for _, msg := range typeErr.Errors {
+			issues = append(issues, doc.decodeIssue(msg))
+		}
+	}
+	for name, svc := range cfg.Services {
+		for _, msg := range svc.decodeErrors {
+			issues = append(issues, doc.decodeIssue(msg))
+		}
+		svc.decodeErrors = nil
+		cfg.Services[name] = svc
 	}
+	cfg.Files = doc.files
 
-	return &cfg, nil
+	return &cfg, doc, issues, nil
 }
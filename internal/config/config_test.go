@@ -3,6 +3,8 @@ package config
 import (
 	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoad(t *testing.T) {
@@ -131,6 +133,124 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: "invalid restart policy",
 		},
+		{
+			name: "route without host",
+			cfg: Config{
+				Name:     "test",
+				Proxy:    ProxyConfig{Domain: "test.dev"},
+				Services: map[string]Service{"a": {Command: "x", Port: 3000, Routes: []RouteConfig{{PathPrefix: "/api"}}}},
+			},
+			wantErr: "route 0 needs a host",
+		},
+		{
+			name: "route path prefix without slash",
+			cfg: Config{
+				Name:     "test",
+				Proxy:    ProxyConfig{Domain: "test.dev"},
+				Services: map[string]Service{"a": {Command: "x", Port: 3000, Routes: []RouteConfig{{Host: "app", PathPrefix: "api"}}}},
+			},
+			wantErr: "must start with /",
+		},
+		{
+			name: "two services at one mount",
+			cfg: Config{
+				Name:  "test",
+				Proxy: ProxyConfig{Domain: "test.dev"},
+				Services: map[string]Service{
+					"a": {Command: "x", Port: 3000, Routes: []RouteConfig{{Host: "app", PathPrefix: "/api/"}}},
+					"b": {Command: "x", Port: 3001, Routes: []RouteConfig{{Host: "app.test.dev", PathPrefix: "/api"}}},
+				},
+			},
+			wantErr: `services "a" and "b" are both served at app.test.dev/api`,
+		},
+		{
+			name: "wildcard not a whole label",
+			cfg: Config{
+				Name:     "test",
+				Proxy:    ProxyConfig{Domain: "test.dev"},
+				Services: map[string]Service{"a": {Command: "x", Port: 3000, Hosts: []string{"tenant-*.app"}}},
+			},
+			wantErr: `invalid host "tenant-*.app"`,
+		},
+		{
+			name: "hosts without port",
+			cfg: Config{
+				Name:     "test",
+				Proxy:    ProxyConfig{Domain: "test.dev"},
+				Services: map[string]Service{"a": {Command: "x", Hosts: []string{"www"}}},
+			},
+			wantErr: "port is required when hosts are set",
+		},
+		{
+			name: "host served twice",
+			cfg: Config{
+				Name:  "test",
+				Proxy: ProxyConfig{Domain: "test.dev"},
+				Services: map[string]Service{
+					"a": {Command: "x", Port: 3000, Hosts: []string{"*.app"}},
+					"b": {Command: "x", Port: 3001, Hosts: []string{"*.app.test.dev"}},
+				},
+			},
+			wantErr: `services "a" and "b" are both served at *.app.test.dev`,
+		},
+		{
+			name: "rewrite rule without action",
+			cfg: Config{
+				Name:     "test",
+				Services: map[string]Service{"a": {Command: "x", Rewrite: &RewriteConfig{Rules: []RewriteRule{{Match: "^/a"}}}}},
+			},
+			wantErr: "rewrite rule 0 needs exactly one of rewrite, redirect and fallback",
+		},
+		{
+			name: "rewrite rule without match",
+			cfg: Config{
+				Name:     "test",
+				Services: map[string]Service{"a": {Command: "x", Rewrite: &RewriteConfig{Rules: []RewriteRule{{Rewrite: "/b"}}}}},
+			},
+			wantErr: "rewrite rule 0 needs match",
+		},
+		{
+			name: "invalid rewrite pattern",
+			cfg: Config{
+				Name:     "test",
+				Services: map[string]Service{"a": {Command: "x", Rewrite: &RewriteConfig{Rules: []RewriteRule{{Fallback: "/index.html", Except: []string{"(["}}}}}},
+			},
+			wantErr: "invalid except pattern",
+		},
+		{
+			name: "invalid redirect status",
+			cfg: Config{
+				Name:     "test",
+				Services: map[string]Service{"a": {Command: "x", Rewrite: &RewriteConfig{Rules: []RewriteRule{{Match: "^/a", Redirect: "/b", Status: 200}}}}},
+			},
+			wantErr: "invalid redirect status 200",
+		},
+		{
+			name: "on_not_found without fallback",
+			cfg: Config{
+				Name:     "test",
+				Services: map[string]Service{"a": {Command: "x", Rewrite: &RewriteConfig{Rules: []RewriteRule{{Match: "^/a", Rewrite: "/b", OnNotFound: true}}}}},
+			},
+			wantErr: "except and on_not_found only apply to fallback rules",
+		},
+		{
+			name: "invalid proxy listen",
+			cfg: Config{
+				Name:     "test",
+				Proxy:    ProxyConfig{Listen: "localhost"},
+				Services: map[string]Service{"a": {Command: "x"}},
+			},
+			wantErr: "invalid proxy.listen",
+		},
+		{
+			name: "invalid proxy ca",
+			cfg: Config{
+				Name:     "test",
+				Proxy:    ProxyConfig{CA: "letsencrypt"},
+				Services: map[string]Service{"a": {Command: "x"}},
+			},
+			wantErr: "invalid proxy.ca",
+		},
 		{
 			name: "invalid health interval",
 			cfg: Config{
@@ -139,6 +259,14 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: "invalid health.interval",
 		},
+		{
+			name: "invalid port range",
+			cfg: Config{
+				Name:     "test",
+				Services: map[string]Service{"a": {Command: "x", PortRange: &PortRange{Min: 5000, Max: 4000}}},
+			},
+			wantErr: "invalid port range",
+		},
 		{
 			name: "duplicate ports",
 			cfg: Config{
@@ -193,6 +321,9 @@ func TestApplyDefaults(t *testing.T) {
 	if cfg.Proxy.HTTPS == nil || !*cfg.Proxy.HTTPS {
 		t.Error("proxy.https should default to true")
 	}
+	if cfg.Proxy.DNS != DNSHosts {
+		t.Errorf("proxy.dns = %q, want %q", cfg.Proxy.DNS, DNSHosts)
+	}
 
 	svcA := cfg.Services["a"]
 	if svcA.AutoStart == nil || !*svcA.AutoStart {
@@ -213,3 +344,408 @@ func TestApplyDefaults(t *testing.T) {
 		t.Error("health.retries should default to 3")
 	}
 }
+
+func TestApplyDefaultsShell(t *testing.T) {
+	cfg := &Config{
+		Shell:   Shell{"bash", "-lc"},
+		EnvFrom: "direnv exec .",
+		Services: map[string]Service{
+			"a": {Command: "x"},
+			"b": {Command: "y", Shell: Shell{"none"}, EnvFrom: "nix develop -c"},
+		},
+	}
+
+	ApplyDefaults(cfg)
+
+	if got := cfg.Services["a"].Shell; len(got) != 2 || got[0] != "bash" {
+		t.Errorf("a.shell = %q, want project shell", got)
+	}
+	if got := cfg.Services["a"].EnvFrom; got != "direnv exec ." {
+		t.Errorf("a.env_from = %q, want project env_from", got)
+	}
+	if !cfg.Services["b"].Shell.IsNone() {
+		t.Errorf("b.shell = %q, want none", cfg.Services["b"].Shell)
+	}
+	if got := cfg.Services["b"].EnvFrom; got != "nix develop -c" {
+		t.Errorf("b.env_from = %q, want service override", got)
+	}
+
+	bare := &Config{Services: map[string]Service{"a": {Command: "x"}}}
+	ApplyDefaults(bare)
+	if got := bare.Services["a"].Shell; len(got) != 2 || got[0] != "sh" {
+		t.Errorf("default shell = %q, want sh -c", got)
+	}
+}
+
+func TestShellUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{"string", `shell: bash -lc`, []string{"bash", "-lc"}},
+		{"list", `shell: [zsh, -ic]`, []string{"zsh", "-ic"}},
+		{"none", `shell: none`, []string{"none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var svc Service
+			if err := yaml.Unmarshal([]byte(tt.yaml), &svc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(svc.Shell, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("shell = %q, want %q", svc.Shell, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"pnpm dev", []string{"pnpm", "dev"}, false},
+		{`go run ./cmd --name "a b"`, []string{"go", "run", "./cmd", "--name", "a b"}, false},
+		{`echo 'it''s'`, []string{"echo", "its"}, false},
+		{`a\ b c`, []string{"a b", "c"}, false},
+		{`""`, []string{""}, false},
+		{`"open`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := SplitArgs(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("SplitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvAndReferences(t *testing.T) {
+	cfg, err := Load("testdata/env.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	api := cfg.Services["api"]
+	if api.Port != 3000 {
+		t.Errorf("api.port = %d, want 3000 from default", api.Port)
+	}
+	if api.Command != "node server.js --port 3000" {
+		t.Errorf("api.command = %q", api.Command)
+	}
+
+	wantAPI := map[string]string{
+		"NODE_ENV":  "development",
+		"SHARED":    "from-api",
+		"LOG_LEVEL": "debug",
+		"SECRET":    "line1\nline2",
+		"LITERAL":   "${not_expanded}",
+		"REF":       "${services.db.port}",
+		"PRICE":     "$$5",
+	}
+	for k, want := range wantAPI {
+		if got := api.Env[k]; got != want {
+			t.Errorf("api.env[%s] = %q, want %q", k, got, want)
+		}
+	}
+
+	web := cfg.Services["web"]
+	wantWeb := map[string]string{
+		"API_URL":      "https://api.test.dev",
+		"API_HOST":     "api.test.dev",
+		"DATABASE_URL": "postgres://localhost:5432/app",
+		"SHARED":       "from-shared",
+		"LOG_LEVEL":    "info",
+		"PRICE":        "$5",
+		"ESCAPED_REF":  "${services.api.port}",
+		"DOLLARS":      "$$",
+		// project env values are unescaped once, like the service's own
+		"PROJECT_PRICE": "$5",
+	}
+	for k, want := range wantWeb {
+		if got := web.Env[k]; got != want {
+			t.Errorf("web.env[%s] = %q, want %q", k, got, want)
+		}
+	}
+	if got := cfg.Env["PROJECT_PRICE"]; got != "$5" {
+		t.Errorf("env[PROJECT_PRICE] = %q, want %q", got, "$5")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"HOST": "localhost", "EMPTY": ""}
+	resolve := func(name string) (string, bool, error) {
+		return vars[name], true, nil
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"http://${HOST}:3000", "http://localhost:3000", false},
+		{"${MISSING}", "", false},
+		{"${MISSING:-fallback}", "fallback", false},
+		{"${EMPTY:-fallback}", "fallback", false},
+		{"${HOST:-fallback}", "localhost", false},
+		{"$$HOST and $HOME", "$HOST and $HOME", false},
+		{"${HOST", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expand(tt.in, resolve)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceRefErrors(t *testing.T) {
+	cfg := &Config{
+		Services: map[string]Service{
+			"a": {Command: "x", Env: map[string]string{"B": "${services.b.port}"}},
+		},
+	}
+
+	issues := interpolateValues(cfg, func(string) string { return "" })
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, `unknown service "b"`) {
+		t.Errorf("issues = %v, want unknown service", issues)
+	}
+	if got := cfg.Services["a"].Env["B"]; got != "${services.b.port}" {
+		t.Errorf("env B = %q, want it left unexpanded", got)
+	}
+}
+
+func TestServicePortUnmarshal(t *testing.T) {
+	tests := []struct {
+		name      string
+		yaml      string
+		wantPort  int
+		wantRange *PortRange
+		wantErr   bool
+	}{
+		{"fixed", "port: 3000", 3000, nil, false},
+		{"auto", "port: auto", 0, &PortRange{}, false},
+		{"range", "port: 4000-4100", 0, &PortRange{Min: 4000, Max: 4100}, false},
+		{"invalid", "port: lots", 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var svc Service
+			err := yaml.Unmarshal([]byte("command: x\n"+tt.yaml), &svc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (len(svc.decodeErrors) > 0) != tt.wantErr {
+				t.Errorf("decode errors = %v, want error: %v", svc.decodeErrors, tt.wantErr)
+			}
+			if svc.Command != "x" {
+				t.Errorf("command = %q, want %q", svc.Command, "x")
+			}
+			if svc.Port != tt.wantPort {
+				t.Errorf("port = %d, want %d", svc.Port, tt.wantPort)
+			}
+			if (svc.PortRange == nil) != (tt.wantRange == nil) ||
+				(svc.PortRange != nil && *svc.PortRange != *tt.wantRange) {
+				t.Errorf("port range = %v, want %v", svc.PortRange, tt.wantRange)
+			}
+		})
+	}
+}
+
+func TestInterpolateValues(t *testing.T) {
+	lookup := func(name string) string {
+		return map[string]string{"HOST": "localhost", "COST": "$5"}[name]
+	}
+
+	tests := []struct {
+		name      string
+		value     string
+		portRange *PortRange
+		want      string
+		// wantBound is the value after WithPort(4123), for dynamic ports.
+		wantBound string
+	}{
+		{name: "variable", value: "http://${HOST}", want: "http://localhost"},
+		{name: "service ref", value: "${services.db.port}", want: "5432"},
+		{name: "self port", value: "${self.port}", want: "3000"},
+		{name: "escaped dollar", value: "$$5", want: "$5"},
+		{name: "escaped escape", value: "$$$$", want: "$$"},
+		{name: "escaped variable", value: "$${HOST}", want: "${HOST}"},
+		{name: "escaped service ref", value: "$${services.db.port}", want: "${services.db.port}"},
+		{name: "escaped self port", value: "$${self.port}", want: "${self.port}"},
+		{name: "variable with dollar", value: "${COST}", want: "$5"},
+		{
+			name: "dynamic self port", value: "$${HOST} ${HOST}:${self.port}", portRange: &PortRange{},
+			want: "$${HOST} localhost:${self.port}", wantBound: "${HOST} localhost:4123",
+		},
+		{
+			name: "dynamic escaped self port", value: "$${self.port} ${self.port} ${COST}", portRange: &PortRange{},
+			want: "$${self.port} ${self.port} $$5", wantBound: "${self.port} 4123 $5",
+		},
+		{name: "dynamic without self port", value: "$${HOST}", portRange: &PortRange{}, want: "${HOST}", wantBound: "${HOST}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := 3000
+			if tt.portRange != nil {
+				port = 0
+			}
+			cfg := &Config{
+				Services: map[string]Service{
+					"api": {Command: tt.value, Port: port, PortRange: tt.portRange, Env: map[string]string{"V": tt.value}},
+					"db":  {Command: "postgres", Port: 5432},
+				},
+			}
+
+			if issues := interpolateValues(cfg, lookup); len(issues) > 0 {
+				t.Fatalf("unexpected issues: %v", issues)
+			}
+			api := cfg.Services["api"]
+			if api.Command != tt.want || api.Env["V"] != tt.want {
+				t.Errorf("command = %q, env = %q, want %q", api.Command, api.Env["V"], tt.want)
+			}
+
+			if tt.portRange == nil {
+				return
+			}
+			bound := api.WithPort(4123)
+			if bound.Command != tt.wantBound || bound.Env["V"] != tt.wantBound {
+				t.Errorf("bound command = %q, env = %q, want %q", bound.Command, bound.Env["V"], tt.wantBound)
+			}
+		})
+	}
+}
+
+func TestServiceWithPort(t *testing.T) {
+	svc := Service{
+		Command:   "vite --port ${self.port}",
+		PortRange: &PortRange{},
+		Env:       map[string]string{"ORIGIN": "http://localhost:${self.port}"},
+	}
+
+	got := svc.WithPort(4123)
+
+	if got.Port != 4123 {
+		t.Errorf("port = %d, want 4123", got.Port)
+	}
+	if got.Command != "vite --port 4123" {
+		t.Errorf("command = %q", got.Command)
+	}
+	if got.Env["PORT"] != "4123" {
+		t.Errorf("env[PORT] = %q, want 4123", got.Env["PORT"])
+	}
+	if got.Env["ORIGIN"] != "http://localhost:4123" {
+		t.Errorf("env[ORIGIN] = %q", got.Env["ORIGIN"])
+	}
+	if svc.Env["ORIGIN"] != "http://localhost:${self.port}" {
+		t.Error("WithPort must not modify the original env")
+	}
+}
+
+func TestLoadAllCollectsLoadErrors(t *testing.T) {
+	_, issues, err := LoadAll("testdata/load_errors.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`testdata/load_errors.yaml:3:3: error: expected a string or a list of strings`,
+		`testdata/load_errors.yaml:7:5: error: service "api": command: reference to unknown service "db"`,
+		`testdata/load_errors.yaml:8:5: error: invalid port "lots"`,
+		`testdata/load_errors.yaml:12:5: error: service "web": reading env file`,
+		`testdata/load_errors.yaml:13:5: error: invalid shell "bash -c 'unterminated"`,
+	}
+
+	errs := issues.Errors()
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want %d", errs, len(want))
+	}
+	for i, issue := range errs {
+		if !strings.HasPrefix(issue.String(), want[i]) {
+			t.Errorf("error %d = %s, want prefix %s", i, issue, want[i])
+		}
+	}
+}
+
+func TestLoadAllIssues(t *testing.T) {
+	_, issues, err := LoadAll("testdata/issues.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`testdata/issues.yaml:7:5: error: service "api": invalid restart policy "sometimes" (must be always, on-failure, or never)`,
+		`testdata/issues.yaml:7:5: warning: service "api": restart policies are not supported yet; exited services are not restarted`,
+		`testdata/issues.yaml:8:5: warning: service "api": dependency "worker" has autostart disabled and will not start with a plain lokl up`,
+		`testdata/issues.yaml:13:5: error: services "api" and "web" both use port 3000`,
+		`testdata/issues.yaml:14:5: error: service "web": invalid ready_timeout "soon": time: invalid duration "soon"`,
+		`testdata/issues.yaml:14:5: warning: service "web": ready_timeout is not supported yet and has no effect`,
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("issues =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if n := len(issues.Errors()); n != 3 {
+		t.Errorf("errors = %d, want 3", n)
+	}
+
+	if _, err := Load("testdata/issues.yaml"); err == nil {
+		t.Error("Load: expected error, got nil")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+
+	props := schema["properties"].(map[string]any)
+	for _, key := range []string{"name", "proxy", "services", "include", "templates", "env_file"} {
+		if _, ok := props[key]; !ok {
+			t.Errorf("schema missing top-level property %q", key)
+		}
+	}
+
+	services := props["services"].(map[string]any)
+	service := services["additionalProperties"].(map[string]any)
+	serviceProps := service["properties"].(map[string]any)
+	for _, key := range []string{"command", "port", "restart", "extends", "health", "depends_on"} {
+		if _, ok := serviceProps[key]; !ok {
+			t.Errorf("schema missing service property %q", key)
+		}
+	}
+	if _, ok := serviceProps["PortRange"]; ok {
+		t.Error("schema should not include yaml:\"-\" fields")
+	}
+}
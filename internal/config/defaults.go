@@ -13,11 +13,32 @@ const (
 	defaultHealthRetries  = 3
 )
 
+// Certificate authorities the proxy can issue certificates from.
+const (
+	CALokl   = "lokl"
+	CAMkcert = "mkcert"
+)
+
+// How project domains resolve to the proxy.
+const (
+	DNSServer = "server"
+	DNSHosts  = "hosts"
+)
+
+// DefaultShell is used when neither the project nor the service sets a shell.
+var DefaultShell = Shell{"sh", "-c"}
+
 func ApplyDefaults(cfg *Config) {
 	if cfg.Proxy.HTTPS == nil {
 		t := true
 		cfg.Proxy.HTTPS = &t
 	}
+	if cfg.Proxy.CA == "" {
+		cfg.Proxy.CA = CALokl
+	}
+	if cfg.Proxy.DNS == "" {
+		cfg.Proxy.DNS = DNSHosts
+	}
 
 	for name, svc := range cfg.Services {
 		if svc.AutoStart == nil {
@@ -29,6 +50,17 @@ func ApplyDefaults(cfg *Config) {
 			svc.Restart = defaultRestartPolicy
 		}
 
+		if len(svc.Shell) == 0 {
+			svc.Shell = cfg.Shell
+		}
+		if len(svc.Shell) == 0 {
+			svc.Shell = DefaultShell
+		}
+
+		if svc.EnvFrom == "" {
+			svc.EnvFrom = cfg.EnvFrom
+		}
+
 		if svc.Health != nil {
 			applyHealthDefaults(svc.Health)
 		}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 )
 
@@ -60,3 +61,66 @@ func SortByDependency(services map[string]Service) ([]string, error) {
 
 	return result, nil
 }
+
+// SelectServices returns the services to start, in dependency order.
+//
+// With no names or profiles, every autostart service is selected. Otherwise
+// the named services and the members of the given profiles are selected
+// (regardless of autostart), together with their transitive dependencies.
+func SelectServices(services map[string]Service, names, profiles []string) ([]string, error) {
+	order, err := SortByDependency(services)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 && len(profiles) == 0 {
+		var result []string
+		for _, name := range order {
+			if svc := services[name]; svc.AutoStart == nil || *svc.AutoStart {
+				result = append(result, name)
+			}
+		}
+		return result, nil
+	}
+
+	selected := make(map[string]bool)
+
+	var include func(name string)
+	include = func(name string) {
+		if selected[name] {
+			return
+		}
+		selected[name] = true
+		for _, dep := range services[name].DependsOn {
+			include(dep)
+		}
+	}
+
+	for _, name := range names {
+		if _, exists := services[name]; !exists {
+			return nil, fmt.Errorf("unknown service %q", name)
+		}
+		include(name)
+	}
+
+	for _, profile := range profiles {
+		found := false
+		for _, name := range order {
+			if slices.Contains(services[name].Profiles, profile) {
+				include(name)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no services in profile %q", profile)
+		}
+	}
+
+	var result []string
+	for _, name := range order {
+		if selected[name] {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
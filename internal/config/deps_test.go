@@ -92,3 +92,76 @@ func indexOf(slice []string, item string) int {
 	}
 	return -1
 }
+
+func TestSelectServices(t *testing.T) {
+	f := false
+	services := map[string]Service{
+		"db":        {Command: "x", Profiles: []string{"backend"}},
+		"api":       {Command: "x", DependsOn: []string{"db"}, Profiles: []string{"backend"}},
+		"web":       {Command: "x", Profiles: []string{"frontend"}},
+		"admin":     {Command: "x", DependsOn: []string{"api"}, Profiles: []string{"frontend"}},
+		"storybook": {Command: "x", AutoStart: &f, Profiles: []string{"frontend"}},
+	}
+
+	tests := []struct {
+		name     string
+		names    []string
+		profiles []string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name: "default autostart",
+			want: []string{"db", "web", "api", "admin"},
+		},
+		{
+			name:  "named with transitive deps",
+			names: []string{"admin"},
+			want:  []string{"db", "api", "admin"},
+		},
+		{
+			name:  "named ignores autostart",
+			names: []string{"storybook"},
+			want:  []string{"storybook"},
+		},
+		{
+			name:     "profile",
+			profiles: []string{"backend"},
+			want:     []string{"db", "api"},
+		},
+		{
+			name:     "names and profiles combined",
+			names:    []string{"web"},
+			profiles: []string{"backend"},
+			want:     []string{"db", "web", "api"},
+		},
+		{
+			name:    "unknown service",
+			names:   []string{"nope"},
+			wantErr: `unknown service "nope"`,
+		},
+		{
+			name:     "unknown profile",
+			profiles: []string{"nope"},
+			wantErr:  `no services in profile "nope"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SelectServices(services, tt.names, tt.profiles)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SelectServices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// Diff describes how services changed between two loaded configs.
+type Diff struct {
+	Added   []string
+	Removed []string
+	// Changed lists the services present in both configs that need a
+	// restart: their own config changed, they receive different discovery
+	// variables, or a service they depend on moved.
+	Changed []string
+	// Moved lists services present in both configs whose address (URL,
+	// host or port) changed. Services that depend on them are Changed, as
+	// they are when a service is toggled at runtime; other services keep
+	// the address they started with.
+	Moved []string
+	// Proxy reports a change to the proxy settings. The proxy is reloaded,
+	// but only services whose address changed affect others.
+	Proxy bool
+	// Discovery reports a change to the discovery settings, which changes
+	// the env of every service; all services present in both configs are
+	// then Changed.
+	Discovery bool
+}
+
+// IsEmpty reports whether the configs are equivalent.
+func (d Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.Moved) == 0 && !d.Proxy && !d.Discovery
+}
+
+// Compare returns the per-service differences between two effective configs.
+// Both configs are expected to have defaults applied.
+func Compare(old, updated *Config) Diff {
+	var d Diff
+
+	d.Proxy = !reflect.DeepEqual(old.Proxy, updated.Proxy)
+	d.Discovery = !reflect.DeepEqual(old.Discovery, updated.Discovery)
+
+	// Addresses are compared with every route local; toggle state is not
+	// part of the config.
+	oldEndpoints := old.Endpoints(nil)
+	newEndpoints := updated.Endpoints(nil)
+	for name := range updated.Services {
+		if _, exists := old.Services[name]; exists && oldEndpoints[name] != newEndpoints[name] {
+			d.Moved = append(d.Moved, name)
+		}
+	}
+	discovery := updated.Discovery.Enabled == nil || *updated.Discovery.Enabled
+
+	for name, svc := range updated.Services {
+		prev, exists := old.Services[name]
+		switch {
+		case !exists:
+			d.Added = append(d.Added, name)
+		case d.Discovery || !reflect.DeepEqual(prev, svc):
+			d.Changed = append(d.Changed, name)
+		case discovery && slices.ContainsFunc(svc.DependsOn, func(dep string) bool {
+			return slices.Contains(d.Moved, dep)
+		}):
+			d.Changed = append(d.Changed, name)
+		}
+	}
+
+	for name := range old.Services {
+		if _, exists := updated.Services[name]; !exists {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	sort.Strings(d.Moved)
+	return d
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Proxy: ProxyConfig{Domain: "test.dev"},
+			Services: map[string]Service{
+				"api":    {Command: "x", Port: 3000, Subdomain: "api", Env: map[string]string{"A": "1"}},
+				"web":    {Command: "y", Port: 5173, DependsOn: []string{"api"}},
+				"worker": {Command: "z"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		// setup changes both configs, update only the new one.
+		setup       func(*Config)
+		update      func(*Config)
+		wantAdded   string
+		wantRemoved string
+		wantChanged string
+		wantMoved   string
+		wantProxy   bool
+		wantDisc    bool
+	}{
+		{
+			name:   "identical",
+			update: func(*Config) {},
+		},
+		{
+			name: "env change",
+			update: func(c *Config) {
+				c.Services["api"] = Service{Command: "x", Port: 3000, Subdomain: "api", Env: map[string]string{"A": "2"}}
+			},
+			wantChanged: "api",
+		},
+		{
+			name: "port change restarts dependents",
+			update: func(c *Config) {
+				c.Services["api"] = Service{Command: "x", Port: 3001, Subdomain: "api", Env: map[string]string{"A": "1"}}
+			},
+			wantChanged: "api,web",
+			wantMoved:   "api",
+		},
+		{
+			name: "added service restarts nothing",
+			update: func(c *Config) {
+				c.Services["db"] = Service{Command: "postgres", Port: 5432}
+			},
+			wantAdded: "db",
+		},
+		{
+			name: "proxy change without address change",
+			update: func(c *Config) {
+				c.Proxy.CA = CAMkcert
+			},
+			wantProxy: true,
+		},
+		{
+			name: "proxy port moves services with a domain",
+			update: func(c *Config) {
+				c.Proxy.Listen = "8443"
+			},
+			wantChanged: "web",
+			wantMoved:   "api",
+			wantProxy:   true,
+		},
+		{
+			name: "moved service without discovery",
+			setup: func(c *Config) {
+				c.Discovery.Enabled = new(bool)
+			},
+			update: func(c *Config) {
+				c.Services["api"] = Service{Command: "x", Port: 3001, Subdomain: "api", Env: map[string]string{"A": "1"}}
+			},
+			wantChanged: "api",
+			wantMoved:   "api",
+		},
+		{
+			name: "added and removed",
+			update: func(c *Config) {
+				delete(c.Services, "worker")
+				c.Services["db"] = Service{Command: "postgres"}
+			},
+			wantAdded:   "db",
+			wantRemoved: "worker",
+		},
+		{
+			name: "global change",
+			update: func(c *Config) {
+				c.Discovery.Templates = map[string]string{"X_{{.Name}}": "{{.URL}}"}
+			},
+			wantChanged: "api,web,worker",
+			wantDisc:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, updated := newConfig(), newConfig()
+			if tt.setup != nil {
+				tt.setup(old)
+				tt.setup(updated)
+			}
+			tt.update(updated)
+
+			d := Compare(old, updated)
+			if got := strings.Join(d.Added, ","); got != tt.wantAdded {
+				t.Errorf("Added = %q, want %q", got, tt.wantAdded)
+			}
+			if got := strings.Join(d.Removed, ","); got != tt.wantRemoved {
+				t.Errorf("Removed = %q, want %q", got, tt.wantRemoved)
+			}
+			if got := strings.Join(d.Changed, ","); got != tt.wantChanged {
+				t.Errorf("Changed = %q, want %q", got, tt.wantChanged)
+			}
+			if got := strings.Join(d.Moved, ","); got != tt.wantMoved {
+				t.Errorf("Moved = %q, want %q", got, tt.wantMoved)
+			}
+			if d.Proxy != tt.wantProxy || d.Discovery != tt.wantDisc {
+				t.Errorf("Proxy, Discovery = %v, %v, want %v, %v", d.Proxy, d.Discovery, tt.wantProxy, tt.wantDisc)
+			}
+		})
+	}
+}
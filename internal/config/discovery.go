@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const discoveryPrefix = "LOKL_"
+
+// DiscoveryConfig controls the LOKL_<SERVICE>_* variables injected into
+// every service.
+type DiscoveryConfig struct {
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// Templates maps env name templates to value templates, rendered once per
+	// service, e.g. "VITE_{{.Name}}_URL": "{{.URL}}".
+	Templates map[string]string `yaml:"templates,omitempty"`
+}
+
+// Endpoint describes how to reach a service from another service.
+type Endpoint struct {
+	// Name is the service name as an env-safe identifier (web-app -> WEB_APP).
+	Name string
+	URL  string
+	Host string
+	Port int
+}
+
+// Endpoints returns the address of every service that has a port or domain.
+// isRemote reports whether a service is currently routed to the remote host,
+// which is reached on proxy.remote_port. Dynamic ports that have not been
+// allocated yet are skipped.
+func (c *Config) Endpoints(isRemote func(service string) bool) map[string]Endpoint {
+	endpoints := make(map[string]Endpoint)
+
+	for name, svc := range c.Services {
+		rt, _ := c.primaryRoute(svc)
+		domain, prefix := rt.Host, rt.PathPrefix
+		if domain == "" && svc.Port == 0 {
+			continue
+		}
+		if svc.PortRange != nil && svc.Port == 0 {
+			continue
+		}
+
+		ep := Endpoint{
+			Name: EnvName(name),
+			Host: "localhost",
+			Port: svc.Port,
+		}
+
+		switch {
+		case domain != "" && isRemote != nil && isRemote(name):
+			ep.Host = domain
+			ep.Port = c.Proxy.RemoteHTTPSPort()
+			ep.URL = "https://" + c.Proxy.RemoteAddr(domain) + prefix
+		case domain != "":
+			ep.URL = c.ProxyURL(domain) + prefix
+		default:
+			ep.URL = fmt.Sprintf("http://localhost:%d", svc.Port)
+		}
+
+		endpoints[name] = ep
+	}
+
+	return endpoints
+}
+
+// DiscoveryEnv returns the LOKL_<SERVICE>_URL, _HOST and _PORT variables for
+// every service plus any configured templates.
+func (c *Config) DiscoveryEnv(isRemote func(service string) bool) (map[string]string, error) {
+	if c.Discovery.Enabled != nil && !*c.Discovery.Enabled {
+		return nil, nil
+	}
+
+	env := make(map[string]string)
+	for _, ep := range c.Endpoints(isRemote) {
+		prefix := discoveryPrefix + ep.Name
+		env[prefix+"_URL"] = ep.URL
+		env[prefix+"_HOST"] = ep.Host
+		env[prefix+"_PORT"] = strconv.Itoa(ep.Port)
+
+		for keyTmpl, valueTmpl := range c.Discovery.Templates {
+			key, err := renderTemplate(keyTmpl, ep)
+			if err != nil {
+				return nil, err
+			}
+			value, err := renderTemplate(valueTmpl, ep)
+			if err != nil {
+				return nil, err
+			}
+			env[key] = value
+		}
+	}
+
+	return env, nil
+}
+
+// EnvName converts a service name to an env-safe upper-case identifier.
+func EnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func renderTemplate(text string, ep Endpoint) (string, error) {
+	tmpl, err := template.New("discovery").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing discovery template %q: %w", text, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ep); err != nil {
+		return "", fmt.Errorf("rendering discovery template %q: %w", text, err)
+	}
+	return buf.String(), nil
+}
+
+func validateDiscovery(d DiscoveryConfig) error {
+	for key, value := range d.Templates {
+		for _, text := range []string{key, value} {
+			if _, err := renderTemplate(text, Endpoint{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
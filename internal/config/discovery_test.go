@@ -0,0 +1,125 @@
+package config
+
+import "testing"
+
+func TestDiscoveryEnv(t *testing.T) {
+	cfg := &Config{
+		Proxy: ProxyConfig{Domain: "test.dev"},
+		Discovery: DiscoveryConfig{
+			Templates: map[string]string{
+				"VITE_{{.Name}}_URL": "{{.URL}}",
+			},
+		},
+		Services: map[string]Service{
+			"api":     {Command: "x", Port: 3000, Subdomain: "api"},
+			"web-app": {Command: "x", Port: 5173, Subdomain: "app"},
+			"db":      {Command: "x", Port: 5432},
+			"worker":  {Command: "x"},
+		},
+	}
+
+	remote := func(service string) bool { return service == "web-app" }
+
+	env, err := cfg.DiscoveryEnv(remote)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"LOKL_API_URL":      "https://api.test.dev",
+		"LOKL_API_HOST":     "localhost",
+		"LOKL_API_PORT":     "3000",
+		"LOKL_WEB_APP_URL":  "https://app.test.dev",
+		"LOKL_WEB_APP_HOST": "app.test.dev",
+		"LOKL_WEB_APP_PORT": "443",
+		"LOKL_DB_URL":       "http://localhost:5432",
+		"LOKL_DB_PORT":      "5432",
+		"VITE_API_URL":      "https://api.test.dev",
+		"VITE_DB_URL":       "http://localhost:5432",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("env[%s] = %q, want %q", k, env[k], v)
+		}
+	}
+
+	if _, ok := env["LOKL_WORKER_URL"]; ok {
+		t.Error("service without port or domain should not be discovered")
+	}
+
+	cfg.Proxy.RemotePort = 8443
+	env, err = cfg.DiscoveryEnv(remote)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env["LOKL_WEB_APP_URL"] != "https://app.test.dev:8443" || env["LOKL_WEB_APP_PORT"] != "8443" {
+		t.Errorf("remote_port 8443: URL = %q, PORT = %q", env["LOKL_WEB_APP_URL"], env["LOKL_WEB_APP_PORT"])
+	}
+}
+
+func TestDiscoveryDisabled(t *testing.T) {
+	f := false
+	cfg := &Config{
+		Discovery: DiscoveryConfig{Enabled: &f},
+		Services:  map[string]Service{"api": {Command: "x", Port: 3000}},
+	}
+
+	env, err := cfg.DiscoveryEnv(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(env) != 0 {
+		t.Errorf("env = %v, want empty", env)
+	}
+}
+
+func TestValidateDiscoveryTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    map[string]string
+		wantErr bool
+	}{
+		{"valid", map[string]string{"X_{{.Name}}": "{{.Host}}:{{.Port}}"}, false},
+		{"syntax error", map[string]string{"X_{{.Name": "{{.URL}}"}, true},
+		{"unknown field", map[string]string{"X": "{{.Missing}}"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDiscovery(DiscoveryConfig{Templates: tt.tmpl})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDiscovery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"api":        "API",
+		"web-app":    "WEB_APP",
+		"svc.v2":     "SVC_V2",
+		"Admin_Tool": "ADMIN_TOOL",
+	}
+	for in, want := range tests {
+		if got := EnvName(in); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDiscoveryPlainHTTP(t *testing.T) {
+	f := false
+	cfg := &Config{
+		Proxy:    ProxyConfig{Domain: "test.dev", HTTPS: &f},
+		Services: map[string]Service{"api": {Command: "x", Port: 3000, Subdomain: "api"}},
+	}
+
+	env, err := cfg.DiscoveryEnv(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := env["LOKL_API_URL"]; got != "http://api.test.dev" {
+		t.Errorf("LOKL_API_URL = %q, want %q", got, "http://api.test.dev")
+	}
+}
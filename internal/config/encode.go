@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats for Marshal.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// FormatFor returns the output format for a config file path, based on its
+// extension.
+func FormatFor(path string) string {
+	if filepath.Ext(path) == extJSON {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// Marshal encodes cfg as a config file in the given format.
+func Marshal(cfg *Config, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+	data := buf.Bytes()
+
+	switch format {
+	case FormatYAML:
+		return data, nil
+	case FormatJSON:
+		// Go through the YAML encoding so field names and custom marshalers
+		// (port ranges, shells) match the YAML form.
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("encoding config: %w", err)
+		}
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encoding config: %w", err)
+		}
+		return append(out, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (must be %s or %s)", format, FormatYAML, FormatJSON)
+	}
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StringList accepts either a single string or a list of strings in YAML.
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*l = StringList{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var items []string
+		if err := node.Decode(&items); err != nil {
+			return err
+		}
+		*l = items
+		return nil
+	default:
+		return typeErrorf(node, "expected a string or a list of strings")
+	}
+}
+
+// loadEnvFiles reads env_file entries into Env, relative to baseDir.
+// Files are applied in order, later files overriding earlier ones, and
+// explicit env values override anything read from files. Values from files
+// are taken literally: they are escaped so interpolateValues leaves them
+// as written. Files that cannot be read are reported as issues and skipped.
+func loadEnvFiles(cfg *Config, baseDir string) Issues {
+	var issues Issues
+
+	env, errs := mergeEnvFiles(cfg.EnvFile, cfg.Env, baseDir)
+	for _, err := range errs {
+		issues = append(issues, Issue{Severity: SeverityError, Path: []string{"env_file"}, Message: err.Error()})
+	}
+	cfg.Env = env
+
+	for name, svc := range cfg.Services {
+		env, errs := mergeEnvFiles(svc.EnvFile, svc.Env, baseDir)
+		for _, err := range errs {
+			issues = append(issues, Issue{
+				Severity: SeverityError,
+				Path:     servicePath(name, "env_file"),
+				Message:  fmt.Sprintf("service %q: %v", name, err),
+			})
+		}
+		svc.Env = env
+		cfg.Services[name] = svc
+	}
+
+	return issues
+}
+
+func mergeEnvFiles(files []string, explicit map[string]string, baseDir string) (map[string]string, []error) {
+	if len(files) == 0 {
+		return explicit, nil
+	}
+
+	merged := make(map[string]string)
+	var errs []error
+	for _, file := range files {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		vars, err := ReadEnvFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for k, v := range vars {
+			merged[k] = escapeDollars(v)
+		}
+	}
+	maps.Copy(merged, explicit)
+
+	return merged, errs
+}
+
+// ReadEnvFile parses a dotenv file.
+func ReadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading env file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return parseDotenv(path, bufio.NewScanner(f))
+}
+
+// parseDotenv supports KEY=VALUE lines, an optional "export " prefix,
+// # comments, single-quoted literals and double-quoted values with
+// \n, \t, \" and \\ escapes.
+func parseDotenv(name string, scanner *bufio.Scanner) (map[string]string, error) {
+	vars := make(map[string]string)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", name, lineNo)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("%s:%d: empty key", name, lineNo)
+		}
+
+		value, err := parseDotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNo, err)
+		}
+		vars[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	return vars, nil
+}
+
+func parseDotenvValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+
+	switch v[0] {
+	case '\'':
+		end := strings.IndexByte(v[1:], '\'')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		return v[1 : end+1], nil
+
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			c := v[i]
+			if c == '"' {
+				return b.String(), nil
+			}
+			if c == '\\' && i+1 < len(v) {
+				i++
+				switch v[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(v[i])
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		return "", fmt.Errorf("unterminated double quote")
+	}
+
+	// Unquoted: strip inline comments
+	if idx := strings.Index(v, " #"); idx != -1 {
+		v = strings.TrimSpace(v[:idx])
+	}
+	return v, nil
+}
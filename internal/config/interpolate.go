@@ -0,0 +1,333 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	servicesRefPrefix = "services."
+	selfRefPrefix     = "self."
+)
+
+// interpolateDocument expands ${VAR} and ${VAR:-default} in the document
+// using lookup, except in the project env and in service commands and env.
+// Those can reference services, so interpolateValues expands them once the
+// config is decoded, in a single pass so that $$ is unescaped only once.
+func interpolateDocument(root *yaml.Node, lookup func(string) string) error {
+	if root.Kind != yaml.MappingNode {
+		return interpolateNode(root, lookup)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if err := interpolateNode(key, lookup); err != nil {
+			return err
+		}
+		switch {
+		case key.Value == "env":
+			continue
+		case key.Value == "services" && value.Kind == yaml.MappingNode:
+			for j := 1; j < len(value.Content); j += 2 {
+				if err := interpolateService(value.Content[j], lookup); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := interpolateNode(value, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolateService expands a service definition except its command and
+// env, which interpolateValues expands.
+func interpolateService(svc *yaml.Node, lookup func(string) string) error {
+	if svc.Kind != yaml.MappingNode {
+		return interpolateNode(svc, lookup)
+	}
+	for i := 0; i+1 < len(svc.Content); i += 2 {
+		key, value := svc.Content[i], svc.Content[i+1]
+		if err := interpolateNode(key, lookup); err != nil {
+			return err
+		}
+		if key.Value == "command" || key.Value == "env" {
+			continue
+		}
+		if err := interpolateNode(value, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolateNode expands ${VAR} and ${VAR:-default} in every scalar of node
+// using lookup.
+func interpolateNode(node *yaml.Node, lookup func(string) string) error {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		value, err := expand(node.Value, func(ref string) (string, bool, error) {
+			return lookup(ref), true, nil
+		})
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		if node.Style == 0 {
+			// Re-resolve plain scalars so "port: ${PORT}" decodes as an int
+			node.Tag = ""
+		}
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := interpolateNode(child, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolver returns the value for a reference. handled=false leaves the
+// reference untouched in the output.
+type resolver func(ref string) (value string, handled bool, err error)
+
+// expand replaces ${NAME} and ${NAME:-default} using resolve. "$$" escapes a
+// literal dollar sign.
+func expand(s string, resolve resolver) (string, error) {
+	return expandTemplate(s, resolve, false)
+}
+
+// expandPartial is like expand but returns a template to be expanded again
+// later: escapes are kept and resolved values are escaped, so expanding the
+// result gives the same text as expanding s once.
+func expandPartial(s string, resolve resolver) (string, error) {
+	return expandTemplate(s, resolve, true)
+}
+
+func expandTemplate(s string, resolve resolver, partial bool) (string, error) {
+	var b strings.Builder
+	literal := func(v string) {
+		if partial {
+			v = escapeDollars(v)
+		}
+		b.WriteString(v)
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '$' {
+			literal("$")
+			i++
+			continue
+		}
+		if i+1 >= len(s) || s[i+1] != '{' {
+			b.WriteByte('$')
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		expr := s[i+2 : i+end]
+
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable name in %q", s)
+		}
+
+		value, handled, err := resolve(name)
+		if err != nil {
+			return "", err
+		}
+		if !handled {
+			b.WriteString(s[i : i+end+1])
+		} else if value == "" && hasDefault {
+			literal(def)
+		} else {
+			literal(value)
+		}
+		i += end
+	}
+
+	return b.String(), nil
+}
+
+// escapeDollars escapes s so that expand returns it unchanged.
+func escapeDollars(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// interpolateValues expands the project env and the commands and env
+// values of services: ${VAR} and ${VAR:-default} from lookup, and
+// ${services.<name>.<field>} with the fields port, host and url. It is the
+// only pass over these values, so $$ always stands for one literal $.
+//
+// ${self.port} is resolved here for fixed ports. For dynamic ones, values
+// that mention it stay templates until WithPort binds the port. Project env
+// values are expanded once, and again for each service only when they
+// mention ${self.port}. Values that fail to expand are reported and kept
+// as written.
+func interpolateValues(cfg *Config, lookup func(string) string) Issues {
+	var issues Issues
+
+	rawEnv := cfg.Env
+	if len(cfg.Env) > 0 {
+		cfg.Env = make(map[string]string, len(rawEnv))
+		for k, v := range rawEnv {
+			expanded, err := expand(v, func(ref string) (string, bool, error) {
+				if strings.HasPrefix(ref, selfRefPrefix) {
+					return "", false, nil
+				}
+				if strings.HasPrefix(ref, servicesRefPrefix) {
+					return cfg.serviceRef(strings.TrimPrefix(ref, servicesRefPrefix))
+				}
+				return lookup(ref), true, nil
+			})
+			if err != nil {
+				issues = append(issues, Issue{
+					Severity: SeverityError,
+					Path:     []string{"env", k},
+					Message:  fmt.Sprintf("env %s: %v", k, err),
+				})
+				expanded = v
+			}
+			cfg.Env[k] = expanded
+		}
+	}
+
+	for name, svc := range cfg.Services {
+		resolve := func(ref string) (string, bool, error) {
+			switch {
+			case ref == selfPort:
+				if svc.PortRange != nil {
+					return "", false, nil
+				}
+				return cfg.serviceRef(name + ".port")
+			case strings.HasPrefix(ref, servicesRefPrefix):
+				return cfg.serviceRef(strings.TrimPrefix(ref, servicesRefPrefix))
+			case strings.HasPrefix(ref, selfRefPrefix):
+				return "", false, nil
+			}
+			return lookup(ref), true, nil
+		}
+		expandValue := func(v string) (string, error) {
+			if svc.PortRange != nil && mentionsSelfPort(v) {
+				return expandPartial(v, resolve)
+			}
+			return expand(v, resolve)
+		}
+
+		command, err := expandValue(svc.Command)
+		if err != nil {
+			issues = append(issues, Issue{
+				Severity: SeverityError,
+				Path:     servicePath(name, "command"),
+				Message:  fmt.Sprintf("service %q: command: %v", name, err),
+			})
+		} else {
+			svc.Command = command
+		}
+
+		if len(svc.Env) > 0 {
+			env := make(map[string]string, len(svc.Env))
+			for k, v := range svc.Env {
+				if raw, ok := rawEnv[k]; ok && v == raw && !mentionsSelfPort(v) {
+					// Inherited from the project env, already expanded
+					env[k] = cfg.Env[k]
+					continue
+				}
+				expanded, err := expandValue(v)
+				if err != nil {
+					issues = append(issues, Issue{
+						Severity: SeverityError,
+						Path:     servicePath(name, "env", k),
+						Message:  fmt.Sprintf("service %q: env %s: %v", name, k, err),
+					})
+					expanded = v
+				}
+				env[k] = expanded
+			}
+			svc.Env = env
+		}
+
+		cfg.Services[name] = svc
+	}
+
+	return issues
+}
+
+// mentionsSelfPort reports whether v refers to ${self.port}, escaped or not.
+func mentionsSelfPort(v string) bool {
+	return strings.Contains(v, "{"+selfPort+"}")
+}
+
+func (c *Config) serviceRef(ref string) (string, bool, error) {
+	name, field, ok := strings.Cut(ref, ".")
+	if !ok {
+		return "", false, fmt.Errorf("invalid service reference %q (want services.<name>.<field>)", servicesRefPrefix+ref)
+	}
+
+	svc, exists := c.Services[name]
+	if !exists {
+		return "", false, fmt.Errorf("reference to unknown service %q", name)
+	}
+
+	switch field {
+	case "port":
+		if svc.PortRange != nil {
+			return "", false, fmt.Errorf("service %q uses a dynamic port; use $LOKL_%s_PORT at runtime instead", name, EnvName(name))
+		}
+		if svc.Port == 0 {
+			return "", false, fmt.Errorf("service %q has no port", name)
+		}
+		return strconv.Itoa(svc.Port), true, nil
+	case "host":
+		if domain := c.ServiceDomain(svc); domain != "" {
+			return domain, true, nil
+		}
+		return "localhost", true, nil
+	case "url":
+		if url := c.ServiceURL(svc); url != "" {
+			return url, true, nil
+		}
+		if svc.PortRange != nil {
+			return "", false, fmt.Errorf("service %q uses a dynamic port; use $LOKL_%s_URL at runtime instead", name, EnvName(name))
+		}
+		if svc.Port == 0 {
+			return "", false, fmt.Errorf("service %q has no port or subdomain", name)
+		}
+		return fmt.Sprintf("http://localhost:%d", svc.Port), true, nil
+	default:
+		return "", false, fmt.Errorf("unknown field %q in reference to service %q (must be port, host, or url)", field, name)
+	}
+}
+
+// ProxyURL returns the URL the proxy serves domain on. The port is only
+// included when it is not the scheme's default.
+func (c *Config) ProxyURL(domain string) string {
+	url := c.Proxy.Scheme() + "://" + domain
+	if port := c.Proxy.URLPort(); port != c.Proxy.DefaultPort() {
+		url += ":" + strconv.Itoa(port)
+	}
+	return url
+}
+
+// ServiceDomain returns the full domain for a service, handling both
+// simple subdomains (api -> api.example.com) and full domains (api.example.com).
+// A service without a subdomain gets the host of its first hosts entry or
+// route; wildcard hosts are skipped.
+func (c *Config) ServiceDomain(svc Service) string {
+	rt, _ := c.primaryRoute(svc)
+	return rt.Host
+}
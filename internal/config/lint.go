@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lint reports keys lokl does not know and options that are accepted but
+// have no effect. Everything it finds is a warning.
+func (d *document) lint(cfg *Config) Issues {
+	v := &validator{}
+	if d.version < CurrentVersion {
+		v.warnf([]string{"version"}, "config version %d is outdated (current is %d); run lokl config migrate", d.version, CurrentVersion)
+	}
+	lintKeys(v, d.root, reflect.TypeOf(Config{}), nil)
+	lintIneffective(v, d.root, cfg)
+	return v.issues
+}
+
+// lintKeys walks node alongside t and warns about mapping keys that do not
+// correspond to a yaml field.
+func lintKeys(v *validator, node *yaml.Node, t reflect.Type, path []string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			lintKeys(v, node.Content[i+1], t.Elem(), appendPath(path, node.Content[i].Value))
+		}
+	case reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			keyPath := appendPath(path, key)
+
+			field, ok := fields[key]
+			if !ok {
+				v.warnf(keyPath, "unknown field %q%s", strings.Join(keyPath, "."), didYouMean(key, fields))
+				continue
+			}
+			lintKeys(v, node.Content[i+1], field, keyPath)
+		}
+	}
+}
+
+// yamlFields maps the yaml keys of a struct to their field types.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f.Type
+	}
+
+	// port accepts "auto" and ranges, which are decoded by hand.
+	if t == reflect.TypeOf(Service{}) {
+		fields["port"] = reflect.TypeOf(0)
+	}
+	return fields
+}
+
+func didYouMean(key string, fields map[string]reflect.Type) string {
+	candidates := make([]string, 0, len(fields))
+	for name := range fields {
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+
+	// Allow roughly one edit per three characters.
+	best, bestDist := "", len(key)/3+2
+	for _, name := range candidates {
+		if d := levenshtein(key, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// lintIneffective warns about options that are not implemented yet or that
+// do nothing for the kind of service they are set on. Options that always
+// get a default are checked in the document so only explicit ones warn.
+func lintIneffective(v *validator, root *yaml.Node, cfg *Config) {
+	if cfg.Proxy.HTTPRedirect && !cfg.Proxy.HTTPSEnabled() {
+		v.warnf([]string{"proxy", "http_redirect"}, "proxy.http_redirect has no effect when proxy.https is false")
+	}
+
+	services := mapGet(root, "services")
+	for name, svc := range cfg.Services {
+		raw := mapGet(services, name)
+
+		if svc.Image != "" {
+			v.warnf(servicePath(name, "image"), "service %q: image services are not supported yet and will fail to start", name)
+		}
+		if svc.Image == "" && len(svc.Volumes) > 0 {
+			v.warnf(servicePath(name, "volumes"), "service %q: volumes only apply to image services", name)
+		}
+		if svc.Image == "" && len(svc.Ports) > 0 {
+			v.warnf(servicePath(name, "ports"), "service %q: ports only apply to image services; use port", name)
+		}
+		if svc.Limits != nil {
+			v.warnf(servicePath(name, "limits"), "service %q: limits are not supported yet and have no effect", name)
+		}
+		if svc.Rewrite != nil && svc.Subdomain == "" && len(svc.Hosts) == 0 && len(svc.Routes) == 0 {
+			v.warnf(servicePath(name, "rewrite"), "service %q: rewrite has no effect without a subdomain, hosts or routes", name)
+		}
+		if cfg.Proxy.DNS == DNSHosts {
+			for _, rt := range cfg.ServiceRoutes(svc) {
+				if IsWildcardHost(rt.Host) {
+					v.warnf(servicePath(name, "hosts"), "service %q: %s cannot be listed in /etc/hosts; wildcard hosts resolve only with proxy.dns: server", name, rt.Host)
+					break
+				}
+			}
+		}
+		if svc.Health != nil && svc.Health.Path == "" {
+			v.warnf(servicePath(name, "health"), "service %q: health has no path, so no health check runs", name)
+		}
+		if mapGet(raw, "restart") != nil {
+			v.warnf(servicePath(name, "restart"), "service %q: restart policies are not supported yet; exited services are not restarted", name)
+		}
+		if mapGet(raw, "ready_timeout") != nil {
+			v.warnf(servicePath(name, "ready_timeout"), "service %q: ready_timeout is not supported yet and has no effect", name)
+		}
+	}
+}
+
+func appendPath(path []string, key string) []string {
+	return append(append([]string(nil), path...), key)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	_, issues, err := LoadAll("testdata/lint.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`testdata/lint.yaml:5:3: warning: proxy.http_redirect has no effect when proxy.https is false`,
+		`testdata/lint.yaml:6:3: warning: unknown field "proxy.prot"`,
+		`testdata/lint.yaml:10:5: warning: unknown field "services.api.comand" (did you mean "command"?)`,
+		`testdata/lint.yaml:12:5: warning: service "api": volumes only apply to image services`,
+		`testdata/lint.yaml:14:5: warning: service "api": health has no path, so no health check runs`,
+		`testdata/lint.yaml:16:7: warning: unknown field "services.api.health.retires" (did you mean "retries"?)`,
+		`testdata/lint.yaml:20:5: warning: service "web": rewrite has no effect without a subdomain, hosts or routes`,
+		`testdata/lint.yaml:22:5: warning: service "web": limits are not supported yet and have no effect`,
+		`testdata/lint.yaml:24:5: warning: unknown field "services.web.something_else"`,
+	}
+
+	var got []string
+	for _, issue := range issues.Warnings() {
+		got = append(got, issue.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	fields := yamlFields(reflect.TypeOf(Service{}))
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"comand", ` (did you mean "command"?)`},
+		{"dependson", ` (did you mean "depends_on"?)`},
+		{"enviroment", ""},
+		{"subdomian", ` (did you mean "subdomain"?)`},
+		{"xyz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := didYouMean(tt.key, fields); got != tt.want {
+				t.Errorf("didYouMean(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// DefaultFile is the default config file name.
+	DefaultFile = "lokl.yaml"
+
+	extJSON = ".json"
+	extTOML = ".toml"
+
+	stateDirName = ".lokl"
+)
+
+// FileNames are the config file names Find looks for, in order of
+// preference.
+var FileNames = []string{DefaultFile, "lokl" + extJSON, "lokl" + extTOML}
+
+// ErrNotFound is returned by Find when no config file exists in the
+// directory or any of its parents.
+var ErrNotFound = errors.New("no lokl config file found in this directory or any parent")
+
+// Find looks for one of FileNames in dir and then in each parent directory,
+// the way git looks for .git, and returns the first match.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", dir, err)
+	}
+
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// StateDir returns the directory lokl keeps generated files in, such as
+// certificates. It lives next to the config file.
+func (c *Config) StateDir() string {
+	return filepath.Join(c.Dir, stateDirName)
+}
+
+// anchorPaths makes service paths absolute, relative to the config
+// directory. Services without a path run in the config directory.
+func anchorPaths(cfg *Config) {
+	for name, svc := range cfg.Services {
+		if !filepath.IsAbs(svc.Path) {
+			svc.Path = filepath.Join(cfg.Dir, svc.Path)
+		}
+		cfg.Services[name] = svc
+	}
+}
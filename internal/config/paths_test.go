@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "apps", "web", "src")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, DefaultFile), "name: x\n")
+
+	for _, dir := range []string{root, nested} {
+		got, err := Find(dir)
+		if err != nil {
+			t.Fatalf("Find(%s): %v", dir, err)
+		}
+		if want := filepath.Join(root, DefaultFile); got != want {
+			t.Errorf("Find(%s) = %q, want %q", dir, got, want)
+		}
+	}
+
+	// The nearest config wins.
+	writeFile(t, filepath.Join(root, "apps", DefaultFile), "name: y\n")
+	got, err := Find(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "apps", DefaultFile); got != want {
+		t.Errorf("Find = %q, want nearest %q", got, want)
+	}
+}
+
+func TestFindNotFound(t *testing.T) {
+	if _, err := Find(t.TempDir()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLoadAnchorsPaths(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, DefaultFile), `name: anchored
+env_file: .env
+services:
+  web:
+    command: npm start
+    path: apps/web
+  root:
+    command: make
+  abs:
+    command: make
+    path: /opt/abs
+`)
+	writeFile(t, filepath.Join(root, ".env"), "FROM_ROOT=1\n")
+
+	// Load through a relative path from another working directory.
+	t.Chdir(filepath.Join(root, ".."))
+	cfg, err := Load(filepath.Join(filepath.Base(root), DefaultFile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Dir != root {
+		t.Errorf("dir = %q, want %q", cfg.Dir, root)
+	}
+	tests := map[string]string{
+		"web":  filepath.Join(root, "apps", "web"),
+		"root": root,
+		"abs":  "/opt/abs",
+	}
+	for name, want := range tests {
+		if got := cfg.Services[name].Path; got != want {
+			t.Errorf("%s.path = %q, want %q", name, got, want)
+		}
+	}
+	if cfg.Env["FROM_ROOT"] != "1" {
+		t.Errorf("env_file should be read relative to the config file")
+	}
+	if want := filepath.Join(root, ".lokl"); cfg.StateDir() != want {
+		t.Errorf("state dir = %q, want %q", cfg.StateDir(), want)
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	portAuto   = "auto"
+	selfPort   = "self.port"
+	minPortNum = 1
+	maxPortNum = 65535
+)
+
+// PortRange describes a port picked at start time. A zero range means any
+// free port chosen by the OS ("port: auto").
+type PortRange struct {
+	Min int
+	Max int
+}
+
+func (r PortRange) String() string {
+	if r.Min == 0 && r.Max == 0 {
+		return portAuto
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// UnmarshalYAML accepts "port: auto" and "port: 3000-3100" in addition to a
+// fixed port number. Values of the wrong type are recorded in decodeErrors
+// and the rest of the service is still decoded.
+func (s *Service) UnmarshalYAML(node *yaml.Node) error {
+	type plain Service
+
+	stripped := *node
+	stripped.Content = nil
+
+	var portRange *PortRange
+	var errs []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == "port" && value.Kind == yaml.ScalarNode {
+			if _, err := strconv.Atoi(value.Value); err != nil {
+				r, err := parsePortRange(value.Value)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("line %d: %v", value.Line, err))
+					continue
+				}
+				portRange = &r
+				continue
+			}
+		}
+		stripped.Content = append(stripped.Content, key, value)
+	}
+
+	var p plain
+	if err := stripped.Decode(&p); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return err
+		}
+		errs = append(errs, typeErr.Errors...)
+	}
+	*s = Service(p)
+	s.PortRange = portRange
+	s.decodeErrors = errs
+	return nil
+}
+
+// MarshalYAML writes dynamic ports back as "auto" or "min-max".
+func (s Service) MarshalYAML() (any, error) {
+	type plain Service
+
+	var node yaml.Node
+	if err := node.Encode(plain(s)); err != nil {
+		return nil, err
+	}
+	if s.PortRange == nil {
+		return &node, nil
+	}
+
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s.PortRange.String()}
+	if idx := mapIndex(&node, "port"); idx != -1 {
+		node.Content[idx+1] = value
+	} else {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "port"}
+		node.Content = append(node.Content, key, value)
+	}
+	return &node, nil
+}
+
+func parsePortRange(v string) (PortRange, error) {
+	if v == portAuto {
+		return PortRange{}, nil
+	}
+
+	lo, hi, ok := strings.Cut(v, "-")
+	if !ok {
+		return PortRange{}, fmt.Errorf("invalid port %q (must be a number, %q, or a range like 3000-3100)", v, portAuto)
+	}
+	minPort, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	maxPort, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q", v)
+	}
+	return PortRange{Min: minPort, Max: maxPort}, nil
+}
+
+func validatePortRange(name string, r *PortRange) error {
+	if r.Min == 0 && r.Max == 0 {
+		return nil
+	}
+	if r.Min < minPortNum || r.Max > maxPortNum || r.Min > r.Max {
+		return fmt.Errorf("service %q: invalid port range %s", name, r)
+	}
+	return nil
+}
+
+// HasPort reports whether the service listens on a fixed or dynamic port.
+func (s Service) HasPort() bool {
+	return s.Port != 0 || s.PortRange != nil
+}
+
+// WithPort returns a copy of svc bound to port. For a dynamic port,
+// ${self.port} in the command and env values is replaced and PORT is set.
+func (s Service) WithPort(port int) Service {
+	if s.PortRange == nil {
+		s.Port = port
+		return s
+	}
+
+	value := strconv.Itoa(port)
+	bind := func(v string) string {
+		if !mentionsSelfPort(v) {
+			return v
+		}
+		// Values that mention ${self.port} were left as templates when the
+		// config was loaded; see interpolateValues.
+		bound, err := expand(v, func(ref string) (string, bool, error) {
+			return value, ref == selfPort, nil
+		})
+		if err != nil {
+			return v // reported when the config was loaded
+		}
+		return bound
+	}
+
+	s.Command = bind(s.Command)
+
+	env := make(map[string]string, len(s.Env)+1)
+	for k, v := range s.Env {
+		env[k] = bind(v)
+	}
+	env["PORT"] = value
+	s.Env = env
+
+	s.Port = port
+	return s
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+const (
+	defaultListenHost = "127.0.0.1"
+	// defaultListenHost6 is also bound when the host is not configured,
+	// because project domains resolve to both loopback addresses.
+	defaultListenHost6 = "::1"
+	defaultHTTPSPort   = 443
+	defaultHTTPPort    = 80
+)
+
+// HTTPSEnabled reports whether the proxy serves HTTPS. With https: false it
+// serves plain HTTP and needs no certificates.
+func (p ProxyConfig) HTTPSEnabled() bool {
+	return p.HTTPS == nil || *p.HTTPS
+}
+
+// Scheme returns the URL scheme the proxy serves.
+func (p ProxyConfig) Scheme() string {
+	if p.HTTPSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// DefaultPort is the standard port of the proxy's scheme, which URLs leave
+// out.
+func (p ProxyConfig) DefaultPort() int {
+	if p.HTTPSEnabled() {
+		return defaultHTTPSPort
+	}
+	return defaultHTTPPort
+}
+
+// ListenAddr returns the host and port the proxy binds. The host defaults
+// to 127.0.0.1 so services are not exposed to the network, and the port to
+// DefaultPort. An empty host, as in ":8443", means every interface.
+func (p ProxyConfig) ListenAddr() (string, int, error) {
+	if p.Listen == "" {
+		return defaultListenHost, p.DefaultPort(), nil
+	}
+
+	host, portStr := defaultListenHost, p.Listen
+	if _, err := strconv.Atoi(p.Listen); err != nil {
+		host, portStr, err = net.SplitHostPort(p.Listen)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid proxy.listen %q (must be host:port or a port)", p.Listen)
+		}
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < minPortNum || port > maxPortNum {
+		return "", 0, fmt.Errorf("invalid proxy.listen %q: port must be between %d and %d", p.Listen, minPortNum, maxPortNum)
+	}
+	return host, port, nil
+}
+
+// ListenHosts returns every host the proxy binds: the ListenAddr host, and
+// ::1 as well when proxy.listen does not name a host. Binding ::1 is best
+// effort, as not every system has IPv6.
+func (p ProxyConfig) ListenHosts() []string {
+	host, _, err := p.ListenAddr()
+	if err != nil {
+		return nil
+	}
+	if _, err := strconv.Atoi(p.Listen); p.Listen == "" || err == nil {
+		return []string{host, defaultListenHost6}
+	}
+	return []string{host}
+}
+
+// RemoteHTTPSPort returns the port remote hosts serve HTTPS on.
+func (p ProxyConfig) RemoteHTTPSPort() int {
+	if p.RemotePort != 0 {
+		return p.RemotePort
+	}
+	return defaultHTTPSPort
+}
+
+// RemoteAddr returns host with the remote port, which is left out when it
+// is the default.
+func (p ProxyConfig) RemoteAddr(host string) string {
+	if port := p.RemoteHTTPSPort(); port != defaultHTTPSPort {
+		return net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	return host
+}
+
+// URLPort returns the port that belongs in proxy URLs.
+func (p ProxyConfig) URLPort() int {
+	if p.PublicPort != 0 {
+		return p.PublicPort
+	}
+	if _, port, err := p.ListenAddr(); err == nil {
+		return port
+	}
+	return p.DefaultPort()
+}
+
+func validateProxy(v *validator, p ProxyConfig) {
+	switch p.CA {
+	case "", CALokl, CAMkcert:
+	default:
+		v.errorf([]string{"proxy", "ca"}, "invalid proxy.ca %q (must be %s or %s)", p.CA, CALokl, CAMkcert)
+	}
+
+	switch p.DNS {
+	case "", DNSServer, DNSHosts:
+	default:
+		v.errorf([]string{"proxy", "dns"}, "invalid proxy.dns %q (must be %s or %s)", p.DNS, DNSServer, DNSHosts)
+	}
+
+	if _, _, err := p.ListenAddr(); err != nil {
+		v.errorf([]string{"proxy", "listen"}, "%v", err)
+	}
+	if p.PublicPort < 0 || p.PublicPort > maxPortNum {
+		v.errorf([]string{"proxy", "public_port"}, "invalid proxy.public_port %d (must be between %d and %d)", p.PublicPort, minPortNum, maxPortNum)
+	}
+	if p.RemotePort < 0 || p.RemotePort > maxPortNum {
+		v.errorf([]string{"proxy", "remote_port"}, "invalid proxy.remote_port %d (must be between %d and %d)", p.RemotePort, minPortNum, maxPortNum)
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProxyListenAddr(t *testing.T) {
+	f := false
+
+	tests := []struct {
+		name     string
+		proxy    ProxyConfig
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{
+		{name: "default https", proxy: ProxyConfig{}, wantHost: "127.0.0.1", wantPort: 443},
+		{name: "default http", proxy: ProxyConfig{HTTPS: &f}, wantHost: "127.0.0.1", wantPort: 80},
+		{name: "bare port", proxy: ProxyConfig{Listen: "8443"}, wantHost: "127.0.0.1", wantPort: 8443},
+		{name: "host and port", proxy: ProxyConfig{Listen: "0.0.0.0:443"}, wantHost: "0.0.0.0", wantPort: 443},
+		{name: "all interfaces", proxy: ProxyConfig{Listen: ":8443"}, wantHost: "", wantPort: 8443},
+		{name: "ipv6", proxy: ProxyConfig{Listen: "[::1]:8443"}, wantHost: "::1", wantPort: 8443},
+		{name: "missing port", proxy: ProxyConfig{Listen: "localhost"}, wantErr: true},
+		{name: "port out of range", proxy: ProxyConfig{Listen: "127.0.0.1:70000"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, err := tt.proxy.ListenAddr()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ListenAddr() = %q, %d, want error", host, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListenAddr() error: %v", err)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("ListenAddr() = %q, %d, want %q, %d", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestProxyListenHosts(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   []string
+	}{
+		{"", []string{"127.0.0.1", "::1"}},
+		{"8443", []string{"127.0.0.1", "::1"}},
+		{"127.0.0.1:8443", []string{"127.0.0.1"}},
+		{":8443", []string{""}},
+		{"[::1]:8443", []string{"::1"}},
+		{"localhost", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.listen, func(t *testing.T) {
+			got := ProxyConfig{Listen: tt.listen}.ListenHosts()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ListenHosts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	f := false
+
+	tests := []struct {
+		name  string
+		proxy ProxyConfig
+		want  string
+	}{
+		{name: "default port", proxy: ProxyConfig{}, want: "https://api.test.dev"},
+		{name: "custom port", proxy: ProxyConfig{Listen: "127.0.0.1:8443"}, want: "https://api.test.dev:8443"},
+		{name: "forwarded port", proxy: ProxyConfig{Listen: "8443", PublicPort: 443}, want: "https://api.test.dev"},
+		{name: "plain http", proxy: ProxyConfig{HTTPS: &f}, want: "http://api.test.dev"},
+		{name: "plain http custom port", proxy: ProxyConfig{HTTPS: &f, Listen: "8080"}, want: "http://api.test.dev:8080"},
+		{name: "https on port 80", proxy: ProxyConfig{Listen: "80"}, want: "https://api.test.dev:80"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Proxy: tt.proxy}
+			if got := cfg.ProxyURL("api.test.dev"); got != tt.want {
+				t.Errorf("ProxyURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
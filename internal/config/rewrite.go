@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+// RedirectStatuses are the statuses a redirect rule may use.
+var RedirectStatuses = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+func validateRewrite(v *validator, name string, rw *RewriteConfig) {
+	if rw == nil {
+		return
+	}
+
+	for i, rule := range rw.Rules {
+		path := servicePath(name, "rewrite", "rules", fmt.Sprint(i))
+
+		actions := 0
+		for _, set := range []bool{rule.Rewrite != "", rule.Redirect != "", rule.Fallback != ""} {
+			if set {
+				actions++
+			}
+		}
+		if actions != 1 {
+			v.errorf(path, "service %q: rewrite rule %d needs exactly one of rewrite, redirect and fallback", name, i)
+			continue
+		}
+
+		if rule.Match == "" && rule.Fallback == "" {
+			v.errorf(path, "service %q: rewrite rule %d needs match", name, i)
+		}
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			v.errorf(append(path, "match"), "service %q: invalid match %q: %v", name, rule.Match, err)
+		}
+		for j, pattern := range rule.Except {
+			if _, err := regexp.Compile(pattern); err != nil {
+				v.errorf(append(path, "except", fmt.Sprint(j)), "service %q: invalid except pattern %q: %v", name, pattern, err)
+			}
+		}
+
+		if rule.Status != 0 && rule.Redirect == "" {
+			v.errorf(append(path, "status"), "service %q: status only applies to redirect rules", name)
+		} else if rule.Status != 0 && !slices.Contains(RedirectStatuses, rule.Status) {
+			v.errorf(append(path, "status"), "service %q: invalid redirect status %d (must be 301, 302, 307 or 308)", name, rule.Status)
+		}
+		if rule.Fallback == "" && (len(rule.Except) > 0 || rule.OnNotFound) {
+			v.errorf(path, "service %q: except and on_not_found only apply to fallback rules", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Route is a resolved place the proxy serves a service: a full host name
+// and an optional path prefix.
+type Route struct {
+	Host string
+	// PathPrefix is "" or a path starting with / and without a trailing /.
+	PathPrefix  string
+	StripPrefix bool
+}
+
+// ServiceRoutes returns where the proxy serves svc: its subdomain first,
+// then its hosts and routes. Routes whose host cannot be resolved are
+// skipped.
+func (c *Config) ServiceRoutes(svc Service) []Route {
+	var routes []Route
+	if host := c.proxyHost(svc.Subdomain); host != "" {
+		routes = append(routes, Route{Host: host})
+	}
+	for _, name := range svc.Hosts {
+		if host := c.proxyHost(name); host != "" {
+			routes = append(routes, Route{Host: host})
+		}
+	}
+	for _, rc := range svc.Routes {
+		name := rc.Host
+		if name == "" {
+			name = svc.Subdomain
+		}
+		host := c.proxyHost(name)
+		if host == "" {
+			continue
+		}
+		routes = append(routes, Route{Host: host, PathPrefix: CleanPathPrefix(rc.PathPrefix), StripPrefix: rc.StripPrefix})
+	}
+	return routes
+}
+
+// ServiceURL returns the proxy URL of a service's primary route, including
+// its path prefix, or "" if the service is not proxied.
+func (c *Config) ServiceURL(svc Service) string {
+	rt, ok := c.primaryRoute(svc)
+	if !ok {
+		return ""
+	}
+	return c.ProxyURL(rt.Host) + rt.PathPrefix
+}
+
+// primaryRoute is the first route with a concrete host; a wildcard does
+// not name a host to link to.
+func (c *Config) primaryRoute(svc Service) (Route, bool) {
+	for _, rt := range c.ServiceRoutes(svc) {
+		if !IsWildcardHost(rt.Host) {
+			return rt, true
+		}
+	}
+	return Route{}, false
+}
+
+// proxyHost resolves a subdomain (api -> api.example.com, *.app ->
+// *.app.example.com) or keeps a full domain (api.example.com).
+func (c *Config) proxyHost(name string) string {
+	name = strings.ToLower(name)
+	if name == "" {
+		return ""
+	}
+	if strings.Contains(strings.TrimPrefix(name, "*."), ".") {
+		return name
+	}
+	if c.Proxy.Domain == "" {
+		return ""
+	}
+	return name + "." + c.Proxy.Domain
+}
+
+// IsWildcardHost reports whether host is a pattern like *.app.example.com,
+// which matches any single label in place of the *.
+func IsWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.")
+}
+
+// validHostPattern reports whether name is a host or a wildcard pattern
+// whose only * is a whole leading label.
+func validHostPattern(name string) bool {
+	rest := strings.TrimPrefix(name, "*.")
+	return rest != "" && !strings.Contains(rest, "*") && !strings.ContainsAny(rest, "/: ")
+}
+
+// CleanPathPrefix normalizes a route path prefix: "/" and "" become "",
+// and a trailing slash is dropped.
+func CleanPathPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+func validateRoutes(v *validator, name string, svc *Service, domain string) {
+	for i, host := range svc.Hosts {
+		path := servicePath(name, "hosts", fmt.Sprint(i))
+		switch {
+		case !validHostPattern(host):
+			v.errorf(path, "service %q: invalid host %q (a * is only allowed as the whole first label, like *.app)", name, host)
+		case !strings.Contains(strings.TrimPrefix(host, "*."), ".") && domain == "":
+			v.errorf(path, "service %q: host %q is a subdomain but proxy.domain is not configured", name, host)
+		}
+	}
+	if len(svc.Hosts) > 0 && !svc.HasPort() {
+		v.errorf(servicePath(name, "hosts"), "service %q: port is required when hosts are set", name)
+	}
+
+	for i, rc := range svc.Routes {
+		path := servicePath(name, "routes", fmt.Sprint(i))
+		host := rc.Host
+		if host == "" {
+			host = svc.Subdomain
+		}
+
+		switch {
+		case host == "":
+			v.errorf(path, "service %q: route %d needs a host when the service has no subdomain", name, i)
+		case !validHostPattern(host):
+			v.errorf(append(path, "host"), "service %q: invalid route host %q (a * is only allowed as the whole first label, like *.app)", name, host)
+		case !strings.Contains(strings.TrimPrefix(host, "*."), ".") && domain == "":
+			v.errorf(path, "service %q: route host %q is a subdomain but proxy.domain is not configured", name, host)
+		}
+		if rc.PathPrefix != "" && !strings.HasPrefix(rc.PathPrefix, "/") {
+			v.errorf(append(path, "path_prefix"), "service %q: path_prefix %q must start with /", name, rc.PathPrefix)
+		}
+		if rc.StripPrefix && CleanPathPrefix(rc.PathPrefix) == "" {
+			v.warnf(append(path, "strip_prefix"), "service %q: strip_prefix has no effect without a path_prefix", name)
+		}
+	}
+
+	if len(svc.Routes) > 0 && !svc.HasPort() {
+		v.errorf(servicePath(name, "routes"), "service %q: port is required when routes are set", name)
+	}
+}
+
+// checkDuplicateRoutes reports two services, or one service twice, served
+// at the same host and path prefix.
+func checkDuplicateRoutes(v *validator, cfg *Config) {
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	owners := make(map[Route]string)
+	for _, name := range names {
+		for _, rt := range cfg.ServiceRoutes(cfg.Services[name]) {
+			key := Route{Host: rt.Host, PathPrefix: rt.PathPrefix}
+			if existing, exists := owners[key]; exists {
+				if existing == name {
+					v.errorf(servicePath(name, "routes"), "service %q is served twice at %s%s", name, rt.Host, rt.PathPrefix)
+					continue
+				}
+				v.errorf(servicePath(name, "routes"), "services %q and %q are both served at %s%s", existing, name, rt.Host, rt.PathPrefix)
+				continue
+			}
+			owners[key] = name
+		}
+	}
+}
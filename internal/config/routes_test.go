@@ -0,0 +1,71 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestServiceRoutes(t *testing.T) {
+	cfg := &Config{Proxy: ProxyConfig{Domain: "test.dev", PublicPort: 8443}}
+
+	tests := []struct {
+		name    string
+		svc     Service
+		want    []Route
+		wantURL string
+	}{
+		{
+			name:    "subdomain only",
+			svc:     Service{Subdomain: "app"},
+			want:    []Route{{Host: "app.test.dev"}},
+			wantURL: "https://app.test.dev:8443",
+		},
+		{
+			name: "mount under the subdomain",
+			svc:  Service{Subdomain: "app", Routes: []RouteConfig{{PathPrefix: "/api/", StripPrefix: true}}},
+			want: []Route{
+				{Host: "app.test.dev"},
+				{Host: "app.test.dev", PathPrefix: "/api", StripPrefix: true},
+			},
+			wantURL: "https://app.test.dev:8443",
+		},
+		{
+			name:    "routes only",
+			svc:     Service{Routes: []RouteConfig{{Host: "shop.example.com", PathPrefix: "/api"}, {Host: "www", PathPrefix: "/"}}},
+			want:    []Route{{Host: "shop.example.com", PathPrefix: "/api"}, {Host: "www.test.dev"}},
+			wantURL: "https://shop.example.com:8443/api",
+		},
+		{
+			name:    "apex and www",
+			svc:     Service{Subdomain: "www", Hosts: []string{"test.dev"}},
+			want:    []Route{{Host: "www.test.dev"}, {Host: "test.dev"}},
+			wantURL: "https://www.test.dev:8443",
+		},
+		{
+			name:    "wildcard is not linked",
+			svc:     Service{Hosts: []string{"*.app", "*.Tenants.example.com", "app"}},
+			want:    []Route{{Host: "*.app.test.dev"}, {Host: "*.tenants.example.com"}, {Host: "app.test.dev"}},
+			wantURL: "https://app.test.dev:8443",
+		},
+		{
+			name: "wildcard only",
+			svc:  Service{Hosts: []string{"*.app"}},
+			want: []Route{{Host: "*.app.test.dev"}},
+		},
+		{
+			name: "not proxied",
+			svc:  Service{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.ServiceRoutes(tt.svc); !slices.Equal(got, tt.want) {
+				t.Errorf("ServiceRoutes() = %+v, want %+v", got, tt.want)
+			}
+			if got := cfg.ServiceURL(tt.svc); got != tt.wantURL {
+				t.Errorf("ServiceURL() = %q, want %q", got, tt.wantURL)
+			}
+		})
+	}
+}
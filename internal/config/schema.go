@@ -0,0 +1,100 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	shellType      = reflect.TypeOf(Shell{})
+	stringListType = reflect.TypeOf(StringList{})
+)
+
+// Schema returns a JSON Schema for lokl.yaml, generated from the Config
+// structs. Keys handled before decoding (include, templates, extends) and
+// fields with custom YAML forms (port) are described by hand.
+func Schema() map[string]any {
+	root := schemaFor(reflect.TypeOf(Config{}))
+	root["$schema"] = schemaDraft
+	root["title"] = "lokl.yaml"
+	root["required"] = []string{"name", "services"}
+
+	service := schemaFor(reflect.TypeOf(Service{}))
+	props := service["properties"].(map[string]any)
+	props["port"] = map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+			map[string]any{"const": "auto"},
+			map[string]any{"type": "string", "pattern": `^\d+-\d+$`},
+			map[string]any{"type": "string", "pattern": `^\$\{.+\}$`},
+		},
+	}
+	props["restart"] = map[string]any{
+		"type": "string",
+		"enum": []string{restartAlways, restartOnFailure, restartNever},
+	}
+	props[extendsKey] = map[string]any{"type": "string"}
+
+	rootProps := root["properties"].(map[string]any)
+	rootProps["services"] = map[string]any{"type": "object", "additionalProperties": service}
+	rootProps[templatesKey] = map[string]any{"type": "object", "additionalProperties": service}
+	rootProps[includeKey] = stringOrList()
+
+	proxyProps := rootProps["proxy"].(map[string]any)["properties"].(map[string]any)
+	proxyProps["ca"] = map[string]any{
+		"type": "string",
+		"enum": []string{CALokl, CAMkcert},
+	}
+	proxyProps["dns"] = map[string]any{
+		"type": "string",
+		"enum": []string{DNSServer, DNSHosts},
+	}
+
+	return root
+}
+
+func schemaFor(t reflect.Type) map[string]any {
+	switch t {
+	case shellType, stringListType:
+		return stringOrList()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]any)
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			props[name] = schemaFor(f.Type)
+		}
+		return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	default:
+		return map[string]any{}
+	}
+}
+
+func stringOrList() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ShellNone runs the command directly as an argv, without a wrapping shell.
+const ShellNone = "none"
+
+// Shell is the argv prefix used to run a service command, e.g. ["bash", "-lc"].
+// It accepts either a string ("bash -lc") or a list ([bash, -lc]) in YAML.
+type Shell []string
+
+func (s *Shell) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		args, err := SplitArgs(node.Value)
+		if err != nil {
+			return typeErrorf(node, "invalid shell %q: %v", node.Value, err)
+		}
+		*s = args
+		return nil
+	case yaml.SequenceNode:
+		var args []string
+		if err := node.Decode(&args); err != nil {
+			return err
+		}
+		*s = args
+		return nil
+	default:
+		return typeErrorf(node, "shell must be a string or a list")
+	}
+}
+
+func (s Shell) MarshalYAML() (any, error) {
+	for _, arg := range s {
+		if strings.ContainsAny(arg, " \t\n'\"\\") {
+			return []string(s), nil
+		}
+	}
+	return strings.Join(s, " "), nil
+}
+
+// IsNone reports whether the command should run without a shell.
+func (s Shell) IsNone() bool {
+	return len(s) == 1 && s[0] == ShellNone
+}
+
+// SplitArgs splits a command line into arguments, honoring single quotes,
+// double quotes and backslash escapes. It does not expand variables.
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// parseTOML parses a TOML document into a YAML mapping node so TOML configs
+// go through the same composition, interpolation and decoding as YAML ones.
+// Keys keep their file positions for error reporting, and tables keep the
+// order of the document. Dates and times become strings.
+func parseTOML(data []byte) (*yaml.Node, error) {
+	var doc map[string]any
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, col := decodeErr.Position()
+			return nil, fmt.Errorf("toml: line %d, column %d: %s", line, col, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+		}
+		return nil, err
+	}
+
+	positions, err := tomlKeyPositions(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := tomlBuilder{positions: positions}
+	return b.mapping(doc, nil, tomlPosition{Line: 1, Column: 1}), nil
+}
+
+type tomlPosition = unstable.Position
+
+// tomlKeyPositions maps each key path of a document to where the key is
+// first written. Elements of arrays of tables are addressed by index, so
+// the name in [[services.api.routes]] is at services.api.routes.0.
+func tomlKeyPositions(data []byte) (map[string]tomlPosition, error) {
+	positions := make(map[string]tomlPosition)
+	// arrays counts the elements of each array of tables seen so far, so a
+	// later [p.sub] header resolves p to its last element.
+	arrays := make(map[string]int)
+
+	var p unstable.Parser
+	p.Reset(data)
+
+	var table []string
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			table = nil
+			keys := tomlKeys(&p, expr.Key())
+			for i, k := range keys {
+				table = append(table, k.name)
+				record(positions, table, k.pos)
+				if i == len(keys)-1 && expr.Kind == unstable.ArrayTable {
+					path := tomlPath(table)
+					arrays[path]++
+					table = append(table, strconv.Itoa(arrays[path]-1))
+					record(positions, table, k.pos)
+				} else if n := arrays[tomlPath(table)]; n > 0 {
+					table = append(table, strconv.Itoa(n-1))
+				}
+			}
+		case unstable.KeyValue:
+			recordKeyValue(&p, positions, table, expr)
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, fmt.Errorf("toml: %w", err)
+	}
+	return positions, nil
+}
+
+// recordKeyValue records the keys of a key/value pair under table, and of
+// any inline tables in its value.
+func recordKeyValue(p *unstable.Parser, positions map[string]tomlPosition, table []string, expr *unstable.Node) {
+	path := slices.Clone(table)
+	for _, k := range tomlKeys(p, expr.Key()) {
+		path = append(path, k.name)
+		record(positions, path, k.pos)
+	}
+	recordValue(p, positions, path, expr.Value())
+}
+
+func recordValue(p *unstable.Parser, positions map[string]tomlPosition, path []string, value *unstable.Node) {
+	switch value.Kind {
+	case unstable.InlineTable:
+		it := value.Children()
+		for it.Next() {
+			recordKeyValue(p, positions, path, it.Node())
+		}
+	case unstable.Array:
+		it := value.Children()
+		for i := 0; it.Next(); i++ {
+			recordValue(p, positions, append(slices.Clone(path), strconv.Itoa(i)), it.Node())
+		}
+	}
+}
+
+type tomlKey struct {
+	name string
+	pos  tomlPosition
+}
+
+func tomlKeys(p *unstable.Parser, it unstable.Iterator) []tomlKey {
+	var keys []tomlKey
+	for it.Next() {
+		n := it.Node()
+		keys = append(keys, tomlKey{name: string(n.Data), pos: p.Shape(n.Raw).Start})
+	}
+	return keys
+}
+
+func record(positions map[string]tomlPosition, path []string, pos tomlPosition) {
+	key := tomlPath(path)
+	if _, ok := positions[key]; !ok {
+		positions[key] = pos
+	}
+}
+
+// tomlPath joins a key path with a separator that cannot appear in a key
+// unescaped.
+func tomlPath(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// tomlBuilder converts decoded TOML values to YAML nodes, placing each
+// node at the position of the key that holds it.
+type tomlBuilder struct {
+	positions map[string]tomlPosition
+}
+
+func (b tomlBuilder) node(v any, path []string, pos tomlPosition) *yaml.Node {
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: pos.Line, Column: pos.Column}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		return b.mapping(v, path, pos)
+	case []any:
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: pos.Line, Column: pos.Column}
+		for i, item := range v {
+			itemPath := append(slices.Clone(path), strconv.Itoa(i))
+			itemPos := pos
+			if p, ok := b.positions[tomlPath(itemPath)]; ok {
+				itemPos = p
+			}
+			seq.Content = append(seq.Content, b.node(item, itemPath, itemPos))
+		}
+		return seq
+	case string:
+		return stringNode(v, pos.Line, pos.Column)
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(v))
+	case int64:
+		return scalar("!!int", strconv.FormatInt(v, 10))
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return scalar("!!float", ".inf")
+		case math.IsInf(v, -1):
+			return scalar("!!float", "-.inf")
+		case math.IsNaN(v):
+			return scalar("!!float", ".nan")
+		}
+		return scalar("!!float", strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		return stringNode(v.Format(time.RFC3339Nano), pos.Line, pos.Column)
+	case fmt.Stringer: // local dates and times
+		return stringNode(v.String(), pos.Line, pos.Column)
+	default:
+		return stringNode(fmt.Sprint(v), pos.Line, pos.Column)
+	}
+}
+
+// mapping converts a table, ordering keys as they appear in the document.
+func (b tomlBuilder) mapping(m map[string]any, path []string, pos tomlPosition) *yaml.Node {
+	type entry struct {
+		key string
+		pos tomlPosition
+	}
+
+	entries := make([]entry, 0, len(m))
+	for k := range m {
+		p, ok := b.positions[tomlPath(append(slices.Clone(path), k))]
+		if !ok {
+			p = pos
+		}
+		entries = append(entries, entry{k, p})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		if a.pos.Offset != b.pos.Offset {
+			return a.pos.Offset - b.pos.Offset
+		}
+		return strings.Compare(a.key, b.key)
+	})
+
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: pos.Line, Column: pos.Column}
+	for _, e := range entries {
+		keyPath := append(slices.Clone(path), e.key)
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: e.key, Line: e.pos.Line, Column: e.pos.Column},
+			b.node(m[e.key], keyPath, e.pos),
+		)
+	}
+	return node
+}
+
+// stringNode returns a string scalar. Strings with ${...} are left plain so
+// interpolation can re-resolve them, as it does for YAML (port = "${PORT}").
+func stringNode(s string, line, col int) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s, Line: line, Column: col}
+	if !strings.Contains(s, "${") {
+		n.Style = yaml.DoubleQuotedStyle
+	}
+	return n
+}
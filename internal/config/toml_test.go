@@ -0,0 +1,133 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{
+			"scalars",
+			"s = \"a\\tb\\u00e9\"\nl = 'C:\\path'\ni = 1_000\nh = 0xff\nf = 1.5e3\nb = true\n",
+			map[string]any{"s": "a\tbé", "l": `C:\path`, "i": 1000, "h": 255, "f": 1500.0, "b": true},
+		},
+		{
+			"multi-line strings",
+			"a = \"\"\"\nline one\nline two\\\n    continued\"\"\"\nb = '''\nraw \\n'''\n",
+			map[string]any{"a": "line one\nline twocontinued", "b": "raw \\n"},
+		},
+		{
+			"tables and dotted keys",
+			"top = 1\n[a.b]\nc = 2\nd.e = 3\n[a]\nx = 4\n",
+			map[string]any{"top": 1, "a": map[string]any{"b": map[string]any{"c": 2, "d": map[string]any{"e": 3}}, "x": 4}},
+		},
+		{
+			"quoted keys",
+			"[env]\n\"MY.KEY\" = \"v\"\n",
+			map[string]any{"env": map[string]any{"MY.KEY": "v"}},
+		},
+		{
+			"arrays and inline tables",
+			"a = [1, 2,\n  3, # comment\n]\nt = { x = 1, y.z = \"w\" }\n",
+			map[string]any{"a": []any{1, 2, 3}, "t": map[string]any{"x": 1, "y": map[string]any{"z": "w"}}},
+		},
+		{
+			"dates as strings",
+			"d = 1979-05-27\nt = 1979-05-27T07:32:00Z\n",
+			map[string]any{"d": "1979-05-27", "t": "1979-05-27T07:32:00Z"},
+		},
+		{
+			"array of tables",
+			"[[p]]\nn = 1\n[p.sub]\nk = true\n[[p]]\nn = 2\n",
+			map[string]any{"p": []any{
+				map[string]any{"n": 1, "sub": map[string]any{"k": true}},
+				map[string]any{"n": 2},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseTOML([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got map[string]any
+			if err := node.Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{"duplicate key", "a = 1\na = 2\n", "already defined"},
+		{"duplicate table", "[a]\n[a]\n", "already exists"},
+		{"value as table", "a = 1\n[a.b]\n", "to be a table"},
+		{"unterminated string", "a = \"x\n", "line 1, column 7"},
+		{"missing equals", "a 1\n", "expected character ="},
+		{"trailing garbage", "a = 1 2\n", "expected newline"},
+		{"leading zero", "n = 012\n", "line 1, column 6"},
+		{"bad escape", "s = \"\\q\"\n", "invalid escape"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.src))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	want, err := Load("testdata/formats/lokl.yaml")
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+
+	for _, path := range []string{"testdata/formats/lokl.json", "testdata/formats/lokl.toml"} {
+		t.Run(path, func(t *testing.T) {
+			got, err := Load(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Services, want.Services) {
+				t.Errorf("services = %+v\nwant %+v", got.Services, want.Services)
+			}
+			if got.Proxy.Domain != want.Proxy.Domain || !reflect.DeepEqual(got.Env, want.Env) {
+				t.Errorf("proxy/env = %+v %v, want %+v %v", got.Proxy, got.Env, want.Proxy, want.Env)
+			}
+		})
+	}
+}
+
+func TestTOMLIssuePositions(t *testing.T) {
+	_, issues, err := LoadAll("testdata/formats/lokl.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `testdata/formats/lokl.toml:13:1: warning: service "api": dependency "db" has autostart disabled and will not start with a plain lokl up`
+	if len(issues) != 1 || issues[0].String() != want {
+		t.Errorf("issues = %v, want [%s]", issues, want)
+	}
+}
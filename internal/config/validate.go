@@ -1,86 +1,232 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
+// Severity classifies a validation issue.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Issue is a single validation finding. Path is the location in the config
+// (e.g. services, api, port); File, Line and Column are filled in when the
+// config was loaded from disk.
+type Issue struct {
+	Severity Severity
+	Path     []string
+	Message  string
+
+	File   string
+	Line   int
+	Column int
+}
+
+func (i Issue) String() string {
+	if i.File == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.File, i.Line, i.Column, i.Severity, i.Message)
+}
+
+// Issues is a list of validation findings.
+type Issues []Issue
+
+// Errors returns only the error-severity issues.
+func (is Issues) Errors() Issues {
+	return is.filter(SeverityError)
+}
+
+// Warnings returns only the warning-severity issues.
+func (is Issues) Warnings() Issues {
+	return is.filter(SeverityWarning)
+}
+
+func (is Issues) filter(sev Severity) Issues {
+	var out Issues
+	for _, i := range is {
+		if i.Severity == sev {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Err joins all error-severity issues, or returns nil if there are none.
+func (is Issues) Err() error {
+	var errs []error
+	for _, i := range is.Errors() {
+		errs = append(errs, errors.New(i.Message))
+	}
+	return errors.Join(errs...)
+}
+
+// sortByPosition orders located issues by file, line and column. Issues
+// without a position keep their relative order at the front.
+func (is Issues) sortByPosition() {
+	sort.SliceStable(is, func(i, j int) bool {
+		a, b := is[i], is[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+type validator struct {
+	issues Issues
+}
+
+func (v *validator) errorf(path []string, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: SeverityError, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(path []string, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate returns an error describing every problem in cfg.
 func Validate(cfg *Config) error {
+	return ValidateAll(cfg).Err()
+}
+
+// ValidateAll returns every error and warning in cfg, sorted by path.
+func ValidateAll(cfg *Config) Issues {
+	v := &validator{}
+
 	if cfg.Name == "" {
-		return fmt.Errorf("name is required")
+		v.errorf([]string{"name"}, "name is required")
 	}
 
 	if len(cfg.Services) == 0 {
-		return fmt.Errorf("at least one service is required")
+		v.errorf([]string{"services"}, "at least one service is required")
 	}
 
 	for name, svc := range cfg.Services {
 		if svc.Subdomain != "" && cfg.Proxy.Domain == "" {
-			return fmt.Errorf("service %q has subdomain but proxy.domain is not configured", name)
+			v.errorf(servicePath(name, "subdomain"), "service %q has subdomain but proxy.domain is not configured", name)
 		}
 	}
 
-	if err := checkDuplicatePorts(cfg.Services); err != nil {
-		return err
+	validateProxy(v, cfg.Proxy)
+
+	checkDuplicatePorts(v, cfg.Services)
+	checkDuplicateRoutes(v, cfg)
+
+	if err := validateDiscovery(cfg.Discovery); err != nil {
+		v.errorf([]string{"discovery", "templates"}, "%v", err)
 	}
 
 	for name, svc := range cfg.Services {
-		if err := validateService(name, &svc, cfg.Services); err != nil {
-			return err
-		}
+		validateService(v, name, &svc, cfg.Services)
+		validateRoutes(v, name, &svc, cfg.Proxy.Domain)
+		validateRewrite(v, name, svc.Rewrite)
 	}
 
-	return nil
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		return strings.Join(v.issues[i].Path, ".") < strings.Join(v.issues[j].Path, ".")
+	})
+	return v.issues
+}
+
+func servicePath(name string, field ...string) []string {
+	return append([]string{"services", name}, field...)
 }
 
-func checkDuplicatePorts(services map[string]Service) error {
+func checkDuplicatePorts(v *validator, services map[string]Service) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	portToService := make(map[int]string)
-	for name, svc := range services {
+	for _, name := range names {
+		svc := services[name]
 		if svc.Port == 0 {
 			continue
 		}
 		if existing, exists := portToService[svc.Port]; exists {
-			return fmt.Errorf("services %q and %q both use port %d", existing, name, svc.Port)
+			v.errorf(servicePath(name, "port"), "services %q and %q both use port %d", existing, name, svc.Port)
+			continue
 		}
 		portToService[svc.Port] = name
 	}
-	return nil
 }
 
-func validateService(name string, svc *Service, services map[string]Service) error {
+func validateService(v *validator, name string, svc *Service, services map[string]Service) {
 	hasCommand := svc.Command != ""
 	hasImage := svc.Image != ""
 
 	if !hasCommand && !hasImage {
-		return fmt.Errorf("service %q: command or image is required", name)
+		v.errorf(servicePath(name), "service %q: command or image is required", name)
 	}
 	if hasCommand && hasImage {
-		return fmt.Errorf("service %q: cannot specify both command and image", name)
+		v.errorf(servicePath(name, "image"), "service %q: cannot specify both command and image", name)
 	}
 
-	if svc.Subdomain != "" && svc.Port == 0 {
-		return fmt.Errorf("service %q: port is required when subdomain is set", name)
+	if svc.PortRange != nil {
+		if err := validatePortRange(name, svc.PortRange); err != nil {
+			v.errorf(servicePath(name, "port"), "%v", err)
+		}
+	}
+
+	if svc.Subdomain != "" && !svc.HasPort() {
+		v.errorf(servicePath(name, "subdomain"), "service %q: port is required when subdomain is set", name)
 	}
 
-	if svc.Health != nil && svc.Health.Path != "" && svc.Port == 0 {
-		return fmt.Errorf("service %q: port is required when health check is configured", name)
+	if svc.Health != nil && svc.Health.Path != "" && !svc.HasPort() {
+		v.errorf(servicePath(name, "health"), "service %q: port is required when health check is configured", name)
 	}
 
 	for _, dep := range svc.DependsOn {
-		if _, exists := services[dep]; !exists {
-			return fmt.Errorf("service %q: depends_on references unknown service %q", name, dep)
+		depSvc, exists := services[dep]
+		if !exists {
+			v.errorf(servicePath(name, "depends_on"), "service %q: depends_on references unknown service %q", name, dep)
+			continue
+		}
+		autostart := svc.AutoStart == nil || *svc.AutoStart
+		if autostart && depSvc.AutoStart != nil && !*depSvc.AutoStart {
+			v.warnf(servicePath(name, "depends_on"), "service %q: dependency %q has autostart disabled and will not start with a plain lokl up", name, dep)
 		}
 	}
 
 	if svc.Health != nil {
-		if err := validateHealth(name, svc.Health); err != nil {
-			return err
-		}
+		validateHealth(v, name, svc.Health)
 	}
 
 	if svc.ReadyTimeout != "" {
 		if _, err := time.ParseDuration(svc.ReadyTimeout); err != nil {
-			return fmt.Errorf("service %q: invalid ready_timeout %q: %w", name, svc.ReadyTimeout, err)
+			v.errorf(servicePath(name, "ready_timeout"), "service %q: invalid ready_timeout %q: %v", name, svc.ReadyTimeout, err)
+		}
+	}
+
+	if svc.Shell.IsNone() && len(svc.Command) > 0 {
+		if _, err := SplitArgs(svc.Command); err != nil {
+			v.errorf(servicePath(name, "command"), "service %q: invalid command for shell none: %v", name, err)
+		}
+	}
+
+	if svc.EnvFrom != "" {
+		if _, err := SplitArgs(svc.EnvFrom); err != nil {
+			v.errorf(servicePath(name, "env_from"), "service %q: invalid env_from %q: %v", name, svc.EnvFrom, err)
 		}
 	}
 
@@ -88,25 +234,21 @@ func validateService(name string, svc *Service, services map[string]Service) err
 		switch svc.Restart {
 		case restartAlways, restartOnFailure, restartNever:
 		default:
-			return fmt.Errorf("service %q: invalid restart policy %q (must be %s, %s, or %s)", name, svc.Restart, restartAlways, restartOnFailure, restartNever)
+			v.errorf(servicePath(name, "restart"), "service %q: invalid restart policy %q (must be %s, %s, or %s)", name, svc.Restart, restartAlways, restartOnFailure, restartNever)
 		}
 	}
-
-	return nil
 }
 
-func validateHealth(svcName string, h *HealthConfig) error {
+func validateHealth(v *validator, svcName string, h *HealthConfig) {
 	if h.Interval != "" {
 		if _, err := time.ParseDuration(h.Interval); err != nil {
-			return fmt.Errorf("service %q: invalid health.interval %q: %w", svcName, h.Interval, err)
+			v.errorf(servicePath(svcName, "health", "interval"), "service %q: invalid health.interval %q: %v", svcName, h.Interval, err)
 		}
 	}
 
 	if h.Timeout != "" {
 		if _, err := time.ParseDuration(h.Timeout); err != nil {
-			return fmt.Errorf("service %q: invalid health.timeout %q: %w", svcName, h.Timeout, err)
+			v.errorf(servicePath(svcName, "health", "timeout"), "service %q: invalid health.timeout %q: %v", svcName, h.Timeout, err)
 		}
 	}
-
-	return nil
 }
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config version this build of lokl writes and
+// understands natively. Older versions are migrated on load.
+const CurrentVersion = 2
+
+// defaultVersion is assumed for files without a version key, which predate
+// versioning.
+const defaultVersion = 1
+
+// migration upgrades a config document from version from to from+1. apply
+// edits the node in place and reports whether anything changed; it must be
+// safe to run on any file of the composition, including included files
+// that hold only some sections.
+type migration struct {
+	from        int
+	description string
+	apply       func(root *yaml.Node) bool
+}
+
+// migrations lists every upgrade step, oldest first.
+var migrations = []migration{
+	{
+		from:        1,
+		description: `restart: "no" is renamed to restart: never`,
+		apply:       migrateRestartNo,
+	},
+}
+
+// parseVersion parses a version value; an empty value means the file
+// predates versioning.
+func parseVersion(s string) (int, error) {
+	if s == "" {
+		return defaultVersion, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid config version %q", s)
+	}
+	if v > CurrentVersion {
+		return 0, fmt.Errorf("config version %d is newer than this lokl supports (%d); upgrade lokl", v, CurrentVersion)
+	}
+	return v, nil
+}
+
+// upgrade applies every migration from version from onwards to root and
+// reports whether anything changed.
+func upgrade(root *yaml.Node, from int) bool {
+	changed := false
+	for _, m := range migrations {
+		if m.from >= from && m.apply(root) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// documentVersion reads the version key of a composed or single-file
+// document.
+func documentVersion(root *yaml.Node) (int, error) {
+	n := mapGet(root, "version")
+	if n == nil {
+		return parseVersion("")
+	}
+	return parseVersion(n.Value)
+}
+
+// Migrate rewrites the config at path, and every file it includes or is
+// overridden by, to CurrentVersion. It returns the files that changed and
+// the migrations applied.
+//
+// Changed files are re-encoded as a whole: comments are kept, but quoting,
+// blank lines, indentation and flow style are normalized throughout the
+// file, not only where a migration applied.
+func Migrate(path string) (changed, applied []string, err error) {
+	root, err := readMapping(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := documentVersion(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if from == CurrentVersion {
+		return nil, nil, nil
+	}
+
+	doc, err := loadDocument(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []string
+	for _, file := range doc.files {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if ext := filepath.Ext(file); ext == extJSON || ext == extTOML {
+			return nil, nil, fmt.Errorf("%s: only YAML files can be migrated automatically; update it by hand", file)
+		}
+		files = append(files, file)
+	}
+
+	for _, file := range files {
+		ok, err := migrateFile(file, from, file == path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			changed = append(changed, file)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.from >= from {
+			applied = append(applied, m.description)
+		}
+	}
+	return changed, applied, nil
+}
+
+// migrateFile upgrades a single file in place. The version key is only
+// written to the main config. The file is re-encoded from its node tree,
+// so formatting is normalized; see Migrate.
+func migrateFile(path string, from int, main bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, nil
+	}
+	root := doc.Content[0]
+
+	changed := upgrade(root, from)
+	if main {
+		setVersion(root, CurrentVersion)
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return false, fmt.Errorf("encoding %s: %w", path, err)
+	}
+	if err := enc.Close(); err != nil {
+		return false, fmt.Errorf("encoding %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("reading config file: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return true, nil
+}
+
+func setVersion(root *yaml.Node, version int) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strconv.Itoa(version), Style: yaml.DoubleQuotedStyle}
+
+	if idx := mapIndex(root, "version"); idx != -1 {
+		old := root.Content[idx+1]
+		value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		root.Content[idx+1] = value
+		return
+	}
+
+	// Place the version right after name.
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	at := 0
+	if idx := mapIndex(root, "name"); idx != -1 {
+		at = idx + 2
+	}
+	root.Content = slices.Insert(root.Content, at, key, value)
+}
+
+// migrateRestartNo renames the restart policy "no", which early docs used,
+// to "never".
+func migrateRestartNo(root *yaml.Node) bool {
+	changed := false
+	for _, section := range []string{"services", templatesKey} {
+		services := mapGet(root, section)
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(services.Content); i += 2 {
+			if restart := mapGet(services.Content[i], "restart"); restart != nil && restart.Value == "no" {
+				restart.Value = restartNever
+				restart.Tag = "!!str"
+				restart.Style = 0
+				changed = true
+			}
+		}
+	}
+	return changed
+}
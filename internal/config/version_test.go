@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"1", 1, false},
+		{"2", 2, false},
+		{"0", 0, true},
+		{"v2", 0, true},
+		{"99", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseVersion(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseVersion(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigratesInMemory(t *testing.T) {
+	cfg, issues, err := LoadAll("testdata/migrate/lokl.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := issues.Err(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	if cfg.Version != "2" {
+		t.Errorf("version = %q, want %q", cfg.Version, "2")
+	}
+	for _, name := range []string{"api", "worker"} {
+		if got := cfg.Services[name].Restart; got != restartNever {
+			t.Errorf("%s restart = %q, want %q", name, got, restartNever)
+		}
+	}
+
+	found := false
+	for _, w := range issues.Warnings() {
+		found = found || strings.Contains(w.Message, "run lokl config migrate")
+	}
+	if !found {
+		t.Error("expected an outdated version warning")
+	}
+}
+
+func TestLoadRejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lokl.yaml")
+	writeFile(t, path, "name: future\nversion: \"99\"\nservices:\n  api:\n    command: x\n")
+
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for newer config version")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"lokl.yaml", "workers.yaml"} {
+		data, err := os.ReadFile(filepath.Join("testdata/migrate", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(dir, name), string(data))
+	}
+	path := filepath.Join(dir, "lokl.yaml")
+
+	changed, applied, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(changed) != 2 {
+		t.Errorf("changed = %v, want both files", changed)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("applied = %v, want %d migrations", applied, len(migrations))
+	}
+
+	main := readFile(t, path)
+	for _, want := range []string{"# Project settings", "# dev server", `version: "2"`, "restart: never"} {
+		if !strings.Contains(main, want) {
+			t.Errorf("lokl.yaml missing %q:\n%s", want, main)
+		}
+	}
+	if strings.Index(main, "name:") > strings.Index(main, "version:") {
+		t.Errorf("version should follow name:\n%s", main)
+	}
+
+	workers := readFile(t, filepath.Join(dir, "workers.yaml"))
+	if !strings.Contains(workers, "# never bring it back up") || !strings.Contains(workers, "restart: never") {
+		t.Errorf("workers.yaml not migrated:\n%s", workers)
+	}
+	if strings.Contains(workers, "version") {
+		t.Errorf("included file should not get a version:\n%s", workers)
+	}
+
+	changed, _, err = Migrate(path)
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("second Migrate changed %v, want nothing", changed)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
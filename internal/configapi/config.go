@@ -0,0 +1,155 @@
+// Package configapi defines the types of the public config API and converts
+// them to and from lokl's internal config. pkg/config re-exports the types,
+// and pkg/lokl converts with ToInternal before running a config.
+package configapi
+
+// Config is a lokl configuration, as in lokl.yaml.
+type Config struct {
+	Name      string
+	Version   string
+	Proxy     ProxyConfig
+	Discovery DiscoveryConfig
+	Shell     Shell
+	EnvFrom   string
+	EnvFile   StringList
+	Env       map[string]string
+	Services  map[string]Service
+
+	// Files lists every file a loaded config was composed from, including
+	// override files that do not exist yet.
+	Files []string
+	// Dir is the absolute directory of the config file. Service paths, env
+	// files and the .lokl state directory are relative to it. Load sets it;
+	// for a config built in code, lokl.Options.Dir or the working directory
+	// is used when it is empty.
+	Dir string
+}
+
+// ProxyConfig configures the HTTPS proxy (proxy in lokl.yaml).
+type ProxyConfig struct {
+	Domain string
+	HTTPS  *bool
+	// CA is CALokl or CAMkcert.
+	CA string
+	// HTTPRedirect adds a :80 listener that redirects to HTTPS.
+	HTTPRedirect bool
+	// Listen is the address the proxy binds, as host:port or a bare port.
+	Listen string
+	// PublicPort is the port browsers connect to when a forwarding rule
+	// sends it to Listen. It defaults to the listen port.
+	PublicPort int
+	// DNS is DNSHosts (the default) or DNSServer.
+	DNS string
+	// Shared registers the project's routes with the machine-wide proxy
+	// daemon instead of running a proxy of its own.
+	Shared bool
+	// RemotePort is the HTTPS port of the remote environment services are
+	// toggled to. It defaults to 443.
+	RemotePort int
+}
+
+// DiscoveryConfig controls the service discovery env vars.
+type DiscoveryConfig struct {
+	Enabled *bool
+	// Templates maps env name templates to value templates, rendered once per
+	// service, e.g. "VITE_{{.Name}}_URL": "{{.URL}}".
+	Templates map[string]string
+}
+
+// Service is one entry of services in lokl.yaml.
+type Service struct {
+	Command string
+	Image   string
+	Path    string
+
+	// Shell overrides the project shell; "none" runs the command as a plain argv.
+	Shell Shell
+	// EnvFrom is a wrapper command (e.g. "direnv exec .") whose environment
+	// is captured and used as the base environment for the service.
+	EnvFrom string
+
+	Port int
+	// PortRange is set for "port: auto" or "port: min-max"; the port is
+	// allocated when the service starts.
+	PortRange *PortRange
+	Subdomain string
+	// Hosts are more names the service answers on, as subdomains or full
+	// domains. A leading "*." matches any single label.
+	Hosts []string
+	// Routes mount the service under path prefixes of proxy hosts.
+	Routes []RouteConfig
+
+	Rewrite *RewriteConfig
+
+	EnvFile StringList
+	Env     map[string]string
+
+	DependsOn []string
+	Profiles  []string
+
+	Health *HealthConfig
+
+	AutoStart    *bool
+	Restart      string
+	ReadyTimeout string
+
+	Volumes []string
+	Ports   []string
+
+	Limits *LimitsConfig
+}
+
+// PortRange describes a port picked at start time. A zero range means any
+// free port chosen by the OS ("port: auto").
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// RouteConfig mounts a service under a path of a host, so several services
+// can share one origin.
+type RouteConfig struct {
+	// Host is a subdomain or full domain, like Subdomain. It defaults to
+	// the service's subdomain.
+	Host       string
+	PathPrefix string
+	// StripPrefix removes PathPrefix before the request is forwarded.
+	StripPrefix bool
+}
+
+// RewriteConfig changes request paths before they reach the service.
+type RewriteConfig struct {
+	StripPrefix string
+	Fallback    string
+	// Rules run in order after StripPrefix and before Fallback.
+	Rules []RewriteRule
+}
+
+// RewriteRule rewrites, redirects or falls back requests whose path
+// matches Match. Exactly one of Rewrite, Redirect and Fallback is set.
+type RewriteRule struct {
+	Match      string
+	Rewrite    string
+	Redirect   string
+	Status     int
+	Fallback   string
+	Except     []string
+	OnNotFound bool
+}
+
+type HealthConfig struct {
+	Path     string
+	Interval string
+	Timeout  string
+	Retries  *int
+}
+
+type LimitsConfig struct {
+	Memory string
+}
+
+// Shell is the argv prefix used to run a service command, e.g. ["bash", "-lc"].
+type Shell []string
+
+// StringList is a list written as a single string or a list in lokl.yaml.
+type StringList []string
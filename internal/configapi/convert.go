@@ -0,0 +1,162 @@
+package configapi
+
+import "github.com/shahin-bayat/lokl/internal/config"
+
+// The public types mirror the internal ones field for field. Types without
+// nested config types are converted directly, so a field added on one side
+// only fails to compile here.
+
+// ToInternal converts cfg to lokl's internal config.
+func ToInternal(cfg *Config) *config.Config {
+	return &config.Config{
+		Name:      cfg.Name,
+		Version:   cfg.Version,
+		Proxy:     config.ProxyConfig(cfg.Proxy),
+		Discovery: config.DiscoveryConfig(cfg.Discovery),
+		Shell:     config.Shell(cfg.Shell),
+		EnvFrom:   cfg.EnvFrom,
+		EnvFile:   config.StringList(cfg.EnvFile),
+		Env:       cfg.Env,
+		Services:  ServicesToInternal(cfg.Services),
+		Files:     cfg.Files,
+		Dir:       cfg.Dir,
+	}
+}
+
+// FromInternal converts an internal config to the public types.
+func FromInternal(cfg *config.Config) *Config {
+	c := &Config{
+		Name:      cfg.Name,
+		Version:   cfg.Version,
+		Proxy:     ProxyConfig(cfg.Proxy),
+		Discovery: DiscoveryConfig(cfg.Discovery),
+		Shell:     Shell(cfg.Shell),
+		EnvFrom:   cfg.EnvFrom,
+		EnvFile:   StringList(cfg.EnvFile),
+		Env:       cfg.Env,
+		Files:     cfg.Files,
+		Dir:       cfg.Dir,
+	}
+	if cfg.Services != nil {
+		c.Services = make(map[string]Service, len(cfg.Services))
+		for name, svc := range cfg.Services {
+			c.Services[name] = fromInternalService(svc)
+		}
+	}
+	return c
+}
+
+// ServicesToInternal converts a services map to lokl's internal config.
+func ServicesToInternal(services map[string]Service) map[string]config.Service {
+	if services == nil {
+		return nil
+	}
+	out := make(map[string]config.Service, len(services))
+	for name, svc := range services {
+		out[name] = toInternalService(svc)
+	}
+	return out
+}
+
+func toInternalService(svc Service) config.Service {
+	return config.Service{
+		Command:      svc.Command,
+		Image:        svc.Image,
+		Path:         svc.Path,
+		Shell:        config.Shell(svc.Shell),
+		EnvFrom:      svc.EnvFrom,
+		Port:         svc.Port,
+		PortRange:    (*config.PortRange)(svc.PortRange),
+		Subdomain:    svc.Subdomain,
+		Hosts:        svc.Hosts,
+		Routes:       convertSlice(svc.Routes, func(r RouteConfig) config.RouteConfig { return config.RouteConfig(r) }),
+		Rewrite:      convertPtr(svc.Rewrite, toInternalRewrite),
+		EnvFile:      config.StringList(svc.EnvFile),
+		Env:          svc.Env,
+		DependsOn:    svc.DependsOn,
+		Profiles:     svc.Profiles,
+		Health:       (*config.HealthConfig)(svc.Health),
+		AutoStart:    svc.AutoStart,
+		Restart:      svc.Restart,
+		ReadyTimeout: svc.ReadyTimeout,
+		Volumes:      svc.Volumes,
+		Ports:        svc.Ports,
+		Limits:       (*config.LimitsConfig)(svc.Limits),
+	}
+}
+
+func fromInternalService(svc config.Service) Service {
+	return Service{
+		Command:      svc.Command,
+		Image:        svc.Image,
+		Path:         svc.Path,
+		Shell:        Shell(svc.Shell),
+		EnvFrom:      svc.EnvFrom,
+		Port:         svc.Port,
+		PortRange:    (*PortRange)(svc.PortRange),
+		Subdomain:    svc.Subdomain,
+		Hosts:        svc.Hosts,
+		Routes:       convertSlice(svc.Routes, func(r config.RouteConfig) RouteConfig { return RouteConfig(r) }),
+		Rewrite:      convertPtr(svc.Rewrite, fromInternalRewrite),
+		EnvFile:      StringList(svc.EnvFile),
+		Env:          svc.Env,
+		DependsOn:    svc.DependsOn,
+		Profiles:     svc.Profiles,
+		Health:       (*HealthConfig)(svc.Health),
+		AutoStart:    svc.AutoStart,
+		Restart:      svc.Restart,
+		ReadyTimeout: svc.ReadyTimeout,
+		Volumes:      svc.Volumes,
+		Ports:        svc.Ports,
+		Limits:       (*LimitsConfig)(svc.Limits),
+	}
+}
+
+func toInternalRewrite(rw RewriteConfig) config.RewriteConfig {
+	return config.RewriteConfig{
+		StripPrefix: rw.StripPrefix,
+		Fallback:    rw.Fallback,
+		Rules:       convertSlice(rw.Rules, func(r RewriteRule) config.RewriteRule { return config.RewriteRule(r) }),
+	}
+}
+
+func fromInternalRewrite(rw config.RewriteConfig) RewriteConfig {
+	return RewriteConfig{
+		StripPrefix: rw.StripPrefix,
+		Fallback:    rw.Fallback,
+		Rules:       convertSlice(rw.Rules, func(r config.RewriteRule) RewriteRule { return RewriteRule(r) }),
+	}
+}
+
+// IssuesFromInternal converts validation issues to the public types.
+func IssuesFromInternal(issues config.Issues) Issues {
+	return convertSlice(issues, func(i config.Issue) Issue {
+		return Issue{
+			Severity: Severity(i.Severity),
+			Path:     i.Path,
+			Message:  i.Message,
+			File:     i.File,
+			Line:     i.Line,
+			Column:   i.Column,
+		}
+	})
+}
+
+func convertSlice[S ~[]E, E, T any](s S, convert func(E) T) []T {
+	if s == nil {
+		return nil
+	}
+	out := make([]T, len(s))
+	for i, e := range s {
+		out[i] = convert(e)
+	}
+	return out
+}
+
+func convertPtr[E, T any](p *E, convert func(E) T) *T {
+	if p == nil {
+		return nil
+	}
+	t := convert(*p)
+	return &t
+}
@@ -0,0 +1,73 @@
+package configapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Severity classifies a validation issue.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Issue is a single validation finding. Path is the location in the config
+// (e.g. services, api, port); File, Line and Column are filled in when the
+// config was loaded from disk.
+type Issue struct {
+	Severity Severity
+	Path     []string
+	Message  string
+
+	File   string
+	Line   int
+	Column int
+}
+
+func (i Issue) String() string {
+	if i.File == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.File, i.Line, i.Column, i.Severity, i.Message)
+}
+
+// Issues is a list of validation findings.
+type Issues []Issue
+
+// Errors returns only the error-severity issues.
+func (is Issues) Errors() Issues {
+	return is.filter(SeverityError)
+}
+
+// Warnings returns only the warning-severity issues.
+func (is Issues) Warnings() Issues {
+	return is.filter(SeverityWarning)
+}
+
+func (is Issues) filter(sev Severity) Issues {
+	var out Issues
+	for _, i := range is {
+		if i.Severity == sev {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Err joins all error-severity issues, or returns nil if there are none.
+func (is Issues) Err() error {
+	var errs []error
+	for _, i := range is.Errors() {
+		errs = append(errs, errors.New(i.Message))
+	}
+	return errors.Join(errs...)
+}
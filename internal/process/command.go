@@ -0,0 +1,95 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+const envCaptureTimeout = 2 * time.Minute
+
+// commandArgs returns the argv used to run the service command.
+// With a shell, the command is exec'd so signals reach the service directly.
+func commandArgs(svc config.Service) ([]string, error) {
+	if svc.Shell.IsNone() {
+		args, err := config.SplitArgs(svc.Command)
+		if err != nil {
+			return nil, fmt.Errorf("parsing command: %w", err)
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty command")
+		}
+		return args, nil
+	}
+
+	shell := svc.Shell
+	if len(shell) == 0 {
+		shell = config.DefaultShell
+	}
+
+	args := make([]string, 0, len(shell)+1)
+	args = append(args, shell...)
+	return append(args, "exec "+svc.Command), nil
+}
+
+// envDumpScript prints every variable as KEY=VALUE followed by sep. awk's
+// ENVIRON is POSIX, unlike env -0, which macOS and BSD lack.
+const envDumpScript = `BEGIN { for (k in ENVIRON) printf "%s=%s%s", k, ENVIRON[k], sep }`
+
+// captureEnv runs the env_from wrapper with an environment dump appended and
+// returns the environment it produces, e.g. `direnv exec . awk ...` or
+// `nix develop -c awk ...`.
+func captureEnv(wrapper, dir string, base []string) ([]string, error) {
+	args, err := config.SplitArgs(wrapper)
+	if err != nil {
+		return nil, fmt.Errorf("parsing env_from: %w", err)
+	}
+	if len(args) == 0 {
+		return base, nil
+	}
+
+	// A random separator cannot collide with a value, even a multi-line one.
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("running env_from %q: %w", wrapper, err)
+	}
+	sep := "--lokl-env-" + hex.EncodeToString(token) + "--"
+	args = append(args, "awk", "-v", "sep="+sep, envDumpScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), envCaptureTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = base
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("running env_from %q: %w: %s", wrapper, err, msg)
+		}
+		return nil, fmt.Errorf("running env_from %q: %w", wrapper, err)
+	}
+
+	return parseEnv(out, sep), nil
+}
+
+// parseEnv splits KEY=VALUE entries separated by sep.
+func parseEnv(out []byte, sep string) []string {
+	var env []string
+	for entry := range strings.SplitSeq(string(out), sep) {
+		if strings.Contains(entry, "=") {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -20,11 +21,12 @@ const (
 )
 
 type Process struct {
-	name     string
-	config   config.Service
-	state    state
-	healthy  bool
-	onChange func()
+	name      string
+	config    config.Service
+	discovery map[string]string
+	state     state
+	healthy   bool
+	onChange  func()
 
 	cmd    *exec.Cmd
 	logs   *logs
@@ -33,12 +35,15 @@ type Process struct {
 	mu     sync.Mutex
 }
 
-func New(name string, cfg config.Service, onChange func()) *Process {
+// New creates a stopped process. discovery holds the service-discovery
+// variables injected beneath the service's own env.
+func New(name string, cfg config.Service, discovery map[string]string, onChange func()) *Process {
 	return &Process{
-		name:     name,
-		config:   cfg,
-		state:    stateStopped,
-		onChange: onChange,
+		name:      name,
+		config:    cfg,
+		discovery: discovery,
+		state:     stateStopped,
+		onChange:  onChange,
 	}
 }
 
@@ -62,6 +67,18 @@ func (p *Process) Logs() []string {
 }
 
 func (p *Process) Start() error {
+	args, err := commandArgs(p.config)
+	if err != nil {
+		return fmt.Errorf("process %s: %w", p.name, err)
+	}
+
+	// env_from can take a while, so the environment is built before
+	// locking; IsRunning and Stop stay responsive meanwhile.
+	env, err := p.buildEnv()
+	if err != nil {
+		return fmt.Errorf("process %s: %w", p.name, err)
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -77,14 +94,14 @@ func (p *Process) Start() error {
 
 	p.state = stateStarting
 
-	p.cmd = exec.Command("sh", "-c", "exec "+p.config.Command)
+	p.cmd = exec.Command(args[0], args[1:]...)
 	p.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	if p.config.Path != "" {
 		p.cmd.Dir = p.config.Path
 	}
 
-	p.cmd.Env = p.buildEnv()
+	p.cmd.Env = env
 
 	p.logs = newLogs(maxLogLines)
 	p.cmd.Stdout = p.logs
@@ -151,12 +168,47 @@ func (p *Process) Stop() error {
 	return nil
 }
 
-func (p *Process) buildEnv() []string {
+func (p *Process) buildEnv() ([]string, error) {
+	return Environ(p.config, p.discovery)
+}
+
+// Environ returns the environment a service runs with: the host
+// environment (or the one captured through env_from), then the discovery
+// variables, then the service's own env. Each key appears once, with the
+// value from the last of these that sets it.
+func Environ(svc config.Service, discovery map[string]string) ([]string, error) {
 	env := os.Environ()
-	for k, v := range p.config.Env {
+
+	if svc.EnvFrom != "" {
+		captured, err := captureEnv(svc.EnvFrom, svc.Path, env)
+		if err != nil {
+			return nil, err
+		}
+		env = captured
+	}
+
+	for k, v := range discovery {
+		env = append(env, k+"="+v)
+	}
+	for k, v := range svc.Env {
 		env = append(env, k+"="+v)
 	}
-	return env
+	return dedupEnv(env), nil
+}
+
+func dedupEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	index := make(map[string]int, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[key]; ok {
+			out[i] = kv
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, kv)
+	}
+	return out
 }
 
 func checkPortFree(port int) error {
@@ -1,6 +1,13 @@
 package process
 
-import "testing"
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
 
 func TestLineBuffer(t *testing.T) {
 	t.Run("basic write and read", func(t *testing.T) {
@@ -63,3 +70,91 @@ func TestStateString(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  config.Service
+		want []string
+	}{
+		{
+			name: "default shell",
+			svc:  config.Service{Command: "pnpm dev"},
+			want: []string{"sh", "-c", "exec pnpm dev"},
+		},
+		{
+			name: "login shell",
+			svc:  config.Service{Command: "pnpm dev", Shell: config.Shell{"bash", "-lc"}},
+			want: []string{"bash", "-lc", "exec pnpm dev"},
+		},
+		{
+			name: "no shell",
+			svc:  config.Service{Command: `node server.js --name "my app"`, Shell: config.Shell{"none"}},
+			want: []string{"node", "server.js", "--name", "my app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commandArgs(tt.svc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("commandArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	sep := "--lokl-env-0123--"
+	out := []byte("PATH=/usr/bin" + sep + "MULTI=a\nb" + sep + "EMPTY=" + sep + "garbage" + sep)
+
+	got := parseEnv(out, sep)
+	want := []string{"PATH=/usr/bin", "MULTI=a\nb", "EMPTY="}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseEnv() = %q, want %q", got, want)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("LOKL_TEST_HOST", "host")
+	t.Setenv("LOKL_TEST_SHARED", "host")
+
+	svc := config.Service{Env: map[string]string{"LOKL_TEST_SHARED": "service"}}
+	discovery := map[string]string{
+		"LOKL_TEST_SHARED": "discovery",
+		"LOKL_API_URL":     "http://localhost:3000",
+	}
+
+	env, err := Environ(svc, discovery)
+	if err != nil {
+		t.Fatalf("Environ() error: %v", err)
+	}
+
+	for _, want := range []string{"LOKL_TEST_HOST=host", "LOKL_TEST_SHARED=service", "LOKL_API_URL=http://localhost:3000"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("Environ() missing %q", want)
+		}
+	}
+	if n := len(slices.DeleteFunc(slices.Clone(env), func(kv string) bool {
+		return !strings.HasPrefix(kv, "LOKL_TEST_SHARED=")
+	})); n != 1 {
+		t.Errorf("LOKL_TEST_SHARED appears %d times, want 1", n)
+	}
+}
+
+func TestCaptureEnv(t *testing.T) {
+	base := []string{"PATH=" + os.Getenv("PATH"), "MULTI=a\nb=c", "EMPTY="}
+
+	env, err := captureEnv("env LOKL_TEST_WRAPPED=1", t.TempDir(), base)
+	if err != nil {
+		t.Fatalf("captureEnv() error: %v", err)
+	}
+	for _, want := range []string{"MULTI=a\nb=c", "EMPTY=", "LOKL_TEST_WRAPPED=1"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("captureEnv() = %q, missing %q", env, want)
+		}
+	}
+}
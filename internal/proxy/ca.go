@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+const (
+	caCertFile = "rootCA.pem"
+	caKeyFile  = "rootCA-key.pem"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 825 * 24 * time.Hour // the longest lifetime macOS and iOS accept
+)
+
+// CADir returns the directory holding lokl's root CA, shared by every
+// project of the current user.
+func CADir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding config directory: %w", err)
+	}
+	return filepath.Join(dir, "lokl", "ca"), nil
+}
+
+// localCA is lokl's built-in certificate authority. The root is created on
+// first use and kept in dir; it is only trusted once lokl trust installs it.
+type localCA struct {
+	dir    string
+	dirErr error
+
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newLocalCA() *localCA {
+	dir, err := CADir()
+	return &localCA{dir: dir, dirErr: err}
+}
+
+func (ca *localCA) certPath() string {
+	return filepath.Join(ca.dir, caCertFile)
+}
+
+func (ca *localCA) keyPath() string {
+	return filepath.Join(ca.dir, caKeyFile)
+}
+
+// ensureCA loads the root CA, creating it if it does not exist yet.
+func (ca *localCA) ensureCA() error {
+	if ca.dirErr != nil {
+		return ca.dirErr
+	}
+	if ca.cert != nil {
+		return nil
+	}
+
+	if !fileExists(ca.certPath()) {
+		return ca.create()
+	}
+	return ca.load()
+}
+
+func (ca *localCA) load() error {
+	certPEM, err := os.ReadFile(ca.certPath())
+	if err != nil {
+		return fmt.Errorf("reading CA certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(ca.keyPath())
+	if err != nil {
+		return fmt.Errorf("reading CA key: %w", err)
+	}
+
+	cert, err := parseCertPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", ca.certPath(), err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("parsing %s: no PEM data", ca.keyPath())
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", ca.keyPath(), err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("parsing %s: unsupported key type", ca.keyPath())
+	}
+
+	ca.cert, ca.key = cert, signer
+	return nil
+}
+
+func (ca *localCA) create() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	owner := caOwner()
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"lokl development CA"},
+			OrganizationalUnit: []string{owner},
+			CommonName:         "lokl " + owner,
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return fmt.Errorf("creating CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("creating CA certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(ca.dir, 0o755); err != nil {
+		return fmt.Errorf("creating CA directory: %w", err)
+	}
+	if err := writeKey(ca.keyPath(), key); err != nil {
+		return err
+	}
+	if err := writeCert(ca.certPath(), der); err != nil {
+		return err
+	}
+
+	ca.cert, ca.key = cert, key
+	return nil
+}
+
+// issue writes a certificate for names signed by the root CA.
+func (ca *localCA) issue(certPath, keyPath string, names []string) error {
+	if err := ca.ensureCA(); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"lokl development certificate"},
+			OrganizationalUnit: []string{caOwner()},
+		},
+		DNSNames:    names,
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(leafValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return fmt.Errorf("creating certificate: %w", err)
+	}
+
+	if err := writeKey(keyPath, key); err != nil {
+		return err
+	}
+	return writeCert(certPath, der)
+}
+
+// issued reports whether the certificate at certPath was signed by the
+// current root CA. Certificates from a deleted CA or from mkcert are not.
+func (ca *localCA) issued(certPath string) bool {
+	if ca.ensureCA() != nil {
+		return false
+	}
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return false
+	}
+	cert, err := parseCertPEM(data)
+	if err != nil {
+		return false
+	}
+	return cert.CheckSignatureFrom(ca.cert) == nil
+}
+
+// trusted reports whether the system verifier accepts the root CA.
+func (ca *localCA) trusted() bool {
+	if ca.dirErr != nil || !fileExists(ca.certPath()) || ca.ensureCA() != nil {
+		return false
+	}
+	_, err := ca.cert.Verify(x509.VerifyOptions{})
+	return err == nil
+}
+
+func parseCertPEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writeCert(path string, der []byte) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing certificate: %w", err)
+	}
+	return nil
+}
+
+func writeKey(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("encoding key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing key: %w", err)
+	}
+	return nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// caOwner names the user and machine a CA belongs to, so several lokl CAs
+// can be told apart in a trust store.
+func caOwner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalCAIssue(t *testing.T) {
+	ca := &localCA{dir: filepath.Join(t.TempDir(), "ca")}
+	certs := newCertManager(t.TempDir(), ca)
+
+	if err := ca.ensureCA(); err != nil {
+		t.Fatalf("ensureCA() error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	for _, name := range []string{"myapp.dev", "api.myapp.dev", "a.b.myapp.dev"} {
+		certPath, keyPath, err := certs.generate(name)
+		if err != nil {
+			t.Fatalf("generate(%q) error: %v", name, err)
+		}
+
+		pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			t.Fatalf("LoadX509KeyPair() error: %v", err)
+		}
+
+		if _, err := pair.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("Verify(%q) error: %v", name, err)
+		}
+	}
+
+	info, err := os.Stat(ca.keyPath())
+	if err != nil {
+		t.Fatalf("stat CA key: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("CA key permissions = %o, want 600", perm)
+	}
+}
+
+func TestLocalCAReuse(t *testing.T) {
+	caDir := filepath.Join(t.TempDir(), "ca")
+	certDir := t.TempDir()
+
+	certPath, _, err := newCertManager(certDir, &localCA{dir: caDir}).generate("myapp.dev")
+	if err != nil {
+		t.Fatalf("generate() error: %v", err)
+	}
+	first, _ := os.ReadFile(certPath)
+
+	// A second manager loads the persisted CA and keeps the certificate.
+	reloaded := &localCA{dir: caDir}
+	if _, _, err := newCertManager(certDir, reloaded).generate("myapp.dev"); err != nil {
+		t.Fatalf("generate() error: %v", err)
+	}
+	if second, _ := os.ReadFile(certPath); string(second) != string(first) {
+		t.Error("certificate from the same CA was reissued")
+	}
+
+	// A new CA cannot vouch for the old certificate, so it is replaced.
+	other := &localCA{dir: filepath.Join(t.TempDir(), "ca")}
+	if other.issued(certPath) {
+		t.Error("issued() = true for a certificate from another CA")
+	}
+	if _, _, err := newCertManager(certDir, other).generate("myapp.dev"); err != nil {
+		t.Fatalf("generate() error: %v", err)
+	}
+	if !other.issued(certPath) {
+		t.Error("certificate was not reissued by the new CA")
+	}
+}
@@ -1,77 +1,191 @@
 package proxy
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/config"
 )
 
+// certBackend issues certificates signed by a CA the browser trusts.
+type certBackend interface {
+	ensureCA() error
+	issue(certPath, keyPath string, names []string) error
+	// issued reports whether an existing certificate can be reused.
+	issued(certPath string) bool
+	trusted() bool
+}
+
+func newCertBackend(ca string) certBackend {
+	if ca == config.CAMkcert {
+		return mkcertBackend{}
+	}
+	return newLocalCA()
+}
+
+// renewBefore is how long before expiry a certificate is replaced.
+const renewBefore = 30 * 24 * time.Hour
+
+// certManager issues one certificate per server name on demand. Certificates
+// are kept in dir and in memory, and replaced when they near expiry or no
+// longer come from the backend's CA.
 type certManager struct {
-	dir string
+	dir     string
+	backend certBackend
+
+	mu    sync.Mutex
+	cache map[string]*tls.Certificate
 }
 
-func newCertManager(dir string) *certManager {
-	return &certManager{dir: dir}
+func newCertManager(dir string, backend certBackend) *certManager {
+	return &certManager{dir: dir, backend: backend, cache: make(map[string]*tls.Certificate)}
 }
 
 func (c *certManager) ensureCA() error {
-	if err := c.checkMkcert(); err != nil {
-		return err
-	}
+	return c.backend.ensureCA()
+}
 
-	cmd := exec.Command("mkcert", "-install")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// certificate returns the certificate for name, issuing it if needed.
+func (c *certManager) certificate(name string) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("installing mkcert CA: %w", err)
+	if cert, ok := c.cache[name]; ok && !expiring(cert.Leaf) {
+		return cert, nil
 	}
 
-	return nil
+	certPath, keyPath, err := c.generate(name)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+	c.cache[name] = &cert
+	return &cert, nil
 }
 
-func (c *certManager) generate(domain string) (certPath, keyPath string, err error) {
-	if err := c.checkMkcert(); err != nil {
-		return "", "", err
+// retain drops cached certificates for names that are no longer served.
+func (c *certManager) retain(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name := range c.cache {
+		if !slices.Contains(names, name) {
+			delete(c.cache, name)
+		}
 	}
+}
 
+// generate makes sure a valid certificate for name exists on disk.
+func (c *certManager) generate(name string) (certPath, keyPath string, err error) {
 	if err := os.MkdirAll(c.dir, 0o755); err != nil {
 		return "", "", fmt.Errorf("creating cert directory: %w", err)
 	}
 
-	certPath = c.certPath(domain)
-	keyPath = c.keyPath(domain)
+	certPath = c.certPath(name)
+	keyPath = c.keyPath(name)
 
-	if fileExists(certPath) && fileExists(keyPath) {
+	if fileExists(keyPath) && c.reusable(certPath, name) {
 		return certPath, keyPath, nil
 	}
 
-	wildcard := "*." + domain
-	cmd := exec.Command("mkcert",
-		"-cert-file", certPath,
-		"-key-file", keyPath,
-		wildcard, domain,
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", "", fmt.Errorf("generating certificate: %w", err)
+	if err := c.backend.issue(certPath, keyPath, []string{name}); err != nil {
+		return "", "", fmt.Errorf("generating certificate for %s: %w", name, err)
 	}
 
 	return certPath, keyPath, nil
 }
 
+// reusable reports whether the certificate at certPath covers name, is not
+// near expiry, and was issued by the current CA.
+func (c *certManager) reusable(certPath, name string) bool {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return false
+	}
+	cert, err := parseCertPEM(data)
+	if err != nil {
+		return false
+	}
+	return !expiring(cert) && cert.VerifyHostname(name) == nil && c.backend.issued(certPath)
+}
+
+func expiring(cert *x509.Certificate) bool {
+	return cert == nil || time.Until(cert.NotAfter) < renewBefore
+}
+
 func (c *certManager) certPath(domain string) string {
-	return filepath.Join(c.dir, domain+".pem")
+	return filepath.Join(c.dir, certFileName(domain)+".pem")
 }
 
 func (c *certManager) keyPath(domain string) string {
-	return filepath.Join(c.dir, domain+"-key.pem")
+	return filepath.Join(c.dir, certFileName(domain)+"-key.pem")
+}
+
+// certFileName keeps * out of file names: *.app.test -> _wildcard.app.test,
+// as mkcert names them.
+func certFileName(domain string) string {
+	return strings.Replace(domain, "*", "_wildcard", 1)
+}
+
+// mkcertBackend delegates to mkcert, which installs its own CA.
+type mkcertBackend struct{}
+
+func (mkcertBackend) ensureCA() error {
+	if err := checkMkcert(); err != nil {
+		return err
+	}
+
+	if err := runMkcert("-install"); err != nil {
+		return fmt.Errorf("installing mkcert CA: %w", err)
+	}
+
+	return nil
+}
+
+func (mkcertBackend) issue(certPath, keyPath string, names []string) error {
+	if err := checkMkcert(); err != nil {
+		return err
+	}
+
+	args := append([]string{"-cert-file", certPath, "-key-file", keyPath}, names...)
+	return runMkcert(args...)
+}
+
+func (mkcertBackend) issued(string) bool {
+	return true
+}
+
+// trusted is always true: ensureCA runs mkcert -install.
+func (mkcertBackend) trusted() bool {
+	return true
+}
+
+// runMkcert captures mkcert's output rather than writing it to the terminal,
+// which the TUI owns while certificates are issued on demand. The output is
+// only shown when mkcert fails.
+func runMkcert(args ...string) error {
+	out, err := exec.Command("mkcert", args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
 }
 
-func (c *certManager) checkMkcert() error {
+func checkMkcert() error {
 	_, err := exec.LookPath("mkcert")
 	if err != nil {
 		return fmt.Errorf("mkcert not found: install with 'brew install mkcert' or see https://github.com/FiloSottile/mkcert")
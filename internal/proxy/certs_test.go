@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+func TestCertificateRenewal(t *testing.T) {
+	ca := &localCA{dir: filepath.Join(t.TempDir(), "ca")}
+	certs := newCertManager(t.TempDir(), ca)
+	if err := ca.ensureCA(); err != nil {
+		t.Fatalf("ensureCA() error: %v", err)
+	}
+
+	// A certificate that expires within renewBefore is replaced.
+	name := "api.myapp.dev"
+	writeShortLivedCert(t, ca, certs.certPath(name), certs.keyPath(name), name)
+
+	cert, err := certs.certificate(name)
+	if err != nil {
+		t.Fatalf("certificate() error: %v", err)
+	}
+	if time.Until(cert.Leaf.NotAfter) < renewBefore {
+		t.Errorf("certificate expires %s, want it renewed", cert.Leaf.NotAfter)
+	}
+
+	again, err := certs.certificate(name)
+	if err != nil {
+		t.Fatalf("certificate() error: %v", err)
+	}
+	if again != cert {
+		t.Error("valid certificate was not served from the cache")
+	}
+
+	certs.retain(nil)
+	if len(certs.cache) != 0 {
+		t.Errorf("cache has %d entries after retain(nil), want 0", len(certs.cache))
+	}
+}
+
+func TestProxyGetCertificate(t *testing.T) {
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Domain: "myapp.dev"},
+		Services: map[string]config.Service{
+			"web":    {Subdomain: "app", Port: 5173},
+			"admin":  {Subdomain: "admin.tools.myapp.dev", Port: 4000},
+			"other":  {Subdomain: "other.test", Port: 3000},
+			"tenant": {Hosts: []string{"*.tenants"}, Port: 3001},
+		},
+	}
+	p := &Proxy{
+		cfg:    cfg,
+		router: newRouter(cfg),
+		certs:  newCertManager(t.TempDir(), &localCA{dir: filepath.Join(t.TempDir(), "ca")}),
+	}
+
+	tests := []struct {
+		serverName string
+		wantName   string
+		wantErr    bool
+	}{
+		{serverName: "app.myapp.dev", wantName: "app.myapp.dev"},
+		{serverName: "ADMIN.tools.myapp.dev.", wantName: "admin.tools.myapp.dev"},
+		{serverName: "other.test", wantName: "other.test"},
+		{serverName: "", wantName: "myapp.dev"},
+		{serverName: "acme.tenants.myapp.dev", wantName: "acme.tenants.myapp.dev"},
+		{serverName: "a.b.tenants.myapp.dev", wantErr: true},
+		{serverName: "unknown.myapp.dev", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := p.getCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("getCertificate() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getCertificate() error: %v", err)
+			}
+			if err := cert.Leaf.VerifyHostname(tt.wantName); err != nil {
+				t.Errorf("certificate does not cover %s: %v", tt.wantName, err)
+			}
+		})
+	}
+}
+
+func TestMkcertOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake mkcert is a shell script")
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{name: "success", script: "echo issued; exit 0"},
+		{name: "failure", script: "echo 'ERROR: no CA' >&2; exit 1", wantErr: "ERROR: no CA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := t.TempDir()
+			script := "#!/bin/sh\n" + tt.script + "\n"
+			if err := os.WriteFile(filepath.Join(bin, "mkcert"), []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", bin)
+
+			// Nothing may reach the terminal, which the TUI owns.
+			stdout, stderr := os.Stdout, os.Stderr
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			os.Stdout, os.Stderr = w, w
+			err = mkcertBackend{}.issue("cert.pem", "key.pem", []string{"app.test"})
+			os.Stdout, os.Stderr = stdout, stderr
+			_ = w.Close()
+			leaked, _ := io.ReadAll(r)
+
+			if len(leaked) > 0 {
+				t.Errorf("mkcert wrote %q to the terminal", leaked)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("issue() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("issue() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func writeShortLivedCert(t *testing.T, ca *localCA, certPath, keyPath, name string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKey(keyPath, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCert(certPath, der); err != nil {
+		t.Fatal(err)
+	}
+}
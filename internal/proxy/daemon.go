@@ -0,0 +1,523 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+const (
+	socketName    = "proxy.sock"
+	lockName      = "proxy.lock"
+	daemonLogName = "proxy.log"
+	// pruneInterval is how often the daemon drops projects whose lokl
+	// process has exited without deregistering.
+	pruneInterval = 5 * time.Second
+)
+
+// Registration is what a project registers with the shared proxy: its
+// routes, and the proxy settings its URLs assume.
+type Registration struct {
+	Project string `json:"project"`
+	// Dir identifies the project, so two checkouts of one project are
+	// registered separately.
+	Dir    string      `json:"dir"`
+	PID    int         `json:"pid"`
+	Domain string      `json:"domain"`
+	Addr   string      `json:"addr"`
+	HTTPS  bool        `json:"https"`
+	CA     string      `json:"ca"`
+	DNS    bool        `json:"dns"` // resolve Domain through the embedded DNS server
+	Routes []RouteInfo `json:"routes"`
+}
+
+// RouteInfo is one route of a registered project.
+type RouteInfo struct {
+	Service     string                `json:"service"`
+	Domain      string                `json:"domain"`
+	PathPrefix  string                `json:"path_prefix,omitempty"`
+	StripPrefix bool                  `json:"strip_prefix,omitempty"`
+	Port        int                   `json:"port"`
+	Enabled     bool                  `json:"enabled"`
+	Rewrite     *config.RewriteConfig `json:"rewrite,omitempty"`
+	RemotePort  int                   `json:"remote_port,omitempty"`
+}
+
+// SharedStatus describes a running shared proxy.
+type SharedStatus struct {
+	Addr     string         `json:"addr"`
+	HTTPS    bool           `json:"https"`
+	PID      int            `json:"pid"`
+	Projects []Registration `json:"projects"`
+}
+
+// DaemonDir returns the directory the shared proxy keeps its socket, log and
+// certificates in. The CA lives next to them.
+func DaemonDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locating config directory: %w", err)
+	}
+	return filepath.Join(dir, "lokl"), nil
+}
+
+// Daemon is the machine-wide proxy. It owns the listen address and the
+// certificates, and routes by host for every project registered over its
+// control socket.
+type Daemon struct {
+	cfg     config.ProxyConfig
+	dir     string
+	router  *router
+	certs   *certManager
+	dns     *dnsServer
+	servers []*http.Server
+	control *http.Server
+	host    string
+	port    int
+
+	mu       sync.Mutex
+	projects map[string]Registration // by Dir
+	done     chan struct{}
+	// owned is set once Run holds the daemon lock, so Stop only removes a
+	// socket this daemon created.
+	owned bool
+}
+
+// NewDaemon creates a shared proxy with the listen, https, http_redirect,
+// public_port, ca and dns settings of cfg. The domain is ignored; domains
+// come from registered projects.
+func NewDaemon(cfg config.ProxyConfig) (*Daemon, error) {
+	host, port, err := cfg.ListenAddr()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := DaemonDir()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Daemon{
+		cfg:      cfg,
+		dir:      dir,
+		router:   &router{},
+		certs:    newCertManager(filepath.Join(dir, certDirName), newCertBackend(cfg.CA)),
+		host:     host,
+		port:     port,
+		projects: make(map[string]Registration),
+		done:     make(chan struct{}),
+	}
+	if cfg.DNS != config.DNSHosts {
+		d.dns = newDNSServer(DNSServerAddr())
+	}
+	return d, nil
+}
+
+// Run binds the control socket, the proxy and the DNS server, and serves
+// until Stop is called or a listener fails.
+func (d *Daemon) Run() error {
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", d.dir, err)
+	}
+
+	// The lock is held until Run returns, so a second daemon cannot get
+	// past this point and remove the running daemon's socket.
+	unlock, err := lockDaemon(d.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	d.mu.Lock()
+	d.owned = true
+	d.mu.Unlock()
+
+	socket := filepath.Join(d.dir, socketName)
+	// Left over from a daemon that did not shut down cleanly.
+	_ = os.Remove(socket)
+	controlLn, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("binding %s: %w", socket, err)
+	}
+	if err := os.Chmod(socket, 0o600); err != nil {
+		_ = controlLn.Close()
+		return fmt.Errorf("binding %s: %w", socket, err)
+	}
+	d.control = &http.Server{Handler: d.controlHandler()}
+
+	if err := d.start(); err != nil {
+		_ = controlLn.Close()
+		_ = d.Stop()
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if err := d.control.Serve(controlLn); !errors.Is(err, http.ErrServerClosed) {
+			errc <- err
+		}
+	}()
+	go d.prune()
+
+	select {
+	case err := <-errc:
+		_ = d.Stop()
+		return err
+	case <-d.done:
+		return nil
+	}
+}
+
+// lockDaemon takes the exclusive daemon lock in dir without waiting. The
+// lock file is left in place; removing it would let two daemons lock
+// different files.
+func lockDaemon(dir string) (func(), error) {
+	path := filepath.Join(dir, lockName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("locking %s: %w", path, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("shared proxy is already running (%s is locked)", path)
+		}
+		return nil, fmt.Errorf("locking %s: %w", path, err)
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
+
+// start binds the proxy listeners and the DNS server.
+func (d *Daemon) start() error {
+	if d.cfg.HTTPSEnabled() {
+		if err := d.certs.ensureCA(); err != nil {
+			return fmt.Errorf("setting up CA: %w", err)
+		}
+	}
+
+	if d.dns != nil {
+		if err := d.dns.start(); err != nil {
+			return fmt.Errorf("starting DNS server: %w", err)
+		}
+	}
+
+	lns, err := listenHosts(d.cfg.ListenHosts(), d.port)
+	if err != nil {
+		return err
+	}
+
+	if !d.cfg.HTTPSEnabled() {
+		srv := &http.Server{Handler: newHandler(d.router, schemeHTTP)}
+		d.servers = append(d.servers, srv)
+		go func() { _ = serve(srv, lns, false) }()
+		return nil
+	}
+
+	if d.cfg.HTTPRedirect {
+		redirectLns, err := listenHosts(d.cfg.ListenHosts(), httpPort)
+		if err != nil {
+			closeAll(lns)
+			return fmt.Errorf("starting HTTP redirect: %w", err)
+		}
+		srv := &http.Server{Handler: newRedirectHandler(d.cfg.URLPort(), newHandler(d.router, schemeHTTP))}
+		d.servers = append(d.servers, srv)
+		go func() { _ = serve(srv, redirectLns, false) }()
+	}
+
+	srv := &http.Server{
+		Handler: newHandler(d.router, schemeHTTPS),
+		TLSConfig: &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return serveCertificate(d.certs, hello, "", d.serverNames())
+			},
+		},
+	}
+	d.servers = append(d.servers, srv)
+	go func() { _ = serve(srv, lns, true) }()
+	return nil
+}
+
+// Stop shuts the daemon down. Registered projects keep running but lose
+// their routes.
+func (d *Daemon) Stop() error {
+	var errs []error
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, srv := range append(d.servers, d.control) {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutting down server: %w", err))
+		}
+	}
+	if d.dns != nil {
+		if err := d.dns.stop(); err != nil {
+			errs = append(errs, fmt.Errorf("stopping DNS server: %w", err))
+		}
+	}
+	d.mu.Lock()
+	if d.owned {
+		_ = os.Remove(filepath.Join(d.dir, socketName))
+	}
+	select {
+	case <-d.done:
+	default:
+		close(d.done)
+	}
+	d.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// Addr returns the address the proxy listens on.
+func (d *Daemon) Addr() string {
+	return net.JoinHostPort(d.host, strconv.Itoa(d.port))
+}
+
+// register adds or replaces a project's routes. Settings the project's
+// URLs depend on must match the daemon's, and no host may be claimed by
+// two projects.
+func (d *Daemon) register(reg Registration) error {
+	if reg.Addr != d.Addr() {
+		return fmt.Errorf("shared proxy listens on %s but %s expects %s; stop it with lokl proxy stop or change proxy.listen", d.Addr(), reg.Project, reg.Addr)
+	}
+	if reg.HTTPS != d.cfg.HTTPSEnabled() {
+		return fmt.Errorf("shared proxy serves %s but %s uses %s; stop it with lokl proxy stop or change proxy.https", d.cfg.Scheme(), reg.Project, schemeOf(reg.HTTPS))
+	}
+	if reg.HTTPS && reg.CA != d.cfg.CA {
+		return fmt.Errorf("shared proxy issues certificates with %s but %s uses %s; stop it with lokl proxy stop or change proxy.ca", d.cfg.CA, reg.Project, reg.CA)
+	}
+	if reg.DNS && d.dns == nil {
+		return fmt.Errorf("shared proxy does not run the DNS server; set proxy.dns: hosts in %s", reg.Project)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for dir, other := range d.projects {
+		if dir == reg.Dir {
+			continue
+		}
+		if other.Domain == reg.Domain {
+			return servedError(reg.Domain, other)
+		}
+		for _, rt := range reg.Routes {
+			if slices.ContainsFunc(other.Routes, func(o RouteInfo) bool { return o.Domain == rt.Domain }) {
+				return servedError(rt.Domain, other)
+			}
+		}
+	}
+
+	d.projects[reg.Dir] = reg
+	d.rebuild()
+	return nil
+}
+
+// servedError reports a host another project holds. The lokl process and
+// directory tell two checkouts of the same project apart.
+func servedError(host string, other Registration) error {
+	return fmt.Errorf("%s is already served for %s by lokl (pid %d) in %s; stop it there first", host, other.Project, other.PID, other.Dir)
+}
+
+func (d *Daemon) deregister(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.projects, dir)
+	d.rebuild()
+}
+
+// rebuild replaces the routes and DNS zones from the registered projects.
+// The caller holds d.mu.
+func (d *Daemon) rebuild() {
+	var routes []*route
+	var zones []string
+	for _, reg := range d.projects {
+		hosts := make([]string, 0, len(reg.Routes))
+		for _, info := range reg.Routes {
+			routes = append(routes, routeFromInfo(info))
+			hosts = append(hosts, info.Domain)
+		}
+		if reg.DNS {
+			zones = append(zones, dnsZones(reg.Domain, hosts)...)
+		}
+	}
+	d.router.set("", routes)
+	if d.dns != nil {
+		d.dns.setZones(zones)
+	}
+	d.certs.retain(d.serverNamesLocked())
+}
+
+// prune drops projects whose lokl process has exited, so a crashed project
+// does not keep its hosts.
+func (d *Daemon) prune() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		changed := false
+		for dir, reg := range d.projects {
+			if !processAlive(reg.PID) {
+				delete(d.projects, dir)
+				changed = true
+			}
+		}
+		if changed {
+			d.rebuild()
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *Daemon) serverNames() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.serverNamesLocked()
+}
+
+// serverNamesLocked lists the routed domains and every project domain. The
+// caller holds d.mu.
+func (d *Daemon) serverNamesLocked() []string {
+	names := d.router.domains()
+	for _, reg := range d.projects {
+		if !slices.Contains(names, reg.Domain) {
+			names = append(names, reg.Domain)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (d *Daemon) status() SharedStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := SharedStatus{Addr: d.Addr(), HTTPS: d.cfg.HTTPSEnabled(), PID: os.Getpid()}
+	for _, reg := range d.projects {
+		status.Projects = append(status.Projects, reg)
+	}
+	slices.SortFunc(status.Projects, func(a, b Registration) int {
+		return cmp.Or(cmp.Compare(a.Project, b.Project), cmp.Compare(a.Dir, b.Dir))
+	})
+	return status
+}
+
+// controlHandler serves the control socket:
+//
+//	GET    /projects          status and registered projects
+//	PUT    /projects          register or update a project
+//	DELETE /projects?dir=...  deregister a project
+//	POST   /stop              shut the daemon down
+func (d *Daemon) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /projects", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d.status())
+	})
+
+	mux.HandleFunc("PUT /projects", func(w http.ResponseWriter, r *http.Request) {
+		var reg Registration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			http.Error(w, fmt.Sprintf("decoding registration: %v", err), http.StatusBadRequest)
+			return
+		}
+		if reg.Dir == "" {
+			http.Error(w, "registration has no dir", http.StatusBadRequest)
+			return
+		}
+		if err := d.register(reg); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /projects", func(w http.ResponseWriter, r *http.Request) {
+		d.deregister(r.URL.Query().Get("dir"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		// Shut down after this response is written.
+		go func() { _ = d.Stop() }()
+	})
+
+	return mux
+}
+
+// routeFromInfo rebuilds a registered route. Each gets its own backend:
+// the daemon never toggles services, it is sent their state instead.
+func routeFromInfo(info RouteInfo) *route {
+	b := &backend{service: info.Service}
+	b.port.Store(int64(info.Port))
+	b.enabled.Store(info.Enabled)
+	return &route{
+		backend:     b,
+		domain:      info.Domain,
+		pathPrefix:  info.PathPrefix,
+		stripPrefix: info.StripPrefix,
+		rewrite:     newRewrite(info.Rewrite),
+		remotePort:  info.RemotePort,
+	}
+}
+
+func routeInfo(rt *route) RouteInfo {
+	info := RouteInfo{
+		Service:     rt.service,
+		Domain:      rt.domain,
+		PathPrefix:  rt.pathPrefix,
+		StripPrefix: rt.stripPrefix,
+		Port:        int(rt.port.Load()),
+		Enabled:     rt.enabled.Load(),
+		RemotePort:  rt.remotePort,
+	}
+	if rt.rewrite != nil {
+		info.Rewrite = rt.rewrite.spec
+	}
+	return info
+}
+
+// processAlive reports whether pid is a running process. Signal 0 checks
+// without signalling; EPERM means it exists but belongs to another user.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func schemeOf(https bool) string {
+	if https {
+		return schemeHTTPS
+	}
+	return schemeHTTP
+}
@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+func newTestDaemon(t *testing.T) *Daemon {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	https := false
+	d, err := NewDaemon(config.ProxyConfig{HTTPS: &https, Listen: "127.0.0.1:8080", CA: config.CALokl, DNS: config.DNSHosts})
+	if err != nil {
+		t.Fatalf("NewDaemon() error: %v", err)
+	}
+	return d
+}
+
+func testRegistration(project, domain string, routes ...string) Registration {
+	reg := Registration{
+		Project: project,
+		Dir:     "/src/" + project,
+		PID:     os.Getpid(),
+		Domain:  domain,
+		Addr:    "127.0.0.1:8080",
+		CA:      config.CALokl,
+	}
+	for i, name := range routes {
+		reg.Routes = append(reg.Routes, RouteInfo{Domain: name, Port: 3000 + i, Enabled: true})
+	}
+	return reg
+}
+
+func TestDaemonRegister(t *testing.T) {
+	d := newTestDaemon(t)
+
+	if err := d.register(testRegistration("a", "a.test", "app.a.test", "api.a.test")); err != nil {
+		t.Fatalf("register(a) error: %v", err)
+	}
+	if err := d.register(testRegistration("b", "b.test", "app.b.test")); err != nil {
+		t.Fatalf("register(b) error: %v", err)
+	}
+
+	if rt := d.router.match("app.b.test", "/"); rt == nil || rt.port.Load() != 3000 {
+		t.Errorf("app.b.test does not route to port 3000")
+	}
+	want := []string{"a.test", "api.a.test", "app.a.test", "app.b.test", "b.test"}
+	if got := d.serverNames(); !slices.Equal(got, want) {
+		t.Errorf("serverNames() = %v, want %v", got, want)
+	}
+
+	// Re-registering the same project replaces its routes.
+	if err := d.register(testRegistration("a", "a.test", "app.a.test")); err != nil {
+		t.Fatalf("re-register(a) error: %v", err)
+	}
+	if d.router.match("api.a.test", "/") != nil {
+		t.Error("api.a.test still routed after re-register")
+	}
+
+	d.deregister("/src/b")
+	if d.router.match("app.b.test", "/") != nil {
+		t.Error("app.b.test still routed after deregister")
+	}
+}
+
+func TestDaemonRegisterRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		reg     func(Registration) Registration
+		wantErr string
+	}{
+		{
+			name:    "host claimed by another project",
+			reg:     func(r Registration) Registration { r.Routes[0].Domain = "app.a.test"; return r },
+			wantErr: "app.a.test is already served for a",
+		},
+		{
+			name:    "domain claimed by another project",
+			reg:     func(r Registration) Registration { r.Domain = "a.test"; return r },
+			wantErr: "a.test is already served for a",
+		},
+		{
+			name:    "same project from another checkout",
+			reg:     func(Registration) Registration { r := testRegistration("a", "a.test"); r.Dir = "/src/a-2"; return r },
+			wantErr: fmt.Sprintf("a.test is already served for a by lokl (pid %d) in /src/a", os.Getpid()),
+		},
+		{
+			name:    "different listen address",
+			reg:     func(r Registration) Registration { r.Addr = "127.0.0.1:443"; return r },
+			wantErr: "shared proxy listens on 127.0.0.1:8080",
+		},
+		{
+			name:    "different scheme",
+			reg:     func(r Registration) Registration { r.HTTPS = true; return r },
+			wantErr: "shared proxy serves http",
+		},
+		{
+			name:    "DNS server not running",
+			reg:     func(r Registration) Registration { r.DNS = true; return r },
+			wantErr: "does not run the DNS server",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDaemon(t)
+			if err := d.register(testRegistration("a", "a.test", "app.a.test")); err != nil {
+				t.Fatalf("register(a) error: %v", err)
+			}
+
+			err := d.register(tt.reg(testRegistration("b", "b.test", "app.b.test")))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("register() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// serveControl serves d's control socket for the duration of the test and
+// returns a client for it.
+func serveControl(t *testing.T, d *Daemon) *sharedClient {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), socketName)
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: d.controlHandler()}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return newSharedClient(socket)
+}
+
+func TestDaemonControlSocket(t *testing.T) {
+	d := newTestDaemon(t)
+	c := serveControl(t, d)
+
+	if err := c.register(testRegistration("a", "a.test", "app.a.test")); err != nil {
+		t.Fatalf("register() error: %v", err)
+	}
+	err := c.register(testRegistration("b", "a.test"))
+	if err == nil || !strings.Contains(err.Error(), "already served") {
+		t.Errorf("conflicting register() error = %v", err)
+	}
+
+	status, err := c.status()
+	if err != nil {
+		t.Fatalf("status() error: %v", err)
+	}
+	if status.Addr != "127.0.0.1:8080" || len(status.Projects) != 1 || status.Projects[0].Routes[0].Domain != "app.a.test" {
+		t.Errorf("status() = %+v", status)
+	}
+
+	if err := c.deregister("/src/a"); err != nil {
+		t.Fatalf("deregister() error: %v", err)
+	}
+	if status, _ := c.status(); len(status.Projects) != 0 {
+		t.Errorf("projects after deregister = %+v", status.Projects)
+	}
+}
+
+func TestProxyPublish(t *testing.T) {
+	d := newTestDaemon(t)
+
+	https := false
+	p := New(&config.Config{
+		Name: "a",
+		Dir:  "/src/a",
+		Proxy: config.ProxyConfig{
+			Domain: "a.test",
+			Listen: "127.0.0.1:8080",
+			HTTPS:  &https,
+			CA:     config.CALokl,
+			DNS:    config.DNSHosts,
+			Shared: true,
+		},
+		Services: map[string]config.Service{"web": {Subdomain: "app", Port: 3000}},
+	})
+	p.shared = serveControl(t, d)
+	if err := p.shared.register(p.registration()); err != nil {
+		t.Fatalf("register() error: %v", err)
+	}
+
+	port := func() int64 {
+		rt := d.router.match("app.a.test", "/")
+		if rt == nil {
+			return 0
+		}
+		return rt.port.Load()
+	}
+
+	// Route changes are sent by Publish, not when they are made.
+	p.SetPort("web", 4000)
+	if got := port(); got != 3000 {
+		t.Errorf("port before Publish = %d, want 3000", got)
+	}
+	p.Publish()
+	if got := port(); got != 4000 {
+		t.Errorf("port after Publish = %d, want 4000", got)
+	}
+
+	// Nothing registers the project again once it has stopped.
+	if err := p.Stop(false); err != nil {
+		t.Fatalf("Stop() error: %v", err)
+	}
+	p.SetPort("web", 5000)
+	p.Publish()
+	if got := port(); got != 0 {
+		t.Errorf("port after Stop = %d, want no route", got)
+	}
+}
+
+func TestDaemonLock(t *testing.T) {
+	d := newTestDaemon(t)
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stands in for the socket of a daemon that holds the lock.
+	socket := filepath.Join(d.dir, socketName)
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockDaemon(d.dir)
+	if err != nil {
+		t.Fatalf("lockDaemon() error: %v", err)
+	}
+
+	err = d.Run()
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("Run() error = %v, want already running", err)
+	}
+	_ = d.Stop()
+	if _, err := os.Stat(socket); err != nil {
+		t.Errorf("socket of the running daemon was removed: %v", err)
+	}
+
+	unlock()
+	unlock, err = lockDaemon(d.dir)
+	if err != nil {
+		t.Fatalf("lockDaemon() after unlock error: %v", err)
+	}
+	unlock()
+}
+
+func TestDaemonArgs(t *testing.T) {
+	cfg := config.ProxyConfig{Listen: "8443", CA: config.CALokl, DNS: config.DNSServer, HTTPRedirect: true}
+	want := []string{"proxy", "serve", "--listen", "127.0.0.1:8443", "--https=true", "--ca", "lokl", "--dns", "server", "--http-redirect"}
+	if got := daemonArgs(cfg); !slices.Equal(got, want) {
+		t.Errorf("daemonArgs() = %q, want %q", got, want)
+	}
+}
@@ -1,13 +1,14 @@
 package proxy
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -18,10 +19,11 @@ const (
 
 type hostsManager struct {
 	project string
+	path    string
 }
 
 func newHostsManager(project string) *hostsManager {
-	return &hostsManager{project: project}
+	return &hostsManager{project: project, path: hostsFile}
 }
 
 func (h *hostsManager) add(domains []string) error {
@@ -29,51 +31,28 @@ func (h *hostsManager) add(domains []string) error {
 		return nil
 	}
 
-	content, err := os.ReadFile(hostsFile)
-	if err != nil {
-		return fmt.Errorf("reading hosts file: %w", err)
-	}
-
-	cleaned := h.removeBlock(string(content))
-
-	var block strings.Builder
-	block.WriteString(h.startMarker() + "\n")
-	for _, domain := range domains {
-		fmt.Fprintf(&block, "127.0.0.1 %s\n", domain)
-	}
-	block.WriteString(h.endMarker() + "\n")
-
-	newContent := strings.TrimRight(cleaned, "\n") + "\n\n" + block.String()
-
-	if err := os.WriteFile(hostsFile, []byte(newContent), 0o644); err != nil {
-		return fmt.Errorf("writing hosts file: %w", err)
-	}
-
-	return nil
+	return updateHosts(h.path, func(content string) string {
+		cleaned := h.removeBlock(content)
+		if cleaned == "" {
+			return h.block(domains) + "\n"
+		}
+		return strings.TrimRight(cleaned, "\n") + "\n\n" + h.block(domains) + "\n"
+	})
 }
 
 func (h *hostsManager) remove() error {
-	content, err := os.ReadFile(hostsFile)
-	if err != nil {
-		return fmt.Errorf("reading hosts file: %w", err)
-	}
-
-	cleaned := h.removeBlock(string(content))
-
-	if err := os.WriteFile(hostsFile, []byte(cleaned), 0o644); err != nil {
-		return fmt.Errorf("writing hosts file: %w", err)
-	}
-
-	return nil
+	return updateHosts(h.path, h.removeBlock)
 }
 
+// needsSudo reports whether the hosts file, or the directory its
+// replacement, backup and lock file are written to, is not writable.
 func (h *hostsManager) needsSudo() bool {
-	f, err := os.OpenFile(hostsFile, os.O_WRONLY, 0o644)
+	f, err := os.OpenFile(h.path, os.O_WRONLY, 0o644)
 	if err != nil {
 		return true
 	}
 	_ = f.Close()
-	return false
+	return syscall.Access(filepath.Dir(h.path), 0x2) != nil
 }
 
 func (h *hostsManager) unresolved(domains []string) []string {
@@ -103,6 +82,7 @@ func (h *hostsManager) block(domains []string) string {
 	b.WriteString(h.startMarker() + "\n")
 	for _, domain := range domains {
 		fmt.Fprintf(&b, "127.0.0.1 %s\n", domain)
+		fmt.Fprintf(&b, "::1 %s\n", domain)
 	}
 	b.WriteString(h.endMarker())
 	return b.String()
@@ -116,29 +96,27 @@ func (h *hostsManager) endMarker() string {
 	return fmt.Sprintf("# lokl:%s - END", h.project)
 }
 
+// removeBlock drops every complete block of this project. A block missing
+// its END marker is left for lokl dns doctor, rather than guessing where it
+// ends.
 func (h *hostsManager) removeBlock(content string) string {
-	startMarker := h.startMarker()
-	endMarker := h.endMarker()
-
-	var result strings.Builder
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	inBlock := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if line == startMarker {
-			inBlock = true
-			continue
-		}
-		if line == endMarker {
-			inBlock = false
-			continue
-		}
-		if !inBlock {
-			result.WriteString(line + "\n")
+	lines := hostsLines(content)
+	blocks, _ := parseHostsBlocks(lines)
+
+	drop := make(map[int]bool)
+	for _, b := range blocks {
+		if b.project == h.project && b.end != -1 {
+			for i := b.start; i <= b.end; i++ {
+				drop[i] = true
+			}
 		}
 	}
 
-	return result.String()
+	var out []string
+	for i, line := range lines {
+		if !drop[i] {
+			out = append(out, line)
+		}
+	}
+	return joinHostsLines(out)
 }
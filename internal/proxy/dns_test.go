@@ -1,6 +1,12 @@
 package proxy
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
 
 func TestHostsManagerRemoveBlock(t *testing.T) {
 	h := newHostsManager("myproject")
@@ -85,3 +91,193 @@ func TestHostsManagerMarkers(t *testing.T) {
 		t.Errorf("endMarker() = %q", h.endMarker())
 	}
 }
+
+func TestHostsManagerRemoveBlockUnterminated(t *testing.T) {
+	h := newHostsManager("myproject")
+
+	// Without an END marker the block's extent is unknown, so nothing
+	// after it may be removed.
+	content := `127.0.0.1 localhost
+# lokl:myproject - START
+127.0.0.1 app.example.com
+10.0.0.1 db.internal
+`
+	if got := h.removeBlock(content); got != content {
+		t.Errorf("removeBlock():\ngot:\n%s\nwant:\n%s", got, content)
+	}
+}
+
+func TestHostsManagerAddRemove(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	original := "127.0.0.1 localhost\n"
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newHostsManager("myproject")
+	h.path = path
+
+	if err := h.add([]string{"app.example.com"}); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	// Adding again replaces the block instead of appending another.
+	if err := h.add([]string{"app.example.com"}); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `127.0.0.1 localhost
+
+# lokl:myproject - START
+127.0.0.1 app.example.com
+::1 app.example.com
+# lokl:myproject - END
+`
+	if string(data) != want {
+		t.Errorf("after add():\ngot:\n%s\nwant:\n%s", data, want)
+	}
+
+	if err := h.remove(); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimRight(string(data), "\n") + "\n"; got != original {
+		t.Errorf("after remove():\ngot:\n%s\nwant:\n%s", data, original)
+	}
+
+	backups, err := filepath.Glob(path + ".lokl-*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) == 0 {
+		t.Error("no backup written")
+	}
+	if _, err := os.Stat(path + ".lokl.lock"); err != nil {
+		t.Errorf("lock file: %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".hosts.lokl-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestDiagnoseHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		problems []string
+		want     string
+	}{
+		{
+			name: "healthy",
+			content: `127.0.0.1 localhost
+# lokl:a - START
+127.0.0.1 a.test
+# lokl:a - END
+# lokl:b - START
+127.0.0.1 b.test
+# lokl:b - END
+`,
+		},
+		{
+			name: "duplicate block keeps the last",
+			content: `# lokl:a - START
+127.0.0.1 old.test
+# lokl:a - END
+127.0.0.1 localhost
+# lokl:a - START
+127.0.0.1 new.test
+# lokl:a - END
+`,
+			problems: []string{"line 1: duplicate block for a"},
+			want: `127.0.0.1 localhost
+# lokl:a - START
+127.0.0.1 new.test
+# lokl:a - END
+`,
+		},
+		{
+			name: "unterminated block",
+			content: `# lokl:a - START
+127.0.0.1 a.test
+::1 a.test
+10.0.0.1 db.internal
+`,
+			problems: []string{"line 1: block for a has no END marker"},
+			want: `10.0.0.1 db.internal
+`,
+		},
+		{
+			name: "stray end marker",
+			content: `127.0.0.1 localhost
+# lokl:a - END
+`,
+			problems: []string{`line 2: "# lokl:a - END" has no matching START marker`},
+			want: `127.0.0.1 localhost
+`,
+		},
+		{
+			name: "stale block of another project",
+			content: `# lokl:old - START
+127.0.0.1 app.test
+::1 app.test
+# lokl:old - END
+# lokl:new - START
+127.0.0.1 app.test
+::1 app.test
+# lokl:new - END
+`,
+			problems: []string{"line 1: stale block for old; all its domains are claimed by later blocks"},
+			want: `# lokl:new - START
+127.0.0.1 app.test
+::1 app.test
+# lokl:new - END
+`,
+		},
+		{
+			name: "domain claimed by two projects",
+			content: `# lokl:old - START
+127.0.0.1 app.test
+127.0.0.1 api.test
+# lokl:old - END
+# lokl:new - START
+127.0.0.1 app.test
+# lokl:new - END
+`,
+			problems: []string{"line 1: block for old claims app.test, also claimed by a later block"},
+			want: `# lokl:old - START
+127.0.0.1 api.test
+# lokl:old - END
+# lokl:new - START
+127.0.0.1 app.test
+# lokl:new - END
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, got := diagnoseHosts(tt.content)
+			if !slices.Equal(problems, tt.problems) {
+				t.Errorf("problems = %q, want %q", problems, tt.problems)
+			}
+			want := tt.want
+			if tt.problems == nil {
+				want = tt.content
+			}
+			if got != want {
+				t.Errorf("repaired:\ngot:\n%s\nwant:\n%s", got, want)
+			}
+			if again, _ := diagnoseHosts(got); again != nil {
+				t.Errorf("repaired content still has problems: %q", again)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dnsServerHost and dnsServerPort are where the embedded DNS server
+	// listens. The address is fixed because lokl dns install points the
+	// system resolver at it.
+	dnsServerHost = "127.0.0.1"
+	dnsServerPort = 15353
+
+	dnsTTL = 60
+)
+
+// dnsServer is a small authoritative DNS server that answers every name in
+// its zones, the project domains, with the loopback addresses.
+type dnsServer struct {
+	addr    string
+	servers []*dns.Server
+
+	mu    sync.RWMutex
+	zones []string
+}
+
+func newDNSServer(addr string, domains ...string) *dnsServer {
+	s := &dnsServer{addr: addr}
+	s.setZones(domains)
+	return s
+}
+
+// setZones replaces the domains the server answers for.
+func (s *dnsServer) setZones(domains []string) {
+	zones := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		zones = append(zones, dns.Fqdn(strings.ToLower(domain)))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zones = zones
+}
+
+// zone returns the zone name belongs to, or "" if none.
+func (s *dnsServer) zone(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best string
+	for _, zone := range s.zones {
+		if dns.IsSubDomain(zone, name) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best
+}
+
+// start binds UDP and TCP on the same port and serves in the background.
+// Binding happens before start returns, so a busy port is reported.
+func (s *dnsServer) start() error {
+	pc, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.addr, err)
+	}
+	// With port 0 the TCP listener must use the port UDP got.
+	s.addr = pc.LocalAddr().String()
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		_ = pc.Close()
+		return fmt.Errorf("listening on %s: %w", s.addr, err)
+	}
+
+	s.servers = []*dns.Server{
+		{PacketConn: pc, Handler: s},
+		{Listener: ln, Handler: s},
+	}
+	for _, srv := range s.servers {
+		go func() {
+			_ = srv.ActivateAndServe()
+		}()
+	}
+	return nil
+}
+
+func (s *dnsServer) stop() error {
+	var errs []error
+	for _, srv := range s.servers {
+		if err := srv.Shutdown(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.servers = nil
+	return errors.Join(errs...)
+}
+
+func (s *dnsServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	if len(req.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	q := req.Question[0]
+	zone := s.zone(strings.ToLower(q.Name))
+	if zone == "" {
+		m.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	m.Authoritative = true
+	switch q.Qtype {
+	case dns.TypeA:
+		m.Answer = append(m.Answer, &dns.A{Hdr: s.header(q.Name, dns.TypeA), A: net.IPv4(127, 0, 0, 1)})
+	case dns.TypeAAAA:
+		m.Answer = append(m.Answer, &dns.AAAA{Hdr: s.header(q.Name, dns.TypeAAAA), AAAA: net.IPv6loopback})
+	default:
+		// The name exists but has no records of this type.
+		m.Ns = append(m.Ns, s.soa(zone))
+	}
+	_ = w.WriteMsg(m)
+}
+
+func (s *dnsServer) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: dnsTTL}
+}
+
+func (s *dnsServer) soa(zone string) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     s.header(zone, dns.TypeSOA),
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  dnsTTL,
+	}
+}
+
+// dnsZones returns the zones that cover domain and hosts: domain itself and
+// the hosts outside it, a wildcard host as the domain it is under.
+func dnsZones(domain string, hosts []string) []string {
+	zones := []string{domain}
+	for _, host := range hosts {
+		host = strings.TrimPrefix(host, "*.")
+		if host == domain || strings.HasSuffix(host, "."+domain) || slices.Contains(zones, host) {
+			continue
+		}
+		zones = append(zones, host)
+	}
+	slices.Sort(zones[1:])
+	return zones
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSServer(t *testing.T) {
+	s := newDNSServer("127.0.0.1:0", "MyApp.dev", "other.test")
+	if err := s.start(); err != nil {
+		t.Fatalf("start() error: %v", err)
+	}
+	t.Cleanup(func() { _ = s.stop() })
+
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     uint16
+		wantRcode int
+		wantAns   string
+	}{
+		{name: "root A", qname: "myapp.dev.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantAns: "127.0.0.1"},
+		{name: "subdomain A", qname: "api.myapp.dev.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantAns: "127.0.0.1"},
+		{name: "deep subdomain AAAA", qname: "a.b.MYAPP.dev.", qtype: dns.TypeAAAA, wantRcode: dns.RcodeSuccess, wantAns: "::1"},
+		{name: "other type", qname: "api.myapp.dev.", qtype: dns.TypeTXT, wantRcode: dns.RcodeSuccess},
+		{name: "second zone", qname: "web.other.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantAns: "127.0.0.1"},
+		{name: "outside zone", qname: "example.com.", qtype: dns.TypeA, wantRcode: dns.RcodeRefused},
+		{name: "suffix is not a subdomain", qname: "notmyapp.dev.", qtype: dns.TypeA, wantRcode: dns.RcodeRefused},
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		client := &dns.Client{Net: network}
+		for _, tt := range tests {
+			t.Run(network+"/"+tt.name, func(t *testing.T) {
+				req := new(dns.Msg)
+				req.SetQuestion(tt.qname, tt.qtype)
+
+				resp, _, err := client.Exchange(req, s.addr)
+				if err != nil {
+					t.Fatalf("Exchange() error: %v", err)
+				}
+				if resp.Rcode != tt.wantRcode {
+					t.Errorf("rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+				}
+
+				var got string
+				for _, rr := range resp.Answer {
+					switch rr := rr.(type) {
+					case *dns.A:
+						got = rr.A.String()
+					case *dns.AAAA:
+						got = rr.AAAA.String()
+					}
+				}
+				if got != tt.wantAns {
+					t.Errorf("answer = %q, want %q", got, tt.wantAns)
+				}
+			})
+		}
+	}
+}
+
+func TestDNSZones(t *testing.T) {
+	hosts := []string{"app.myapp.dev", "*.tenants.myapp.dev", "shop.example.com", "*.app.other.test", "myapp.dev"}
+	want := []string{"myapp.dev", "app.other.test", "shop.example.com"}
+	if got := dnsZones("myapp.dev", hosts); !slices.Equal(got, want) {
+		t.Errorf("dnsZones() = %v, want %v", got, want)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"path"
 	"strings"
 	"sync"
 	"time"
@@ -28,17 +27,33 @@ const (
 	continueTimout = 1 * time.Second
 )
 
+const (
+	schemeHTTP  = "http"
+	schemeHTTPS = "https"
+)
+
 type handler struct {
 	router   *router
+	scheme   string            // scheme clients used, sent as X-Forwarded-Proto
 	dnsCache map[string]string // domain -> IP cache
 	dnsMu    sync.RWMutex
+
+	// localTransport forwards requests to services running locally.
+	localTransport http.RoundTripper
+	// remoteTransport returns the transport for a remote host, or nil if
+	// the host does not resolve. Tests replace it to avoid real DNS.
+	remoteTransport func(host string) http.RoundTripper
 }
 
-func newHandler(router *router) *handler {
-	return &handler{
-		router:   router,
-		dnsCache: make(map[string]string),
+func newHandler(router *router, scheme string) *handler {
+	h := &handler{
+		router:         router,
+		scheme:         scheme,
+		dnsCache:       make(map[string]string),
+		localTransport: http.DefaultTransport,
 	}
+	h.remoteTransport = h.newRemoteTransport
+	return h
 }
 
 // resolveViaDNS queries external DNS directly, bypassing /etc/hosts
@@ -72,7 +87,7 @@ func (h *handler) resolveViaDNS(host string) (string, error) {
 	return "", fmt.Errorf("no A record found for %s", host)
 }
 
-func (h *handler) remoteTransport(host string) http.RoundTripper {
+func (h *handler) newRemoteTransport(host string) http.RoundTripper {
 	ip, err := h.resolveViaDNS(host)
 	if err != nil {
 		return nil
@@ -105,7 +120,7 @@ func (h *handler) remoteTransport(host string) http.RoundTripper {
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rt := h.router.match(r.Host)
+	rt := h.router.match(r.Host, r.URL.Path)
 	if rt == nil {
 		http.Error(w, "service not found", http.StatusNotFound)
 		return
@@ -113,21 +128,44 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	var target *url.URL
 	var transport http.RoundTripper
+	var notFound string // fallback path if the service answers 404
 
 	if rt.enabled.Load() {
+		port := rt.port.Load()
+		if port == 0 {
+			http.Error(w, "service not started", http.StatusServiceUnavailable)
+			return
+		}
+		var mount string // the prefix stripped from the path
+		if rt.stripPrefix {
+			mount = rt.pathPrefix
+			r.URL.Path = stripPathPrefix(r.URL.Path, mount)
+		}
 		if rt.rewrite != nil {
-			r.URL.Path = rewritePath(r.URL.Path, rt.rewrite)
+			res := rt.rewrite.apply(r.URL.Path)
+			if res.redirect != "" {
+				target := unstripRedirect(res.redirect, r.URL.Path, mount)
+				http.Redirect(w, r, withQuery(target, r.URL.RawQuery), res.status)
+				return
+			}
+			r.URL.Path = res.path
+			r.URL.RawPath = ""
+			if acceptsHTML(r) {
+				notFound = res.notFound
+			}
 		}
 		target = &url.URL{
 			Scheme: "http",
-			Host:   fmt.Sprintf("localhost:%d", rt.port),
+			Host:   fmt.Sprintf("localhost:%d", port),
 		}
+		transport = h.localTransport
 	} else {
+		host := rt.remoteHost(r.Host)
 		target = &url.URL{
 			Scheme: "https",
-			Host:   rt.domain,
+			Host:   rt.remoteAddr(host),
 		}
-		transport = h.remoteTransport(rt.domain)
+		transport = h.remoteTransport(host)
 		if transport == nil {
 			http.Error(w, "failed to resolve remote host", http.StatusBadGateway)
 			return
@@ -148,6 +186,12 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, fmt.Sprintf("upstream error: %v", err), http.StatusBadGateway)
 		},
 		ModifyResponse: func(resp *http.Response) error {
+			if notFound != "" && resp.StatusCode == http.StatusNotFound {
+				if err := refetch(transport, resp, notFound); err != nil {
+					return err
+				}
+			}
+
 			// Bust cache so toggle takes effect immediately
 			resp.Header.Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
 			resp.Header.Set("Pragma", "no-cache")
@@ -166,48 +210,65 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Preserve original host for backends that check it
 	r.Header.Set("X-Forwarded-Host", r.Host)
-	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Proto", h.scheme)
 
 	proxy.ServeHTTP(w, r)
 }
 
-func rewritePath(p string, rw *rewriteConfig) string {
-	if rw.stripPrefix != "" {
-		prefix := "/" + rw.stripPrefix
-		if after, found := strings.CutPrefix(p, prefix); found {
-			p = after
-			if p == "" {
-				p = "/"
-			}
+// stripPathPrefix removes a route's path prefix, so a service mounted at
+// /api sees /api/users as /users.
+func stripPathPrefix(p, prefix string) string {
+	if after, found := strings.CutPrefix(p, prefix); found {
+		p = after
+		if p == "" {
+			p = "/"
 		}
 	}
-
-	if rw.fallback != "" && !isAssetPath(p) {
-		return rw.fallback
-	}
-
 	return p
 }
 
-func isAssetPath(p string) bool {
-	assetPrefixes := []string{"/assets/", "/static/", "/@vite/", "/@fs/", "/__vite_ping"}
-	for _, prefix := range assetPrefixes {
-		if strings.HasPrefix(p, prefix) {
-			return true
-		}
+// unstripRedirect maps a redirect target for p, the path after prefix was
+// stripped, back onto the path the client requested. A target on the same
+// host is resolved against p and gets prefix back, so it stays in the mount.
+func unstripRedirect(target, p, prefix string) string {
+	if prefix == "" {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return target
 	}
+	u = (&url.URL{Path: p}).ResolveReference(u)
+	u.Path = strings.TrimSuffix(prefix, "/") + u.Path
+	u.RawPath = ""
+	return u.String()
+}
 
-	ext := strings.ToLower(path.Ext(p))
-	assetExts := map[string]bool{
-		".js": true, ".mjs": true, ".cjs": true,
-		".css": true, ".scss": true, ".sass": true, ".less": true,
-		".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true,
-		".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
-		".json": true, ".map": true,
-		".html": true, ".htm": true,
-		".mp4": true, ".webm": true, ".mp3": true, ".wav": true,
-		".pdf": true,
+// withQuery carries the request's query string over to a redirect target
+// that has none of its own.
+func withQuery(target, rawQuery string) string {
+	if rawQuery == "" || strings.Contains(target, "?") {
+		return target
 	}
+	return target + "?" + rawQuery
+}
+
+// refetch replaces a 404 response with the service's response for
+// fallback, so unknown pages of a single-page app load its entry point. It
+// goes through transport, like the request that got the 404.
+func refetch(transport http.RoundTripper, resp *http.Response, fallback string) error {
+	req := resp.Request.Clone(resp.Request.Context())
+	req.URL.Path = fallback
+	req.URL.RawPath = ""
 
-	return assetExts[ext]
+	fb, err := transport.RoundTrip(req)
+	if err != nil {
+		return fmt.Errorf("fetching fallback %s: %w", fallback, err)
+	}
+	for _, h := range []string{"Connection", "Keep-Alive"} {
+		fb.Header.Del(h)
+	}
+	_ = resp.Body.Close()
+	*resp = *fb
+	return nil
 }
@@ -1,114 +1,250 @@
 package proxy
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+// newTestBackend starts an HTTP server for the duration of the test and
+// returns its port.
+func newTestBackend(t *testing.T, handler http.Handler) int {
+	t.Helper()
+
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestHandlerForwardedProto(t *testing.T) {
+	port := newTestBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Forwarded-Proto")))
+	}))
+	r := newRouter(&config.Config{
+		Proxy:    config.ProxyConfig{Domain: "myapp.dev"},
+		Services: map[string]config.Service{"web": {Subdomain: "app", Port: port}},
+	})
+
+	for _, scheme := range []string{schemeHTTP, schemeHTTPS} {
+		rec := httptest.NewRecorder()
+		newHandler(r, scheme).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://app.myapp.dev/", nil))
+
+		if got := rec.Body.String(); got != scheme {
+			t.Errorf("X-Forwarded-Proto = %q, want %q", got, scheme)
+		}
+	}
+}
+
+func TestHandlerPathRoutes(t *testing.T) {
+	port := newTestBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	r := newRouter(&config.Config{
+		Proxy: config.ProxyConfig{Domain: "myapp.dev"},
+		Services: map[string]config.Service{
+			"api": {Port: port, Routes: []config.RouteConfig{{Host: "app", PathPrefix: "/api", StripPrefix: true}}},
+			"spa": {
+				Port:    port + 1,
+				Routes:  []config.RouteConfig{{Host: "app", PathPrefix: "/shop", StripPrefix: true}},
+				Rewrite: &config.RewriteConfig{Fallback: "/index.html"},
+			},
+		},
+	})
+	// Both services are the same test server; only the paths differ.
+	r.setPort("spa", port)
 
-func TestRewritePath(t *testing.T) {
 	tests := []struct {
-		name string
 		path string
-		rw   *rewriteConfig
 		want string
 	}{
-		{
-			name: "strip prefix",
-			path: "/customer-funnel/dashboard",
-			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
-			want: "/dashboard",
-		},
-		{
-			name: "strip prefix root",
-			path: "/customer-funnel",
-			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
-			want: "/",
-		},
-		{
-			name: "strip prefix with trailing slash",
-			path: "/customer-funnel/",
-			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
-			want: "/",
-		},
-		{
-			name: "no match prefix",
-			path: "/other/path",
-			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
-			want: "/other/path",
-		},
-		{
-			name: "fallback for non-asset",
-			path: "/dashboard",
-			rw:   &rewriteConfig{fallback: "/index.html"},
-			want: "/index.html",
-		},
-		{
-			name: "no fallback for asset",
-			path: "/assets/main.js",
-			rw:   &rewriteConfig{fallback: "/index.html"},
-			want: "/assets/main.js",
-		},
-		{
-			name: "strip prefix then fallback",
-			path: "/customer-funnel/dashboard",
-			rw:   &rewriteConfig{stripPrefix: "customer-funnel", fallback: "/index.html"},
-			want: "/index.html",
-		},
-		{
-			name: "strip prefix keep asset",
-			path: "/customer-funnel/assets/main.js",
-			rw:   &rewriteConfig{stripPrefix: "customer-funnel", fallback: "/index.html"},
-			want: "/assets/main.js",
-		},
-		{
-			name: "empty config",
-			path: "/some/path",
-			rw:   &rewriteConfig{},
-			want: "/some/path",
+		{"/api", "/"},
+		{"/api/users", "/users"},
+		{"/shop/cart", "/index.html"},
+		{"/shop/main.js", "/main.js"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newHandler(r, schemeHTTPS).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://app.myapp.dev"+tt.path, nil))
+
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("backend path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerRewriteRules(t *testing.T) {
+	port := newTestBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.html" && r.URL.Path != "/users.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	rewrite := &config.RewriteConfig{Rules: []config.RewriteRule{
+		{Match: `^/old/(.*)$`, Redirect: "/new/$1", Status: http.StatusMovedPermanently},
+		{Fallback: "/index.html", OnNotFound: true},
+	}}
+	r := newRouter(&config.Config{
+		Proxy: config.ProxyConfig{Domain: "myapp.dev"},
+		Services: map[string]config.Service{
+			"web": {Subdomain: "app", Port: port, Rewrite: rewrite},
+			"shop": {
+				Port:    port + 1,
+				Routes:  []config.RouteConfig{{Host: "app", PathPrefix: "/shop", StripPrefix: true}},
+				Rewrite: rewrite,
+			},
 		},
+	})
+	// Both services are the same test server; only the paths differ.
+	r.setPort("shop", port)
+
+	// Every request to the services, including the fallback refetch, goes
+	// through the handler's transport.
+	var requested []string
+	h := newHandler(r, schemeHTTPS)
+	h.localTransport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Path)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	tests := []struct {
+		name          string
+		target        string
+		accept        string
+		wantStatus    int
+		wantBody      string
+		wantLocation  string
+		wantRequested string
+	}{
+		{name: "redirect keeps query", target: "/old/page?tab=2", wantStatus: http.StatusMovedPermanently, wantLocation: "/new/page?tab=2"},
+		{name: "redirect stays in mount", target: "/shop/old/page?tab=2", wantStatus: http.StatusMovedPermanently, wantLocation: "/shop/new/page?tab=2"},
+		{name: "existing file", target: "/users.json", accept: "text/html", wantStatus: http.StatusOK, wantBody: "/users.json", wantRequested: "/users.json"},
+		{name: "page falls back on 404", target: "/dashboard", accept: "text/html", wantStatus: http.StatusOK, wantBody: "/index.html", wantRequested: "/dashboard,/index.html"},
+		{name: "mounted page falls back on 404", target: "/shop/cart", accept: "text/html", wantStatus: http.StatusOK, wantBody: "/index.html", wantRequested: "/cart,/index.html"},
+		{name: "non-page keeps 404", target: "/missing.js", accept: "*/*", wantStatus: http.StatusNotFound, wantRequested: "/missing.js"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := rewritePath(tt.path, tt.rw)
-			if got != tt.want {
-				t.Errorf("rewritePath(%q) = %q, want %q", tt.path, got, tt.want)
+			requested = nil
+			req := httptest.NewRequest(http.MethodGet, "http://app.myapp.dev"+tt.target, nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if got := strings.Join(requested, ","); got != tt.wantRequested {
+				t.Errorf("requested %q, want %q", got, tt.wantRequested)
 			}
 		})
 	}
 }
 
-func TestIsAssetPath(t *testing.T) {
+func TestUnstripRedirect(t *testing.T) {
 	tests := []struct {
-		path string
-		want bool
+		name   string
+		target string
+		path   string
+		prefix string
+		want   string
 	}{
-		// By extension
-		{"/main.js", true},
-		{"/style.css", true},
-		{"/image.png", true},
-		{"/font.woff2", true},
-		{"/data.json", true},
-		{"/page.html", true},
-		{"/app.mjs", true},
-
-		// By prefix
-		{"/assets/anything", true},
-		{"/static/file.txt", true},
-		{"/@vite/client", true},
-		{"/@fs/some/path", true},
-		{"/__vite_ping", true},
-
-		// Non-assets
-		{"/dashboard", false},
-		{"/users/123", false},
-		{"/api/data", false},
-		{"/", false},
-		{"/settings", false},
+		{name: "no prefix", target: "new", path: "/docs/old", want: "new"},
+		{name: "absolute path", target: "/new", path: "/old", prefix: "/shop", want: "/shop/new"},
+		{name: "root", target: "/", path: "/old", prefix: "/shop", want: "/shop/"},
+		{name: "relative path", target: "new", path: "/docs/old", prefix: "/shop", want: "/shop/docs/new"},
+		{name: "parent path", target: "../new", path: "/docs/old", prefix: "/shop", want: "/shop/new"},
+		{name: "query", target: "/new?tab=2", path: "/old", prefix: "/shop", want: "/shop/new?tab=2"},
+		{name: "URL", target: "https://docs.example.com/new", path: "/old", prefix: "/shop", want: "https://docs.example.com/new"},
+		{name: "scheme-relative URL", target: "//docs.example.com/new", path: "/old", prefix: "/shop", want: "//docs.example.com/new"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.path, func(t *testing.T) {
-			got := isAssetPath(tt.path)
-			if got != tt.want {
-				t.Errorf("isAssetPath(%q) = %v, want %v", tt.path, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unstripRedirect(tt.target, tt.path, tt.prefix); got != tt.want {
+				t.Errorf("unstripRedirect(%q, %q, %q) = %q, want %q", tt.target, tt.path, tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+// roundTripperFunc answers remote requests in tests without a network.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHandlerRemoteHost(t *testing.T) {
+	r := newRouter(&config.Config{
+		Proxy: config.ProxyConfig{Domain: "example.com", RemotePort: 8443},
+		Services: map[string]config.Service{
+			"tenants": {Port: 3000, Hosts: []string{"*.app"}},
+			"site":    {Port: 3001, Subdomain: "www"},
+		},
+	})
+	r.setEnabled("tenants", false)
+	r.setEnabled("site", false)
+
+	var resolved, urlHost, hostHeader string
+	h := newHandler(r, schemeHTTPS)
+	h.remoteTransport = func(host string) http.RoundTripper {
+		resolved = host
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			urlHost, hostHeader = req.URL.Host, req.Host
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: http.Header{}, Request: req}, nil
+		})
+	}
+
+	tests := []struct {
+		host         string
+		wantResolved string
+		wantHost     string
+	}{
+		{"acme.app.example.com", "acme.app.example.com", "acme.app.example.com:8443"},
+		{"ACME.app.example.com:443", "acme.app.example.com", "acme.app.example.com:8443"},
+		{"www.example.com:443", "www.example.com", "www.example.com:8443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if resolved != tt.wantResolved {
+				t.Errorf("resolved %q, want %q", resolved, tt.wantResolved)
+			}
+			if urlHost != tt.wantHost || hostHeader != tt.wantHost {
+				t.Errorf("URL host = %q, Host = %q, want %q", urlHost, hostHeader, tt.wantHost)
 			}
 		})
 	}
@@ -0,0 +1,347 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// hostsBackups is how many timestamped copies of the hosts file are kept.
+const hostsBackups = 5
+
+// updateHosts applies edit to the hosts file at path while holding a lock,
+// so concurrent lokl runs cannot lose each other's changes. The previous
+// content is backed up before the file is replaced.
+func updateHosts(path string, edit func(content string) string) error {
+	unlock, err := lockHosts(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading hosts file: %w", err)
+	}
+
+	updated := edit(string(data))
+	if updated == string(data) {
+		return nil
+	}
+
+	if err := backupHosts(path, data); err != nil {
+		return err
+	}
+	return writeHosts(path, []byte(updated))
+}
+
+// lockHosts takes an exclusive lock on a file next to path. The lock file
+// is left in place; removing it would let two processes lock different
+// files.
+func lockHosts(path string) (func(), error) {
+	f, err := os.OpenFile(path+".lokl.lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("locking hosts file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("locking hosts file: %w", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
+
+// backupHosts writes data to a timestamped copy of path and prunes the
+// oldest copies.
+func backupHosts(path string, data []byte) error {
+	name := fmt.Sprintf("%s.lokl-%s.bak", path, time.Now().Format("20060102-150405.000"))
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		return fmt.Errorf("backing up hosts file: %w", err)
+	}
+
+	backups, err := filepath.Glob(path + ".lokl-*.bak")
+	if err != nil {
+		return nil
+	}
+	// The timestamp format sorts chronologically.
+	slices.Sort(backups)
+	for len(backups) > hostsBackups {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// writeHosts replaces path with data through a temporary file and rename,
+// so a crash never leaves a truncated hosts file.
+func writeHosts(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".hosts.lokl-*")
+	if err != nil {
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err == nil {
+		return nil
+	}
+	// In containers /etc/hosts is usually a bind mount, which cannot be
+	// replaced. Write it in place instead; the backup covers a crash.
+	if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) {
+		return writeInPlace(path, data)
+	}
+	return fmt.Errorf("writing hosts file: %w", err)
+}
+
+func writeInPlace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing hosts file: %w", err)
+	}
+	return nil
+}
+
+// hostsBlock is a lokl block in the hosts file. Line numbers index the
+// file's lines; end is -1 for a block whose END marker is missing.
+type hostsBlock struct {
+	project string
+	start   int
+	end     int
+	entries map[int]string // line → domain
+}
+
+// hostsLines splits content into lines without the trailing newline.
+func hostsLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+func joinHostsLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// parseHostsBlocks finds lokl's blocks in lines. It also returns END
+// markers that do not close a block.
+func parseHostsBlocks(lines []string) (blocks []hostsBlock, strayEnds []int) {
+	var open *hostsBlock
+	closeOpen := func() {
+		if open != nil {
+			blocks = append(blocks, *open)
+			open = nil
+		}
+	}
+
+	for i, line := range lines {
+		if project, ok := markerProject(line, " - START"); ok {
+			if open != nil {
+				// An unterminated block only owns the loopback lines
+				// right after its marker.
+				open.end = -1
+				open.entries = loopbackRun(lines, open.start+1, i)
+				closeOpen()
+			}
+			open = &hostsBlock{project: project, start: i}
+			continue
+		}
+		if project, ok := markerProject(line, " - END"); ok {
+			if open != nil && open.project == project {
+				open.end = i
+				open.entries = loopbackRun(lines, open.start+1, i)
+				closeOpen()
+			} else {
+				strayEnds = append(strayEnds, i)
+			}
+		}
+	}
+	if open != nil {
+		open.end = -1
+		open.entries = loopbackRun(lines, open.start+1, len(lines))
+		closeOpen()
+	}
+	return blocks, strayEnds
+}
+
+func markerProject(line, suffix string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "# lokl:")
+	if !ok {
+		return "", false
+	}
+	return strings.CutSuffix(rest, suffix)
+}
+
+// loopbackRun returns the consecutive "127.0.0.1 name" or "::1 name" lines
+// from lines[from:to].
+func loopbackRun(lines []string, from, to int) map[int]string {
+	entries := make(map[int]string)
+	for i := from; i < to; i++ {
+		fields := strings.Fields(lines[i])
+		if len(fields) != 2 || (fields[0] != "127.0.0.1" && fields[0] != "::1") {
+			break
+		}
+		entries[i] = fields[1]
+	}
+	return entries
+}
+
+// diagnoseHosts finds problems in lokl's blocks and returns them, in file
+// order, along with the content repaired. Repairs keep the most recent
+// (last) entry: earlier blocks of a project are dropped, as are domains
+// also claimed by a later block of another project.
+func diagnoseHosts(content string) (problems []string, repaired string) {
+	lines := hostsLines(content)
+	blocks, strayEnds := parseHostsBlocks(lines)
+	drop := make(map[int]bool)
+	found := make(map[int]string)
+
+	for _, i := range strayEnds {
+		found[i] = fmt.Sprintf("%q has no matching START marker", lines[i])
+		drop[i] = true
+	}
+
+	var kept []hostsBlock
+	for _, b := range blocks {
+		if b.end == -1 {
+			found[b.start] = fmt.Sprintf("block for %s has no END marker", b.project)
+			dropBlock(drop, b)
+			continue
+		}
+		kept = append(kept, b)
+	}
+
+	// Later blocks win, so walk backwards and remember what is taken.
+	projects := make(map[string]bool)
+	owners := make(map[string]string)
+	for i := len(kept) - 1; i >= 0; i-- {
+		b := kept[i]
+		if projects[b.project] {
+			found[b.start] = fmt.Sprintf("duplicate block for %s", b.project)
+			dropBlock(drop, b)
+			continue
+		}
+		projects[b.project] = true
+
+		var stale []string
+		for line, domain := range b.entries {
+			if owner, ok := owners[domain]; ok && owner != b.project {
+				stale = append(stale, domain)
+				drop[line] = true
+			}
+		}
+		for line, domain := range b.entries {
+			if !drop[line] {
+				owners[domain] = b.project
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		if len(stale) == len(b.entries) {
+			found[b.start] = fmt.Sprintf("stale block for %s; all its domains are claimed by later blocks", b.project)
+			dropBlock(drop, b)
+			continue
+		}
+		slices.Sort(stale)
+		found[b.start] = fmt.Sprintf("block for %s claims %s, also claimed by a later block", b.project, strings.Join(slices.Compact(stale), ", "))
+	}
+
+	if len(found) == 0 {
+		return nil, content
+	}
+	for _, line := range slices.Sorted(maps.Keys(found)) {
+		problems = append(problems, fmt.Sprintf("line %d: %s", line+1, found[line]))
+	}
+
+	var out []string
+	for i, line := range lines {
+		if !drop[i] {
+			out = append(out, line)
+		}
+	}
+	return problems, joinHostsLines(out)
+}
+
+// dropBlock marks a block's lines for removal. Without an END marker only
+// the marker and the entries right after it are known to be lokl's.
+func dropBlock(drop map[int]bool, b hostsBlock) {
+	if b.end != -1 {
+		for i := b.start; i <= b.end; i++ {
+			drop[i] = true
+		}
+		return
+	}
+	drop[b.start] = true
+	for line := range b.entries {
+		drop[line] = true
+	}
+}
+
+// CheckHosts reports duplicate, unterminated or stale lokl blocks in
+// /etc/hosts, including those of other projects.
+func CheckHosts() ([]string, error) {
+	data, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading hosts file: %w", err)
+	}
+	problems, _ := diagnoseHosts(string(data))
+	return problems, nil
+}
+
+// RepairHosts fixes what CheckHosts reports and returns the problems it
+// fixed. It needs write access to /etc/hosts.
+func RepairHosts() ([]string, error) {
+	var problems []string
+	err := updateHosts(hostsFile, func(content string) string {
+		var repaired string
+		problems, repaired = diagnoseHosts(content)
+		return repaired
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// pfAnchor is loaded below the com.apple anchor, which the default macOS
+// pf ruleset already evaluates.
+const pfAnchor = "com.apple/lokl"
+
+// GrantBindCapability lets binary bind ports below 1024 without root by
+// granting it CAP_NET_BIND_SERVICE. The capability is lost when the binary
+// is replaced. Linux only.
+func GrantBindCapability(binary string) error {
+	if runtime.GOOS != "linux" {
+		return errors.New("capabilities are only available on Linux; use port forwarding instead")
+	}
+	if _, err := exec.LookPath("setcap"); err != nil {
+		return errors.New("setcap not found; install libcap2-bin (Debian, Ubuntu) or libcap (Fedora, Arch)")
+	}
+	return sudo("setcap", "cap_net_bind_service=+ep", binary)
+}
+
+// ForwardPort redirects local TCP connections on port from to port to, over
+// IPv4 and IPv6, so the proxy can listen on an unprivileged port. Project
+// domains resolve to ::1 as well as 127.0.0.1, so both need the rule. The
+// rules last until the next reboot.
+func ForwardPort(from, to int) error {
+	switch runtime.GOOS {
+	case "linux":
+		for _, bin := range []string{"iptables", "ip6tables"} {
+			if _, err := exec.LookPath(bin); err != nil {
+				return fmt.Errorf("%s not found", bin)
+			}
+		}
+		rule := []string{"OUTPUT", "-o", "lo", "-p", "tcp", "--dport", strconv.Itoa(from), "-j", "REDIRECT", "--to-ports", strconv.Itoa(to)}
+		for _, bin := range []string{"iptables", "ip6tables"} {
+			// -C succeeds when the rule already exists.
+			if sudo(append([]string{bin, "-t", "nat", "-C"}, rule...)...) == nil {
+				continue
+			}
+			if err := sudo(append([]string{bin, "-t", "nat", "-A"}, rule...)...); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "darwin":
+		rules := fmt.Sprintf("rdr pass on lo0 inet proto tcp from any to any port %d -> 127.0.0.1 port %d\n", from, to) +
+			fmt.Sprintf("rdr pass on lo0 inet6 proto tcp from any to any port %d -> ::1 port %d\n", from, to)
+		cmd := exec.Command("sudo", "pfctl", "-a", pfAnchor, "-f", "-")
+		cmd.Stdin = strings.NewReader(rules)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("loading pf rules: %w", err)
+		}
+		// pfctl -E fails harmlessly when pf is already enabled.
+		_ = sudo("pfctl", "-E")
+		return nil
+
+	default:
+		return fmt.Errorf("port forwarding is not supported on %s", runtime.GOOS)
+	}
+}
@@ -4,37 +4,75 @@ package proxy
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/shahin-bayat/lokl/internal/config"
 )
 
 const (
-	defaultPort     = 443
-	defaultCertDir  = ".lokl/certs"
+	httpsPort       = 443
+	httpPort        = 80
+	certDirName     = "certs"
 	shutdownTimeout = 5 * time.Second
 )
 
 type Proxy struct {
-	cfg    *config.Config
-	router *router
-	certs  *certManager
-	hosts  *hostsManager
-	server *http.Server
-	port   int
+	cfg      *config.Config
+	router   *router
+	certs    *certManager
+	hosts    *hostsManager
+	server   *http.Server
+	redirect *http.Server  // :80 listener redirecting to HTTPS
+	dns      *dnsServer    // nil when domains resolve through /etc/hosts
+	shared   *sharedClient // set when routes go to the shared proxy
+	host     string
+	port     int
+	https    bool
+
+	// publishMu serializes what the shared proxy is sent, so the last
+	// registration it gets is the latest.
+	publishMu sync.Mutex
+	changed   atomic.Bool // routes changed since they were last sent
+	stopped   bool        // deregistered; guarded by publishMu
 }
 
 func New(cfg *config.Config) *Proxy {
-	return &Proxy{
+	// The listen address is validated when the config loads.
+	host, port, _ := cfg.Proxy.ListenAddr()
+	p := &Proxy{
 		cfg:    cfg,
 		router: newRouter(cfg),
-		certs:  newCertManager(defaultCertDir),
+		certs:  newCertManager(filepath.Join(cfg.StateDir(), certDirName), newCertBackend(cfg.Proxy.CA)),
 		hosts:  newHostsManager(cfg.Name),
-		port:   defaultPort,
+		host:   host,
+		port:   port,
+		https:  cfg.Proxy.HTTPSEnabled(),
+	}
+	if cfg.Proxy.Shared {
+		// The shared proxy serves certificates and DNS for every project.
+		// If the config directory is unknown, Setup reports it.
+		if dir, err := DaemonDir(); err == nil {
+			p.shared = newSharedClient(filepath.Join(dir, socketName))
+			p.certs = newCertManager(filepath.Join(dir, certDirName), p.certs.backend)
+		}
+		return p
 	}
+	if cfg.Proxy.Domain != "" && cfg.Proxy.DNS != config.DNSHosts {
+		p.dns = newDNSServer(DNSServerAddr(), dnsZones(cfg.Proxy.Domain, p.router.domains())...)
+	}
+	return p
 }
 
 func (p *Proxy) Setup() error {
@@ -43,52 +81,253 @@ func (p *Proxy) Setup() error {
 		return fmt.Errorf("no proxy domain configured")
 	}
 
+	if p.cfg.Proxy.Shared {
+		return p.setupShared()
+	}
+
+	if p.dns != nil {
+		if err := p.dns.start(); err != nil {
+			return fmt.Errorf("starting DNS server: %w (is another lokl project running? set proxy.dns: hosts to use /etc/hosts instead)", err)
+		}
+	}
+
+	if !p.https {
+		return nil
+	}
+
 	if err := p.certs.ensureCA(); err != nil {
 		return fmt.Errorf("setting up CA: %w", err)
 	}
 
-	if _, _, err := p.certs.generate(domain); err != nil {
-		return fmt.Errorf("generating certificate: %w", err)
+	// Issue certificates up front so problems show before the TUI starts.
+	for _, name := range p.serverNames() {
+		if _, err := p.certs.certificate(name); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// setupShared starts the shared proxy if needed and registers the
+// project's routes with it.
+func (p *Proxy) setupShared() error {
+	if p.shared == nil {
+		_, err := DaemonDir()
+		return fmt.Errorf("connecting to shared proxy: %w", err)
+	}
+	if err := ensureDaemon(p.shared, p.cfg.Proxy); err != nil {
+		return err
+	}
+	if err := p.shared.register(p.registration()); err != nil {
+		return fmt.Errorf("registering with shared proxy: %w", err)
+	}
+	return nil
+}
+
+// registration describes the project's routes for the shared proxy.
+func (p *Proxy) registration() Registration {
+	reg := Registration{
+		Project: p.cfg.Name,
+		Dir:     p.cfg.Dir,
+		PID:     os.Getpid(),
+		Domain:  p.router.domain(),
+		Addr:    p.Addr(),
+		HTTPS:   p.https,
+		CA:      p.cfg.Proxy.CA,
+		DNS:     p.cfg.Proxy.DNS != config.DNSHosts,
+	}
+	for _, rt := range p.router.all() {
+		reg.Routes = append(reg.Routes, routeInfo(rt))
+	}
+	return reg
+}
+
+// Publish sends changed routes to the shared proxy. It is a round trip
+// over the control socket, so callers make it after releasing their own
+// locks. A failure is not fatal: the shared proxy keeps the previous
+// routes and the next change sends them all again.
+func (p *Proxy) Publish() {
+	if p.shared == nil {
+		return
+	}
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	if p.stopped || !p.changed.Swap(false) {
+		return
+	}
+	_ = p.shared.register(p.registration())
+}
+
+// Start serves until Stop. With a shared proxy there is nothing to serve
+// and it returns at once.
 func (p *Proxy) Start() error {
-	domain := p.router.domain()
-	certPath := p.certs.certPath(domain)
-	keyPath := p.certs.keyPath(domain)
+	if p.shared != nil {
+		return nil
+	}
 
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	lns, err := listenHosts(p.cfg.Proxy.ListenHosts(), p.port)
 	if err != nil {
-		return fmt.Errorf("loading certificate: %w", err)
+		return err
+	}
+
+	if !p.https {
+		p.server = &http.Server{
+			Handler: newHandler(p.router, schemeHTTP),
+		}
+		return serve(p.server, lns, false)
 	}
 
-	handler := newHandler(p.router)
+	if p.cfg.Proxy.HTTPRedirect {
+		if err := p.startRedirect(); err != nil {
+			closeAll(lns)
+			return err
+		}
+	}
 
 	p.server = &http.Server{
-		Addr:    fmt.Sprintf("0.0.0.0:%d", p.port),
-		Handler: handler,
+		Handler: newHandler(p.router, schemeHTTPS),
 		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{cert},
+			GetCertificate: p.getCertificate,
 		},
 	}
 
-	return p.server.ListenAndServeTLS("", "")
+	return serve(p.server, lns, true)
+}
+
+// startRedirect listens on port 80 of the proxy hosts and redirects to
+// HTTPS. The port is bound before returning so a conflict fails Start.
+func (p *Proxy) startRedirect() error {
+	lns, err := listenHosts(p.cfg.Proxy.ListenHosts(), httpPort)
+	if err != nil {
+		return fmt.Errorf("starting HTTP redirect: %w", err)
+	}
+
+	p.redirect = &http.Server{
+		Handler: newRedirectHandler(p.cfg.Proxy.URLPort(), newHandler(p.router, schemeHTTP)),
+	}
+	go func() {
+		_ = serve(p.redirect, lns, false)
+	}()
+	return nil
+}
+
+// listenHosts binds port on every host. The first host is required; the
+// others are extra loopback addresses and are skipped when the system does
+// not support them, such as ::1 without IPv6.
+func listenHosts(hosts []string, port int) ([]net.Listener, error) {
+	var lns []net.Listener
+	for i, host := range hosts {
+		ln, err := listen(net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			if i > 0 && (errors.Is(err, syscall.EADDRNOTAVAIL) || errors.Is(err, syscall.EAFNOSUPPORT)) {
+				continue
+			}
+			closeAll(lns)
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+func closeAll(lns []net.Listener) {
+	for _, ln := range lns {
+		_ = ln.Close()
+	}
+}
+
+// serve runs srv on every listener and blocks on the first. Shutting srv
+// down closes them all.
+func serve(srv *http.Server, lns []net.Listener, useTLS bool) error {
+	run := func(ln net.Listener) error {
+		if useTLS {
+			return srv.ServeTLS(ln, "", "")
+		}
+		return srv.Serve(ln)
+	}
+	for _, ln := range lns[1:] {
+		go func() { _ = run(ln) }()
+	}
+	return run(lns[0])
+}
+
+func listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if errors.Is(err, syscall.EACCES) {
+		return nil, fmt.Errorf("binding %s: permission denied; run lokl setup-port once, or set proxy.listen to a port above 1023", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("binding %s: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// getCertificate serves a certificate for the requested server name, as
+// long as the router covers it.
+func (p *Proxy) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return serveCertificate(p.certs, hello, p.router.domain(), p.serverNames())
+}
+
+// serveCertificate returns the certificate for the server name a client
+// asked for, or for fallback if it sent none. Only names are served; a
+// name covered by a wildcard host gets the wildcard's certificate.
+func serveCertificate(certs *certManager, hello *tls.ClientHelloInfo, fallback string, names []string) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		name = fallback
+	}
+	if slices.Contains(names, name) {
+		return certs.certificate(name)
+	}
+	if pattern := wildcardFor(name); pattern != "" && slices.Contains(names, pattern) {
+		return certs.certificate(pattern)
+	}
+	return nil, fmt.Errorf("no route for %q", name)
+}
+
+// serverNames lists every name the proxy serves a certificate for: the
+// routed domains and the proxy domain itself.
+func (p *Proxy) serverNames() []string {
+	names := p.router.domains()
+	if domain := p.router.domain(); !slices.Contains(names, domain) {
+		names = append(names, domain)
+	}
+	slices.Sort(names)
+	return names
 }
 
 func (p *Proxy) Stop(cleanupDNS bool) error {
 	var errs []error
 
-	if p.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-		defer cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-		if err := p.server.Shutdown(ctx); err != nil {
+	for _, srv := range []*http.Server{p.server, p.redirect} {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil {
 			errs = append(errs, fmt.Errorf("shutting down server: %w", err))
 		}
 	}
 
+	if p.dns != nil {
+		if err := p.dns.stop(); err != nil {
+			errs = append(errs, fmt.Errorf("stopping DNS server: %w", err))
+		}
+	}
+
+	if p.shared != nil {
+		p.publishMu.Lock()
+		p.stopped = true
+		p.publishMu.Unlock()
+		if err := p.shared.deregister(p.cfg.Dir); err != nil {
+			errs = append(errs, fmt.Errorf("deregistering from shared proxy: %w", err))
+		}
+	}
+
 	if cleanupDNS {
 		if err := p.hosts.remove(); err != nil {
 			errs = append(errs, fmt.Errorf("removing DNS entries: %w", err))
@@ -101,54 +340,128 @@ func (p *Proxy) Stop(cleanupDNS bool) error {
 	return nil
 }
 
-func (p *Proxy) Port() int {
-	return p.port
+// Reload rebuilds routes from a reloaded config. Toggle state is kept for
+// domains that still exist.
+func (p *Proxy) Reload(cfg *config.Config) error {
+	if cfg.Proxy.Domain != p.router.domain() {
+		return fmt.Errorf("proxy domain cannot change while running")
+	}
+	if cfg.Proxy.HTTPSEnabled() != p.https || cfg.Proxy.HTTPRedirect != p.cfg.Proxy.HTTPRedirect {
+		return fmt.Errorf("proxy.https and proxy.http_redirect cannot change while running")
+	}
+	if (cfg.Proxy.DNS == config.DNSHosts) != (p.dns == nil) {
+		return fmt.Errorf("proxy.dns cannot change while running")
+	}
+	if host, port, _ := cfg.Proxy.ListenAddr(); host != p.host || port != p.port || cfg.Proxy.PublicPort != p.cfg.Proxy.PublicPort {
+		return fmt.Errorf("proxy.listen and proxy.public_port cannot change while running")
+	}
+	if cfg.Proxy.Shared != p.cfg.Proxy.Shared {
+		return fmt.Errorf("proxy.shared cannot change while running")
+	}
+
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+	p.cfg = cfg
+	p.router.update(cfg)
+	if p.shared != nil {
+		p.changed.Store(false)
+		return p.shared.register(p.registration())
+	}
+	if p.dns != nil {
+		p.dns.setZones(p.Zones())
+	}
+	p.certs.retain(p.serverNames())
+	return nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() string {
+	return net.JoinHostPort(p.host, strconv.Itoa(p.port))
 }
 
 func (p *Proxy) Domains() []string {
 	return p.router.domains()
 }
 
+// Zones returns the DNS zones the project's hosts fall in: the proxy
+// domain and any host outside it.
+func (p *Proxy) Zones() []string {
+	return dnsZones(p.router.domain(), p.router.domains())
+}
+
 func (p *Proxy) CertDir() string {
-	abs, _ := filepath.Abs(defaultCertDir)
+	abs, _ := filepath.Abs(p.certs.dir)
 	return abs
 }
 
+// CATrusted reports whether browsers will accept the proxy's certificates
+// without a warning.
+func (p *Proxy) CATrusted() bool {
+	if !p.https {
+		return true
+	}
+	return p.certs.backend.trusted()
+}
+
 func (p *Proxy) NeedsSudo() bool {
 	return p.hosts.needsSudo()
 }
 
 func (p *Proxy) UnresolvedDomains() []string {
-	return p.hosts.unresolved(p.router.enabledDomains())
+	return p.hosts.unresolved(p.hostsDomains())
+}
+
+// hostsDomains returns the enabled hosts that can be listed in /etc/hosts,
+// which has no wildcards.
+func (p *Proxy) hostsDomains() []string {
+	return slices.DeleteFunc(p.router.enabledDomains(), config.IsWildcardHost)
 }
 
-func (p *Proxy) DNSBlock() string {
-	return p.hosts.block(p.router.enabledDomains())
+// DNSHelp explains how to make unresolved domains resolve in the current
+// DNS mode.
+func (p *Proxy) DNSHelp() string {
+	if p.cfg.Proxy.DNS != config.DNSHosts {
+		return "Run once:\n  lokl dns install\n\nOr set proxy.dns: hosts to use /etc/hosts instead."
+	}
+	block := strings.ReplaceAll(p.hosts.block(p.hostsDomains()), "\n", "\n  ")
+	return "Option 1 - Run:\n  sudo lokl dns setup\n\nOption 2 - Add manually to /etc/hosts:\n  " + block +
+		"\n\nOption 3 - Set proxy.dns: server and run once:\n  lokl dns install"
 }
 
 func (p *Proxy) SetupDNS() error {
-	return p.hosts.add(p.router.enabledDomains())
+	return p.hosts.add(p.hostsDomains())
 }
 
 func (p *Proxy) RemoveDNS() error {
 	return p.hosts.remove()
 }
 
-// EnableProxy enables local proxy routing for a domain
-func (p *Proxy) EnableProxy(domain string) bool {
-	return p.router.setEnabled(domain, true)
+// EnableProxy enables local proxy routing for a service
+func (p *Proxy) EnableProxy(service string) bool {
+	ok := p.router.setEnabled(service, true)
+	p.changed.Store(true)
+	return ok
 }
 
 // DisableProxy disables local proxy routing (traffic goes to remote)
-func (p *Proxy) DisableProxy(domain string) bool {
-	return p.router.setEnabled(domain, false)
+func (p *Proxy) DisableProxy(service string) bool {
+	ok := p.router.setEnabled(service, false)
+	p.changed.Store(true)
+	return ok
+}
+
+// SetPort updates the local port a service's routes go to
+func (p *Proxy) SetPort(service string, port int) bool {
+	ok := p.router.setPort(service, port)
+	p.changed.Store(true)
+	return ok
 }
 
-// IsProxyEnabled returns whether local proxy routing is enabled for a domain
-func (p *Proxy) IsProxyEnabled(domain string) bool {
-	rt := p.router.match(domain)
-	if rt == nil {
+// IsProxyEnabled returns whether local proxy routing is enabled for a service
+func (p *Proxy) IsProxyEnabled(service string) bool {
+	b := p.router.service(service)
+	if b == nil {
 		return false
 	}
-	return rt.enabled.Load()
+	return b.enabled.Load()
 }
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// wellKnownPrefix is passed through to services over plain HTTP instead of
+// being redirected, so ACME-style HTTP challenges keep working.
+const wellKnownPrefix = "/.well-known/"
+
+// newRedirectHandler permanently redirects plain HTTP requests to HTTPS on
+// port. Requests under /.well-known/ are served by next.
+func newRedirectHandler(port int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, wellKnownPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != httpsPort {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
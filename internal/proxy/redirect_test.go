@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name     string
+		port     int
+		url      string
+		wantCode int
+		wantLoc  string
+	}{
+		{
+			name:     "redirects to https",
+			port:     443,
+			url:      "http://app.myapp.dev/login?next=%2F",
+			wantCode: http.StatusMovedPermanently,
+			wantLoc:  "https://app.myapp.dev/login?next=%2F",
+		},
+		{
+			name:     "keeps non-default https port",
+			port:     8443,
+			url:      "http://app.myapp.dev:8080/",
+			wantCode: http.StatusMovedPermanently,
+			wantLoc:  "https://app.myapp.dev:8443/",
+		},
+		{
+			name:     "passes well-known through",
+			port:     443,
+			url:      "http://app.myapp.dev/.well-known/acme-challenge/token",
+			wantCode: http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newRedirectHandler(tt.port, next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if loc := rec.Header().Get("Location"); loc != tt.wantLoc {
+				t.Errorf("Location = %q, want %q", loc, tt.wantLoc)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// resolverSetup is a way of routing one domain to the embedded DNS server
+// through the system resolver.
+type resolverSetup struct {
+	name string
+	// files are written on install and removed on uninstall.
+	files func(domain string) []resolverFile
+	// apply runs after the files are written, and remove after they are
+	// removed.
+	apply  func(domain string) [][]string
+	remove func(domain string) [][]string
+	// installed reports whether anything is set up for domain. It defaults
+	// to checking for the files.
+	installed func(domain string) bool
+	// describe names what was set up, for messages. It defaults to the
+	// file paths.
+	describe func(domain string) string
+}
+
+type resolverFile struct {
+	path    string
+	content string
+}
+
+const (
+	networkdDir = "/etc/systemd/network"
+	// resolvedDropInDir held the global drop-ins earlier lokl versions
+	// wrote; they are removed when found.
+	resolvedDropInDir = "/etc/systemd/resolved.conf.d"
+)
+
+var (
+	// systemd-resolved only sends a domain to a DNS server of its own if
+	// the server belongs to a link, so each domain gets a dummy link with
+	// lokl's server and a routing-only (~) domain. A global DNS= would
+	// make lokl's server a candidate for every query. With networkd the
+	// link is declared in .netdev and .network files and survives reboots.
+	networkdSetup = resolverSetup{
+		name: "systemd-networkd",
+		files: func(domain string) []resolverFile {
+			link := resolverLink(domain)
+			base := filepath.Join(networkdDir, "lokl-"+domain)
+			return []resolverFile{
+				{base + ".netdev", fmt.Sprintf("# Written by lokl dns install\n[NetDev]\nName=%s\nKind=dummy\n", link)},
+				{base + ".network", fmt.Sprintf("# Written by lokl dns install\n[Match]\nName=%s\n\n[Link]\nRequiredForOnline=no\n\n[Network]\nDNS=%s\nDomains=~%s\nDNSDefaultRoute=no\n", link, DNSServerAddr(), domain)},
+			}
+		},
+		apply: func(string) [][]string {
+			return [][]string{{"networkctl", "reload"}}
+		},
+		remove: func(domain string) [][]string {
+			cmds := [][]string{{"networkctl", "reload"}}
+			if linkExists(resolverLink(domain)) {
+				cmds = append(cmds, []string{"ip", "link", "delete", resolverLink(domain)})
+			}
+			return cmds
+		},
+	}
+
+	// Without networkd the link is created at runtime and configured
+	// through resolvectl, so it lasts until the next reboot.
+	resolvedLinkSetup = resolverSetup{
+		name: "systemd-resolved",
+		files: func(string) []resolverFile {
+			return nil
+		},
+		apply: func(domain string) [][]string {
+			link := resolverLink(domain)
+			var cmds [][]string
+			if !linkExists(link) {
+				cmds = append(cmds, []string{"ip", "link", "add", link, "type", "dummy"})
+			}
+			return append(cmds,
+				[]string{"ip", "link", "set", link, "up"},
+				[]string{"resolvectl", "dns", link, DNSServerAddr()},
+				[]string{"resolvectl", "domain", link, "~" + domain},
+				[]string{"resolvectl", "default-route", link, "false"},
+			)
+		},
+		remove: func(domain string) [][]string {
+			return [][]string{{"ip", "link", "delete", resolverLink(domain)}}
+		},
+		installed: func(domain string) bool {
+			return linkExists(resolverLink(domain))
+		},
+		describe: func(domain string) string {
+			return "link " + resolverLink(domain) + ", until reboot"
+		},
+	}
+
+	dnsmasqSetup = resolverSetup{
+		name: "NetworkManager dnsmasq",
+		files: func(domain string) []resolverFile {
+			return []resolverFile{{
+				filepath.Join("/etc/NetworkManager/dnsmasq.d", "lokl-"+domain+".conf"),
+				fmt.Sprintf("# Written by lokl dns install\nserver=/%s/%s#%d\n", domain, dnsServerHost, dnsServerPort),
+			}}
+		},
+		apply:  reloadNetworkManager,
+		remove: reloadNetworkManager,
+	}
+
+	macResolverSetup = resolverSetup{
+		name: "macOS resolver",
+		files: func(domain string) []resolverFile {
+			return []resolverFile{{
+				filepath.Join("/etc/resolver", domain),
+				fmt.Sprintf("# Written by lokl dns install\nnameserver %s\nport %d\n", dnsServerHost, dnsServerPort),
+			}}
+		},
+	}
+)
+
+func reloadNetworkManager(string) [][]string {
+	return [][]string{{"systemctl", "reload", "NetworkManager"}}
+}
+
+// resolverLink names the dummy link for domain. Link names are limited to
+// 15 characters, so the domain is hashed.
+func resolverLink(domain string) string {
+	sum := sha256.Sum256([]byte(domain))
+	return "lokl" + hex.EncodeToString(sum[:4])
+}
+
+func linkExists(name string) bool {
+	return fileExists(filepath.Join("/sys/class/net", name))
+}
+
+// InstallResolver points the system resolver at the embedded DNS server
+// for domain, so every subdomain resolves while lokl runs. Commands that
+// need root are run through sudo. It returns what was set up.
+func InstallResolver(domain string) (string, error) {
+	setup, err := detectResolver()
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range setup.files(domain) {
+		if err := installFile(f.path, f.content); err != nil {
+			return "", err
+		}
+	}
+	if err := runAll(setup.apply, domain); err != nil {
+		return "", err
+	}
+	if err := removeResolvedDropIn(domain); err != nil {
+		return "", err
+	}
+	return setup.description(domain) + " (" + setup.name + ")", nil
+}
+
+// UninstallResolver removes what InstallResolver set up for domain. It
+// returns what was removed, or "" if there was nothing.
+func UninstallResolver(domain string) (string, error) {
+	setup, err := detectResolver()
+	if err != nil {
+		return "", err
+	}
+
+	removed := ""
+	if setup.isInstalled(domain) {
+		description := setup.description(domain)
+		for _, f := range setup.files(domain) {
+			if err := sudo("rm", "-f", f.path); err != nil {
+				return "", err
+			}
+		}
+		if err := runAll(setup.remove, domain); err != nil {
+			return "", err
+		}
+		removed = description
+	}
+
+	if path := resolvedDropIn(domain); fileExists(path) {
+		if err := removeResolvedDropIn(domain); err != nil {
+			return "", err
+		}
+		removed = strings.TrimPrefix(removed+", "+path, ", ")
+	}
+	return removed, nil
+}
+
+func (s resolverSetup) isInstalled(domain string) bool {
+	if s.installed != nil {
+		return s.installed(domain)
+	}
+	for _, f := range s.files(domain) {
+		if fileExists(f.path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s resolverSetup) description(domain string) string {
+	if s.describe != nil {
+		return s.describe(domain)
+	}
+	var paths []string
+	for _, f := range s.files(domain) {
+		paths = append(paths, f.path)
+	}
+	return strings.Join(paths, ", ")
+}
+
+func runAll(cmds func(domain string) [][]string, domain string) error {
+	if cmds == nil {
+		return nil
+	}
+	for _, args := range cmds(domain) {
+		if err := sudo(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolvedDropIn(domain string) string {
+	return filepath.Join(resolvedDropInDir, "lokl-"+domain+".conf")
+}
+
+// removeResolvedDropIn removes the global systemd-resolved drop-in earlier
+// versions wrote for domain, if there is one.
+func removeResolvedDropIn(domain string) error {
+	path := resolvedDropIn(domain)
+	if !fileExists(path) {
+		return nil
+	}
+	if err := sudo("rm", "-f", path); err != nil {
+		return err
+	}
+	return sudo("systemctl", "restart", "systemd-resolved")
+}
+
+// DNSServerAddr returns the address of the embedded DNS server.
+func DNSServerAddr() string {
+	return dnsServerHost + ":" + strconv.Itoa(dnsServerPort)
+}
+
+func detectResolver() (resolverSetup, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return macResolverSetup, nil
+	case "linux":
+		if _, err := exec.LookPath("resolvectl"); err == nil && fileExists("/run/systemd/resolve") {
+			if exec.Command("systemctl", "is-active", "--quiet", "systemd-networkd").Run() == nil {
+				return networkdSetup, nil
+			}
+			return resolvedLinkSetup, nil
+		}
+		if fileExists("/etc/NetworkManager/dnsmasq.d") {
+			return dnsmasqSetup, nil
+		}
+	}
+	return resolverSetup{}, errors.New("no supported system resolver found (systemd-resolved, NetworkManager with dnsmasq, or macOS); set proxy.dns: hosts to use /etc/hosts instead")
+}
+
+// installFile writes content to a root-owned path through sudo.
+func installFile(path, content string) error {
+	tmp, err := os.CreateTemp("", "lokl-*")
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	if err := sudo("mkdir", "-p", filepath.Dir(path)); err != nil {
+		return err
+	}
+	return sudo("install", "-m", "0644", tmp.Name(), path)
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolverLink(t *testing.T) {
+	link := resolverLink("myapp.dev")
+	if len(link) > 15 || !strings.HasPrefix(link, "lokl") {
+		t.Errorf("resolverLink() = %q, want a lokl link name of at most 15 characters", link)
+	}
+	if resolverLink("other.dev") == link {
+		t.Error("different domains share a link")
+	}
+}
+
+func TestNetworkdFiles(t *testing.T) {
+	files := networkdSetup.files("myapp.dev")
+	if len(files) != 2 {
+		t.Fatalf("files = %d, want 2", len(files))
+	}
+
+	network := files[1].content
+	for _, want := range []string{
+		"Name=" + resolverLink("myapp.dev"),
+		"DNS=127.0.0.1:15353",
+		"Domains=~myapp.dev",
+		"DNSDefaultRoute=no",
+	} {
+		if !strings.Contains(network, want) {
+			t.Errorf("%s is missing %q:\n%s", files[1].path, want, network)
+		}
+	}
+	if strings.Contains(files[0].content+network, "[Resolve]") {
+		t.Error("networkd files must not configure resolved globally")
+	}
+}
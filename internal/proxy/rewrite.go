@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+type rewriteConfig struct {
+	stripPrefix string
+	fallback    string
+	rules       []rewriteRule
+	spec        *config.RewriteConfig // as configured, for the shared proxy
+}
+
+type rewriteRule struct {
+	match      *regexp.Regexp // nil matches every path
+	rewrite    string
+	redirect   string
+	status     int
+	fallback   string
+	except     []*regexp.Regexp // nil skips asset paths
+	onNotFound bool
+}
+
+// rewriteResult is what a rewrite config does with a request path.
+type rewriteResult struct {
+	path     string
+	redirect string // if set, the client is sent here with status
+	status   int
+	// notFound is the path to serve instead if the service answers 404 to
+	// a page request.
+	notFound string
+}
+
+// newRewrite compiles a service's rewrite config. Patterns are checked
+// when the config loads, so rules that do not compile are skipped.
+func newRewrite(rw *config.RewriteConfig) *rewriteConfig {
+	if rw == nil {
+		return nil
+	}
+
+	c := &rewriteConfig{stripPrefix: rw.StripPrefix, fallback: rw.Fallback, spec: rw}
+	for _, rc := range rw.Rules {
+		rule := rewriteRule{
+			rewrite:    rc.Rewrite,
+			redirect:   rc.Redirect,
+			status:     rc.Status,
+			fallback:   rc.Fallback,
+			onNotFound: rc.OnNotFound,
+		}
+		if rule.redirect != "" && rule.status == 0 {
+			rule.status = http.StatusFound
+		}
+
+		var err error
+		if rc.Match != "" {
+			if rule.match, err = regexp.Compile(rc.Match); err != nil {
+				continue
+			}
+		}
+		for _, pattern := range rc.Except {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				continue
+			}
+			rule.except = append(rule.except, re)
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c
+}
+
+// apply runs the rewrite steps on a path in order: strip_prefix, the rules,
+// then fallback. A redirect or fallback rule ends the run; redirect targets
+// on the same host get the stripped prefix back.
+func (rw *rewriteConfig) apply(p string) rewriteResult {
+	var prefix string
+	if rw.stripPrefix != "" {
+		prefix = "/" + rw.stripPrefix
+		p = stripPathPrefix(p, prefix)
+	}
+	stripped := p
+
+	for _, rule := range rw.rules {
+		var m []int
+		if rule.match != nil {
+			if m = rule.match.FindStringSubmatchIndex(p); m == nil {
+				continue
+			}
+		}
+
+		switch {
+		case rule.rewrite != "":
+			p = expand(rule.match, rule.rewrite, p, m)
+		case rule.redirect != "":
+			target := unstripRedirect(expand(rule.match, rule.redirect, p, m), stripped, prefix)
+			return rewriteResult{path: p, redirect: target, status: rule.status}
+		case rule.fallback != "" && !rule.excepts(p):
+			if rule.onNotFound {
+				return rewriteResult{path: p, notFound: rule.fallback}
+			}
+			return rewriteResult{path: rule.fallback}
+		}
+	}
+
+	if rw.fallback != "" && !isAssetPath(p) {
+		return rewriteResult{path: rw.fallback}
+	}
+	return rewriteResult{path: p}
+}
+
+func expand(re *regexp.Regexp, template, src string, m []int) string {
+	if re == nil {
+		return template
+	}
+	return string(re.ExpandString(nil, template, src, m))
+}
+
+// excepts reports whether a fallback rule leaves p alone.
+func (rule rewriteRule) excepts(p string) bool {
+	if rule.except == nil {
+		return isAssetPath(p)
+	}
+	for _, re := range rule.except {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsHTML reports whether r is a page load a 404 fallback applies to.
+func acceptsHTML(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func isAssetPath(p string) bool {
+	assetPrefixes := []string{"/assets/", "/static/", "/@vite/", "/@fs/", "/__vite_ping"}
+	for _, prefix := range assetPrefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(p))
+	assetExts := map[string]bool{
+		".js": true, ".mjs": true, ".cjs": true,
+		".css": true, ".scss": true, ".sass": true, ".less": true,
+		".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true,
+		".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+		".json": true, ".map": true,
+		".html": true, ".htm": true,
+		".mp4": true, ".webm": true, ".mp3": true, ".wav": true,
+		".pdf": true,
+	}
+
+	return assetExts[ext]
+}
@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+func TestRewritePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		rw   *rewriteConfig
+		want string
+	}{
+		{
+			name: "strip prefix",
+			path: "/customer-funnel/dashboard",
+			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
+			want: "/dashboard",
+		},
+		{
+			name: "strip prefix root",
+			path: "/customer-funnel",
+			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
+			want: "/",
+		},
+		{
+			name: "strip prefix with trailing slash",
+			path: "/customer-funnel/",
+			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
+			want: "/",
+		},
+		{
+			name: "no match prefix",
+			path: "/other/path",
+			rw:   &rewriteConfig{stripPrefix: "customer-funnel"},
+			want: "/other/path",
+		},
+		{
+			name: "fallback for non-asset",
+			path: "/dashboard",
+			rw:   &rewriteConfig{fallback: "/index.html"},
+			want: "/index.html",
+		},
+		{
+			name: "no fallback for asset",
+			path: "/assets/main.js",
+			rw:   &rewriteConfig{fallback: "/index.html"},
+			want: "/assets/main.js",
+		},
+		{
+			name: "strip prefix then fallback",
+			path: "/customer-funnel/dashboard",
+			rw:   &rewriteConfig{stripPrefix: "customer-funnel", fallback: "/index.html"},
+			want: "/index.html",
+		},
+		{
+			name: "strip prefix keep asset",
+			path: "/customer-funnel/assets/main.js",
+			rw:   &rewriteConfig{stripPrefix: "customer-funnel", fallback: "/index.html"},
+			want: "/assets/main.js",
+		},
+		{
+			name: "empty config",
+			path: "/some/path",
+			rw:   &rewriteConfig{},
+			want: "/some/path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rw.apply(tt.path).path
+			if got != tt.want {
+				t.Errorf("rewritePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAssetPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		// By extension
+		{"/main.js", true},
+		{"/style.css", true},
+		{"/image.png", true},
+		{"/font.woff2", true},
+		{"/data.json", true},
+		{"/page.html", true},
+		{"/app.mjs", true},
+
+		// By prefix
+		{"/assets/anything", true},
+		{"/static/file.txt", true},
+		{"/@vite/client", true},
+		{"/@fs/some/path", true},
+		{"/__vite_ping", true},
+
+		// Non-assets
+		{"/dashboard", false},
+		{"/users/123", false},
+		{"/api/data", false},
+		{"/", false},
+		{"/settings", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := isAssetPath(tt.path)
+			if got != tt.want {
+				t.Errorf("isAssetPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rw   config.RewriteConfig
+		path string
+		want rewriteResult
+	}{
+		{
+			name: "rewrite with capture groups",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `^/users/(\d+)$`, Rewrite: "/profile/$1"}}},
+			path: "/users/42",
+			want: rewriteResult{path: "/profile/42"},
+		},
+		{
+			name: "rewrite with named groups",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `^/v(?P<version>\d)/(?P<rest>.*)$`, Rewrite: "/api/${rest}/v${version}"}}},
+			path: "/v2/orders",
+			want: rewriteResult{path: "/api/orders/v2"},
+		},
+		{
+			name: "rewrite does not match",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `^/users/(\d+)$`, Rewrite: "/profile"}}},
+			path: "/users/me",
+			want: rewriteResult{path: "/users/me"},
+		},
+		{
+			name: "rules see earlier rewrites",
+			rw: config.RewriteConfig{Rules: []config.RewriteRule{
+				{Match: `^/old/(.*)$`, Rewrite: "/new/$1"},
+				{Match: `^/new/(.*)$`, Rewrite: "/v2/$1"},
+			}},
+			path: "/old/page",
+			want: rewriteResult{path: "/v2/page"},
+		},
+		{
+			name: "runs after strip_prefix",
+			rw:   config.RewriteConfig{StripPrefix: "app", Rules: []config.RewriteRule{{Match: `^/$`, Rewrite: "/home"}}},
+			path: "/app",
+			want: rewriteResult{path: "/home"},
+		},
+		{
+			name: "redirect defaults to 302",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `^/docs/(.*)$`, Redirect: "https://docs.example.com/$1"}}},
+			path: "/docs/intro",
+			want: rewriteResult{path: "/docs/intro", redirect: "https://docs.example.com/intro", status: http.StatusFound},
+		},
+		{
+			name: "permanent redirect",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `^/old$`, Redirect: "/new", Status: http.StatusMovedPermanently}}},
+			path: "/old",
+			want: rewriteResult{path: "/old", redirect: "/new", status: http.StatusMovedPermanently},
+		},
+		{
+			name: "redirect after strip_prefix keeps the prefix",
+			rw:   config.RewriteConfig{StripPrefix: "app", Rules: []config.RewriteRule{{Match: `^/old$`, Redirect: "/new"}}},
+			path: "/app/old",
+			want: rewriteResult{path: "/old", redirect: "/app/new", status: http.StatusFound},
+		},
+		{
+			name: "relative redirect after strip_prefix",
+			rw:   config.RewriteConfig{StripPrefix: "app", Rules: []config.RewriteRule{{Match: `^/docs/old$`, Redirect: "new?v=2"}}},
+			path: "/app/docs/old",
+			want: rewriteResult{path: "/docs/old", redirect: "/app/docs/new?v=2", status: http.StatusFound},
+		},
+		{
+			name: "redirect to URL after strip_prefix",
+			rw:   config.RewriteConfig{StripPrefix: "app", Rules: []config.RewriteRule{{Match: `^/docs/(.*)$`, Redirect: "https://docs.example.com/$1"}}},
+			path: "/app/docs/intro",
+			want: rewriteResult{path: "/docs/intro", redirect: "https://docs.example.com/intro", status: http.StatusFound},
+		},
+		{
+			name: "redirect ends the rules",
+			rw: config.RewriteConfig{Rules: []config.RewriteRule{
+				{Match: `^/login$`, Redirect: "/auth", Status: http.StatusTemporaryRedirect},
+				{Match: `^/login$`, Rewrite: "/other"},
+			}},
+			path: "/login",
+			want: rewriteResult{path: "/login", redirect: "/auth", status: http.StatusTemporaryRedirect},
+		},
+		{
+			name: "fallback skips asset paths by default",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Fallback: "/index.html"}}},
+			path: "/assets/app.js",
+			want: rewriteResult{path: "/assets/app.js"},
+		},
+		{
+			name: "fallback with except",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Fallback: "/index.html", Except: []string{`^/_next/`, `^/api/`}}}},
+			path: "/dashboard",
+			want: rewriteResult{path: "/index.html"},
+		},
+		{
+			name: "except replaces the asset paths",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Fallback: "/index.html", Except: []string{`^/_next/`, `^/api/`}}}},
+			path: "/_next/static/chunk.js",
+			want: rewriteResult{path: "/_next/static/chunk.js"},
+		},
+		{
+			name: "except lets data files fall back",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Fallback: "/index.html", Except: []string{`^/api/`}}}},
+			path: "/users.json",
+			want: rewriteResult{path: "/index.html"},
+		},
+		{
+			name: "fallback limited by match",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `^/admin(/|$)`, Fallback: "/admin/index.html"}}},
+			path: "/settings",
+			want: rewriteResult{path: "/settings"},
+		},
+		{
+			name: "fallback on not found",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Fallback: "/index.html", OnNotFound: true}}},
+			path: "/dashboard",
+			want: rewriteResult{path: "/dashboard", notFound: "/index.html"},
+		},
+		{
+			name: "rule fallback before legacy fallback",
+			rw: config.RewriteConfig{
+				Fallback: "/index.html",
+				Rules:    []config.RewriteRule{{Match: `^/admin/`, Fallback: "/admin.html"}},
+			},
+			path: "/admin/users",
+			want: rewriteResult{path: "/admin.html"},
+		},
+		{
+			name: "invalid pattern is skipped",
+			rw:   config.RewriteConfig{Rules: []config.RewriteRule{{Match: `(`, Rewrite: "/x"}}},
+			path: "/a",
+			want: rewriteResult{path: "/a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRewrite(&tt.rw).apply(tt.path); got != tt.want {
+				t.Errorf("apply(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptsHTML(t *testing.T) {
+	tests := []struct {
+		method string
+		accept string
+		want   bool
+	}{
+		{http.MethodGet, "text/html,application/xhtml+xml,*/*;q=0.8", true},
+		{http.MethodGet, "application/json", false},
+		{http.MethodGet, "", false},
+		{http.MethodPost, "text/html", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			if got := acceptsHTML(r); got != tt.want {
+				t.Errorf("acceptsHTML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
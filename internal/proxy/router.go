@@ -1,89 +1,225 @@
 package proxy
 
 import (
+	"cmp"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/shahin-bayat/lokl/internal/config"
 )
 
-type route struct {
-	domain  string
-	port    int
-	rewrite *rewriteConfig
+// backend is the routing state of one service, shared by all its routes.
+type backend struct {
+	service string
+	port    atomic.Int64 // 0 until a dynamic port is allocated
 	enabled atomic.Bool
 }
 
-type rewriteConfig struct {
-	stripPrefix string
-	fallback    string
+// route mounts a backend at a host and path prefix.
+type route struct {
+	*backend
+	domain      string
+	pathPrefix  string // "" matches every path
+	stripPrefix bool
+	rewrite     *rewriteConfig
+	remotePort  int // HTTPS port of the remote host; 0 means 443
+}
+
+// remoteAddr returns where host is reached when the route is toggled to
+// remote: the host, with the remote port unless it is 443.
+func (rt *route) remoteAddr(host string) string {
+	if rt.remotePort == 0 || rt.remotePort == httpsPort {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(rt.remotePort))
+}
+
+// remoteHost returns the host a request for reqHost is sent to when the
+// route is toggled to remote. Wildcard routes forward to the host the
+// client asked for, since *.suffix is not a name that resolves.
+func (rt *route) remoteHost(reqHost string) string {
+	if strings.HasPrefix(rt.domain, "*.") {
+		return requestHost(reqHost)
+	}
+	return rt.domain
+}
+
+// requestHost returns a request's Host without the port, lowercased.
+func requestHost(host string) string {
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	return strings.ToLower(host)
 }
 
 type router struct {
 	baseDomain string
-	routes     map[string]*route
+	hosts      map[string][]*route // by host or *.suffix pattern; longest path prefix first
+	backends   map[string]*backend // by service
+	mu         sync.RWMutex
 }
 
 func newRouter(cfg *config.Config) *router {
-	r := &router{
-		baseDomain: cfg.Proxy.Domain,
-		routes:     make(map[string]*route),
-	}
+	r := &router{}
+	r.set(cfg.Proxy.Domain, buildRoutes(cfg))
+	return r
+}
 
-	for _, svc := range cfg.Services {
-		if svc.Subdomain == "" || svc.Port == 0 {
+func buildRoutes(cfg *config.Config) []*route {
+	var routes []*route
+
+	for name, svc := range cfg.Services {
+		if !svc.HasPort() {
 			continue
 		}
 
-		fqdn := svc.Subdomain
-		if !strings.Contains(svc.Subdomain, ".") && cfg.Proxy.Domain != "" {
-			fqdn = svc.Subdomain + "." + cfg.Proxy.Domain
-		}
+		b := &backend{service: name}
+		b.port.Store(int64(svc.Port))
+		b.enabled.Store(true)
 
-		rt := &route{
-			domain: fqdn,
-			port:   svc.Port,
+		rw := newRewrite(svc.Rewrite)
+		for _, rc := range cfg.ServiceRoutes(svc) {
+			routes = append(routes, &route{
+				backend:     b,
+				domain:      rc.Host,
+				pathPrefix:  rc.PathPrefix,
+				stripPrefix: rc.StripPrefix,
+				rewrite:     rw,
+				remotePort:  cfg.Proxy.RemotePort,
+			})
 		}
-		rt.enabled.Store(true)
+	}
+
+	return routes
+}
+
+// set replaces the base domain and routes.
+func (r *router) set(baseDomain string, routes []*route) {
+	hosts := make(map[string][]*route)
+	backends := make(map[string]*backend)
+	for _, rt := range routes {
+		hosts[rt.domain] = append(hosts[rt.domain], rt)
+		backends[rt.service] = rt.backend
+	}
+	for _, mounts := range hosts {
+		slices.SortFunc(mounts, func(a, b *route) int {
+			return cmp.Compare(len(b.pathPrefix), len(a.pathPrefix))
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.baseDomain = baseDomain
+	r.hosts = hosts
+	r.backends = backends
+}
+
+// update replaces the routes from a reloaded config, keeping the toggle
+// state and allocated ports of services that still exist.
+func (r *router) update(cfg *config.Config) {
+	routes := buildRoutes(cfg)
 
-		if svc.Rewrite != nil {
-			rt.rewrite = &rewriteConfig{
-				stripPrefix: svc.Rewrite.StripPrefix,
-				fallback:    svc.Rewrite.Fallback,
-			}
+	r.mu.RLock()
+	for _, rt := range routes {
+		prev, ok := r.backends[rt.service]
+		if !ok || prev == rt.backend {
+			continue
+		}
+		rt.enabled.Store(prev.enabled.Load())
+		if rt.port.Load() == 0 {
+			rt.port.Store(prev.port.Load())
 		}
+	}
+	r.mu.RUnlock()
+
+	r.set(cfg.Proxy.Domain, routes)
+}
+
+// match returns the route for a request: the host's mount with the longest
+// path prefix that contains path. Mounts of the exact host win over those
+// of a wildcard pattern covering it.
+func (r *router) match(host, path string) *route {
+	host = requestHost(host)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-		r.routes[fqdn] = rt
+	if rt := matchPath(r.hosts[host], path); rt != nil {
+		return rt
 	}
+	if pattern := wildcardFor(host); pattern != "" {
+		return matchPath(r.hosts[pattern], path)
+	}
+	return nil
+}
 
-	return r
+func matchPath(mounts []*route, path string) *route {
+	for _, rt := range mounts {
+		if hasPathPrefix(path, rt.pathPrefix) {
+			// Return route even when disabled - handler decides local vs remote
+			return rt
+		}
+	}
+	return nil
 }
 
-func (r *router) match(host string) *route {
-	if idx := strings.LastIndex(host, ":"); idx != -1 {
-		host = host[:idx]
+// wildcardFor returns the pattern that covers host, replacing its first
+// label with *: t1.app.example.com -> *.app.example.com. A wildcard covers
+// a single label, as it does in certificates.
+func wildcardFor(host string) string {
+	_, rest, ok := strings.Cut(host, ".")
+	if !ok || rest == "" || strings.HasPrefix(host, "*.") {
+		return ""
 	}
+	return "*." + rest
+}
+
+// hasPathPrefix reports whether path is prefix or below it; /api matches
+// /api and /api/users but not /apix.
+func hasPathPrefix(path, prefix string) bool {
+	rest, ok := strings.CutPrefix(path, prefix)
+	return ok && (rest == "" || rest[0] == '/' || prefix == "")
+}
+
+// all returns the routes sorted by domain, then path prefix.
+func (r *router) all() []*route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	rt, ok := r.routes[host]
-	if !ok {
-		return nil
+	var routes []*route
+	for _, mounts := range r.hosts {
+		routes = append(routes, mounts...)
 	}
-	// Return route even when disabled - handler decides local vs remote
-	return rt
+	slices.SortFunc(routes, func(a, b *route) int {
+		return cmp.Or(strings.Compare(a.domain, b.domain), strings.Compare(a.pathPrefix, b.pathPrefix))
+	})
+	return routes
 }
 
 func (r *router) domains() []string {
-	domains := make([]string, 0, len(r.routes))
-	for domain := range r.routes {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	domains := make([]string, 0, len(r.hosts))
+	for domain := range r.hosts {
 		domains = append(domains, domain)
 	}
 	return domains
 }
 
+// enabledDomains returns the hosts with at least one route served locally.
 func (r *router) enabledDomains() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	var domains []string
-	for domain, rt := range r.routes {
-		if rt.enabled.Load() {
+	for domain, mounts := range r.hosts {
+		if slices.ContainsFunc(mounts, func(rt *route) bool { return rt.enabled.Load() }) {
 			domains = append(domains, domain)
 		}
 	}
@@ -91,14 +227,31 @@ func (r *router) enabledDomains() []string {
 }
 
 func (r *router) domain() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.baseDomain
 }
 
-func (r *router) setEnabled(domain string, enabled bool) bool {
-	rt, ok := r.routes[domain]
-	if !ok {
+func (r *router) service(name string) *backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.backends[name]
+}
+
+func (r *router) setPort(service string, port int) bool {
+	b := r.service(service)
+	if b == nil {
+		return false
+	}
+	b.port.Store(int64(port))
+	return true
+}
+
+func (r *router) setEnabled(service string, enabled bool) bool {
+	b := r.service(service)
+	if b == nil {
 		return false
 	}
-	rt.enabled.Store(enabled)
+	b.enabled.Store(enabled)
 	return true
 }
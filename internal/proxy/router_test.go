@@ -61,7 +61,7 @@ func TestRouterMatch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rt := r.match(tt.host)
+			rt := r.match(tt.host, "/")
 			if tt.wantNil {
 				if rt != nil {
 					t.Errorf("match(%q) = %+v, want nil", tt.host, rt)
@@ -71,8 +71,8 @@ func TestRouterMatch(t *testing.T) {
 			if rt == nil {
 				t.Fatalf("match(%q) = nil, want route", tt.host)
 			}
-			if rt.port != tt.wantPort {
-				t.Errorf("match(%q).port = %d, want %d", tt.host, rt.port, tt.wantPort)
+			if got := int(rt.port.Load()); got != tt.wantPort {
+				t.Errorf("match(%q).port = %d, want %d", tt.host, got, tt.wantPort)
 			}
 		})
 	}
@@ -94,7 +94,7 @@ func TestRouterMatchWithRewrite(t *testing.T) {
 	}
 
 	r := newRouter(cfg)
-	rt := r.match("app.example.com")
+	rt := r.match("app.example.com", "/")
 
 	if rt.rewrite == nil {
 		t.Fatal("rewrite is nil")
@@ -118,27 +118,27 @@ func TestRouterSetEnabled(t *testing.T) {
 	r := newRouter(cfg)
 
 	// Initially enabled
-	if rt := r.match("app.example.com"); rt == nil {
+	if rt := r.match("app.example.com", "/"); rt == nil {
 		t.Fatal("route should be enabled initially")
 	}
 
 	// Disable
-	if !r.setEnabled("app.example.com", false) {
+	if !r.setEnabled("web", false) {
 		t.Fatal("setEnabled returned false")
 	}
-	if rt := r.match("app.example.com"); rt == nil || rt.enabled.Load() {
+	if rt := r.match("app.example.com", "/"); rt == nil || rt.enabled.Load() {
 		t.Error("route should exist but be disabled")
 	}
 
 	// Re-enable
-	r.setEnabled("app.example.com", true)
-	if rt := r.match("app.example.com"); rt == nil || !rt.enabled.Load() {
+	r.setEnabled("web", true)
+	if rt := r.match("app.example.com", "/"); rt == nil || !rt.enabled.Load() {
 		t.Error("route should be enabled again")
 	}
 
-	// Unknown domain
-	if r.setEnabled("unknown.example.com", false) {
-		t.Error("setEnabled should return false for unknown domain")
+	// Unknown service
+	if r.setEnabled("unknown", false) {
+		t.Error("setEnabled should return false for unknown service")
 	}
 }
 
@@ -157,9 +157,171 @@ func TestRouterEnabledDomains(t *testing.T) {
 		t.Errorf("enabledDomains() len = %d, want 2", len(r.enabledDomains()))
 	}
 
-	r.setEnabled("app.example.com", false)
+	r.setEnabled("web", false)
 
 	if len(r.enabledDomains()) != 1 {
 		t.Errorf("enabledDomains() len = %d, want 1", len(r.enabledDomains()))
 	}
 }
+
+func TestRouterSetPort(t *testing.T) {
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Domain: "example.com"},
+		Services: map[string]config.Service{
+			"web": {Subdomain: "app", PortRange: &config.PortRange{}},
+		},
+	}
+
+	r := newRouter(cfg)
+
+	rt := r.match("app.example.com", "/")
+	if rt == nil {
+		t.Fatal("dynamic port service should have a route")
+	}
+	if rt.port.Load() != 0 {
+		t.Errorf("port = %d before allocation, want 0", rt.port.Load())
+	}
+
+	if !r.setPort("web", 4123) {
+		t.Fatal("setPort returned false")
+	}
+	if rt.port.Load() != 4123 {
+		t.Errorf("port = %d, want 4123", rt.port.Load())
+	}
+
+	if r.setPort("unknown", 1) {
+		t.Error("setPort should return false for unknown service")
+	}
+}
+
+func TestRouterUpdate(t *testing.T) {
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Domain: "example.com"},
+		Services: map[string]config.Service{
+			"web": {Subdomain: "app", PortRange: &config.PortRange{}},
+			"api": {Subdomain: "api", Port: 3000},
+		},
+	}
+
+	r := newRouter(cfg)
+	r.setEnabled("api", false)
+	r.setPort("web", 4123)
+
+	updated := &config.Config{
+		Proxy: config.ProxyConfig{Domain: "example.com"},
+		Services: map[string]config.Service{
+			"web":   {Subdomain: "app", PortRange: &config.PortRange{}},
+			"api":   {Subdomain: "api", Port: 3001},
+			"admin": {Subdomain: "admin", Port: 4000},
+		},
+	}
+	r.update(updated)
+
+	if rt := r.match("api.example.com", "/"); rt == nil || rt.enabled.Load() || rt.port.Load() != 3001 {
+		t.Error("api should keep toggle state and pick up the new port")
+	}
+	if rt := r.match("app.example.com", "/"); rt == nil || rt.port.Load() != 4123 {
+		t.Error("app should keep its allocated port")
+	}
+	if rt := r.match("admin.example.com", "/"); rt == nil || !rt.enabled.Load() {
+		t.Error("admin should be added and enabled")
+	}
+}
+
+func TestRouterPathRoutes(t *testing.T) {
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Domain: "example.com"},
+		Services: map[string]config.Service{
+			"web": {Subdomain: "app", Port: 8080},
+			"api": {Port: 3000, Routes: []config.RouteConfig{{Host: "app", PathPrefix: "/api"}}},
+			"v2": {PortRange: &config.PortRange{}, Routes: []config.RouteConfig{
+				{Host: "app", PathPrefix: "/api/v2", StripPrefix: true},
+				{Host: "v2", PathPrefix: "/"},
+			}},
+		},
+	}
+
+	r := newRouter(cfg)
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{"app.example.com", "/", "web"},
+		{"app.example.com", "/dashboard", "web"},
+		{"app.example.com", "/api", "api"},
+		{"app.example.com", "/api/users", "api"},
+		{"app.example.com", "/apix", "web"},
+		{"app.example.com", "/api/v2/users", "v2"},
+		{"app.example.com", "/api/v20", "api"},
+		{"v2.example.com", "/anything", "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			rt := r.match(tt.host, tt.path)
+			if rt == nil {
+				t.Fatalf("match(%q, %q) = nil, want %s", tt.host, tt.path, tt.want)
+			}
+			if rt.service != tt.want {
+				t.Errorf("match(%q, %q) = %s, want %s", tt.host, tt.path, rt.service, tt.want)
+			}
+		})
+	}
+
+	// Every route of a service shares its port and toggle state.
+	r.setPort("v2", 4123)
+	r.setEnabled("v2", false)
+	for _, host := range []string{"app.example.com", "v2.example.com"} {
+		rt := r.match(host, "/api/v2")
+		if rt.port.Load() != 4123 || rt.enabled.Load() {
+			t.Errorf("%s: port = %d, enabled = %v; want 4123, false", host, rt.port.Load(), rt.enabled.Load())
+		}
+	}
+}
+
+func TestRouterWildcardHosts(t *testing.T) {
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Domain: "example.com"},
+		Services: map[string]config.Service{
+			"tenants": {Port: 3000, Hosts: []string{"*.app"}},
+			"admin":   {Port: 3001, Subdomain: "admin.app.example.com"},
+			"api":     {Port: 3002, Routes: []config.RouteConfig{{Host: "*.app", PathPrefix: "/api"}}},
+			"site":    {Port: 3003, Subdomain: "www", Hosts: []string{"example.com"}},
+		},
+	}
+
+	r := newRouter(cfg)
+
+	tests := []struct {
+		host string
+		path string
+		want string
+	}{
+		{"acme.app.example.com", "/", "tenants"},
+		{"ACME.app.example.com:443", "/", "tenants"},
+		{"acme.app.example.com", "/api/users", "api"},
+		// An exact host wins over a wildcard covering it, even for paths
+		// only the wildcard mounts.
+		{"admin.app.example.com", "/", "admin"},
+		{"admin.app.example.com", "/api", "admin"},
+		{"example.com", "/", "site"},
+		{"www.example.com", "/", "site"},
+		// A wildcard covers a single label.
+		{"a.b.app.example.com", "/", ""},
+		{"app.example.com", "/", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			var got string
+			if rt := r.match(tt.host, tt.path); rt != nil {
+				got = rt.service
+			}
+			if got != tt.want {
+				t.Errorf("match(%q, %q) = %q, want %q", tt.host, tt.path, got, tt.want)
+			}
+		})
+	}
+}
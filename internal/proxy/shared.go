@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+const (
+	controlTimeout = 5 * time.Second
+	// daemonStartTimeout is how long lokl up waits for a daemon it started
+	// to answer on its socket.
+	daemonStartTimeout = 5 * time.Second
+	daemonPollInterval = 100 * time.Millisecond
+)
+
+// sharedClient talks to the shared proxy over its control socket.
+type sharedClient struct {
+	socket string
+	http   *http.Client
+}
+
+func newSharedClient(socket string) *sharedClient {
+	dialer := &net.Dialer{Timeout: controlTimeout}
+	return &sharedClient{
+		socket: socket,
+		http: &http.Client{
+			Timeout: controlTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func defaultSharedClient() (*sharedClient, error) {
+	dir, err := DaemonDir()
+	if err != nil {
+		return nil, err
+	}
+	return newSharedClient(filepath.Join(dir, socketName)), nil
+}
+
+func (c *sharedClient) status() (SharedStatus, error) {
+	var status SharedStatus
+	resp, err := c.do(http.MethodGet, "/projects", nil)
+	if err != nil {
+		return status, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("decoding shared proxy status: %w", err)
+	}
+	return status, nil
+}
+
+func (c *sharedClient) register(reg Registration) error {
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("encoding registration: %w", err)
+	}
+	resp, err := c.do(http.MethodPut, "/projects", body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *sharedClient) deregister(dir string) error {
+	resp, err := c.do(http.MethodDelete, "/projects?dir="+url.QueryEscape(dir), nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *sharedClient) stop() error {
+	resp, err := c.do(http.MethodPost, "/stop", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a request to the daemon. Error responses become errors carrying
+// the daemon's message.
+func (c *sharedClient) do(method, path string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, "http://lokl"+path, r)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting shared proxy at %s: %w", c.socket, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, errors.New(strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// SharedProxyStatus returns the running shared proxy and its projects. It
+// fails if no shared proxy is running.
+func SharedProxyStatus() (SharedStatus, error) {
+	c, err := defaultSharedClient()
+	if err != nil {
+		return SharedStatus{}, err
+	}
+	return c.status()
+}
+
+// StopSharedProxy shuts the shared proxy down.
+func StopSharedProxy() error {
+	c, err := defaultSharedClient()
+	if err != nil {
+		return err
+	}
+	return c.stop()
+}
+
+// ensureDaemon starts the shared proxy in the background with cfg's
+// settings, unless one is already running.
+func ensureDaemon(c *sharedClient, cfg config.ProxyConfig) error {
+	if _, err := c.status(); err == nil {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("starting shared proxy: %w", err)
+	}
+
+	dir := filepath.Dir(c.socket)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+	logPath := filepath.Join(dir, daemonLogName)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("starting shared proxy: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	cmd := exec.Command(exe, daemonArgs(cfg)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// Its own session, so the daemon outlives this lokl and its terminal.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting shared proxy: %w", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	deadline := time.Now().Add(daemonStartTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return fmt.Errorf("shared proxy exited; see %s", logPath)
+		case <-time.After(daemonPollInterval):
+		}
+		if _, err := c.status(); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("shared proxy did not start within %s; see %s", daemonStartTimeout, logPath)
+}
+
+// daemonArgs are the lokl proxy serve arguments that reproduce cfg.
+func daemonArgs(cfg config.ProxyConfig) []string {
+	host, port, _ := cfg.ListenAddr()
+	args := []string{
+		"proxy", "serve",
+		"--listen", net.JoinHostPort(host, strconv.Itoa(port)),
+		"--https=" + strconv.FormatBool(cfg.HTTPSEnabled()),
+		"--ca", cfg.CA,
+		"--dns", cfg.DNS,
+	}
+	if cfg.HTTPRedirect {
+		args = append(args, "--http-redirect")
+	}
+	if cfg.PublicPort != 0 {
+		args = append(args, "--public-port", strconv.Itoa(cfg.PublicPort))
+	}
+	return args
+}
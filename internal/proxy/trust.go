@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	trustName    = "lokl-rootCA"
+	nssNickname  = "lokl development CA"
+	macKeychain  = "/Library/Keychains/System.keychain"
+	certutilHint = "certutil not found; install nss-tools (Fedora), libnss3-tools (Debian, Ubuntu) or nss (Arch) to trust lokl in Firefox and Chrome"
+)
+
+// systemStore is a Linux CA anchor directory and the command that rebuilds
+// the trust bundle from it.
+type systemStore struct {
+	dir    string
+	ext    string
+	update []string
+}
+
+var systemStores = []systemStore{
+	{dir: "/etc/pki/ca-trust/source/anchors", ext: ".pem", update: []string{"update-ca-trust", "extract"}},       // Fedora, RHEL
+	{dir: "/usr/local/share/ca-certificates", ext: ".crt", update: []string{"update-ca-certificates"}},           // Debian, Ubuntu
+	{dir: "/etc/ca-certificates/trust-source/anchors", ext: ".crt", update: []string{"trust", "extract-compat"}}, // Arch
+}
+
+// Trust creates lokl's root CA if needed and installs it into the system
+// trust store and the NSS databases used by Firefox and Chrome. Commands
+// that need root are run through sudo. It returns the stores updated.
+func Trust() ([]string, error) {
+	ca := newLocalCA()
+	if err := ca.ensureCA(); err != nil {
+		return nil, err
+	}
+
+	var installed []string
+	var errs []error
+
+	store, err := installSystem(ca.certPath())
+	if err != nil {
+		errs = append(errs, fmt.Errorf("system trust store: %w", err))
+	} else {
+		installed = append(installed, store)
+	}
+
+	dbs, err := installNSS(ca.certPath())
+	installed = append(installed, dbs...)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return installed, errors.Join(errs...)
+}
+
+// Untrust removes lokl's root CA from every store Trust installs into. The
+// CA itself is kept.
+func Untrust() ([]string, error) {
+	ca := newLocalCA()
+	if ca.dirErr != nil {
+		return nil, ca.dirErr
+	}
+
+	var removed []string
+	var errs []error
+
+	store, err := uninstallSystem(ca.certPath())
+	if err != nil {
+		errs = append(errs, fmt.Errorf("system trust store: %w", err))
+	} else if store != "" {
+		removed = append(removed, store)
+	}
+
+	dbs, err := uninstallNSS()
+	removed = append(removed, dbs...)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+func installSystem(certPath string) (string, error) {
+	if runtime.GOOS == "darwin" {
+		if err := sudo("security", "add-trusted-cert", "-d", "-k", macKeychain, certPath); err != nil {
+			return "", err
+		}
+		return "macOS system keychain", nil
+	}
+
+	store, ok := findSystemStore()
+	if !ok {
+		return "", fmt.Errorf("no supported CA directory found; add %s to your trust store by hand", certPath)
+	}
+	target := filepath.Join(store.dir, trustName+store.ext)
+	if err := sudo("install", "-m", "0644", certPath, target); err != nil {
+		return "", err
+	}
+	if err := sudo(store.update...); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func uninstallSystem(certPath string) (string, error) {
+	if runtime.GOOS == "darwin" {
+		if !fileExists(certPath) {
+			return "", nil
+		}
+		if err := sudo("security", "remove-trusted-cert", "-d", certPath); err != nil {
+			return "", err
+		}
+		return "macOS system keychain", nil
+	}
+
+	store, ok := findSystemStore()
+	if !ok {
+		return "", nil
+	}
+	target := filepath.Join(store.dir, trustName+store.ext)
+	if !fileExists(target) {
+		return "", nil
+	}
+	if err := sudo("rm", "-f", target); err != nil {
+		return "", err
+	}
+	if err := sudo(store.update...); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func findSystemStore() (systemStore, bool) {
+	for _, s := range systemStores {
+		if _, err := exec.LookPath(s.update[0]); err != nil {
+			continue
+		}
+		if info, err := os.Stat(s.dir); err == nil && info.IsDir() {
+			return s, true
+		}
+	}
+	return systemStore{}, false
+}
+
+func installNSS(certPath string) ([]string, error) {
+	dbs := nssDatabases()
+	if len(dbs) == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("certutil"); err != nil {
+		return nil, errors.New(certutilHint)
+	}
+
+	var installed []string
+	var errs []error
+	for _, db := range dbs {
+		if err := run("certutil", "-A", "-d", db, "-t", "C,,", "-n", nssNickname, "-i", certPath); err != nil {
+			errs = append(errs, fmt.Errorf("NSS database %s: %w", db, err))
+			continue
+		}
+		installed = append(installed, "NSS database "+db)
+	}
+	return installed, errors.Join(errs...)
+}
+
+func uninstallNSS() ([]string, error) {
+	dbs := nssDatabases()
+	if len(dbs) == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("certutil"); err != nil {
+		return nil, errors.New(certutilHint)
+	}
+
+	var removed []string
+	for _, db := range dbs {
+		// Fails when the CA is not in this database, which is fine.
+		if run("certutil", "-D", "-d", db, "-n", nssNickname) == nil {
+			removed = append(removed, "NSS database "+db)
+		}
+	}
+	return removed, nil
+}
+
+// nssDatabases finds the NSS databases of Chrome and Firefox profiles,
+// prefixed with their format as certutil expects.
+func nssDatabases() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	dirs := []string{
+		filepath.Join(home, ".pki", "nssdb"),
+		filepath.Join(home, "snap", "chromium", "current", ".pki", "nssdb"),
+	}
+	for _, pattern := range []string{
+		filepath.Join(home, ".mozilla", "firefox", "*"),
+		filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*"),
+		filepath.Join(home, "Library", "Application Support", "Firefox", "Profiles", "*"),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		dirs = append(dirs, matches...)
+	}
+
+	var dbs []string
+	for _, dir := range dirs {
+		switch {
+		case fileExists(filepath.Join(dir, "cert9.db")):
+			dbs = append(dbs, "sql:"+dir)
+		case fileExists(filepath.Join(dir, "cert8.db")):
+			dbs = append(dbs, "dbm:"+dir)
+		}
+	}
+	return dbs
+}
+
+// sudo runs a command as root, through sudo unless lokl already is root.
+func sudo(args ...string) error {
+	if os.Geteuid() == 0 {
+		return run(args...)
+	}
+	return run(append([]string{"sudo"}, args...)...)
+}
+
+func run(args ...string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+// allocatePort picks a free port for a service with a dynamic port. The
+// previous port is preferred so restarts keep a stable address, and ports
+// already handed to other services are skipped.
+func (s *Supervisor) allocatePort(name string, r *config.PortRange) (int, error) {
+	taken := make(map[int]bool, len(s.ports))
+	for other, port := range s.ports {
+		if other != name {
+			taken[port] = true
+		}
+	}
+
+	if prev, ok := s.ports[name]; ok && inRange(prev, r) && portFree(prev) {
+		return prev, nil
+	}
+
+	if r.Min == 0 && r.Max == 0 {
+		for range 10 {
+			port, err := ephemeralPort()
+			if err != nil {
+				return 0, err
+			}
+			if !taken[port] {
+				return port, nil
+			}
+		}
+		return 0, fmt.Errorf("no free port available")
+	}
+
+	for port := r.Min; port <= r.Max; port++ {
+		if !taken[port] && portFree(port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port in range %s", r)
+}
+
+func inRange(port int, r *config.PortRange) bool {
+	if r.Min == 0 && r.Max == 0 {
+		return true
+	}
+	return port >= r.Min && port <= r.Max
+}
+
+func ephemeralPort() (int, error) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, fmt.Errorf("allocating port: %w", err)
+	}
+	defer func() { _ = ln.Close() }()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func portFree(port int) bool {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	_ = ln.Close()
+	return true
+}
@@ -0,0 +1,213 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+func TestAllocatePort(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup returns the range to allocate from, given a free port and
+		// another free port.
+		setup func(t *testing.T, s *Supervisor, free, other int) *config.PortRange
+		// wantFree expects the free port; wantOther rules it out.
+		wantFree  bool
+		wantOther bool
+		wantErr   bool
+	}{
+		{
+			name: "auto",
+			setup: func(*testing.T, *Supervisor, int, int) *config.PortRange {
+				return &config.PortRange{}
+			},
+		},
+		{
+			name: "auto prefers previous port",
+			setup: func(_ *testing.T, s *Supervisor, free, _ int) *config.PortRange {
+				s.ports["api"] = free
+				return &config.PortRange{}
+			},
+			wantFree: true,
+		},
+		{
+			name: "previous port in use",
+			setup: func(t *testing.T, s *Supervisor, free, _ int) *config.PortRange {
+				s.ports["api"] = free
+				listen(t, free)
+				return &config.PortRange{}
+			},
+			wantOther: true,
+		},
+		{
+			name: "range",
+			setup: func(_ *testing.T, _ *Supervisor, free, _ int) *config.PortRange {
+				return &config.PortRange{Min: free, Max: free}
+			},
+			wantFree: true,
+		},
+		{
+			name: "previous port outside range",
+			setup: func(_ *testing.T, s *Supervisor, free, other int) *config.PortRange {
+				s.ports["api"] = other
+				return &config.PortRange{Min: free, Max: free}
+			},
+			wantFree: true,
+		},
+		{
+			name: "range port held by another service",
+			setup: func(_ *testing.T, s *Supervisor, free, _ int) *config.PortRange {
+				s.ports["web"] = free
+				return &config.PortRange{Min: free, Max: free}
+			},
+			wantErr: true,
+		},
+		{
+			name: "range port in use",
+			setup: func(t *testing.T, _ *Supervisor, free, _ int) *config.PortRange {
+				listen(t, free)
+				return &config.PortRange{Min: free, Max: free}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Supervisor{ports: make(map[string]int)}
+			free := freePort(t)
+			r := tt.setup(t, s, free, otherPort(t, free))
+
+			got, err := s.allocatePort("api", r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("allocatePort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			switch {
+			case got == 0:
+				t.Errorf("allocatePort() = 0, want a port")
+			case tt.wantFree && got != free:
+				t.Errorf("allocatePort() = %d, want %d", got, free)
+			case tt.wantOther && got == free:
+				t.Errorf("allocatePort() = %d, which is in use", got)
+			}
+		})
+	}
+}
+
+func TestDynamicPort(t *testing.T) {
+	cfg := &config.Config{
+		Name: "ports",
+		Services: map[string]config.Service{
+			"api": {Command: "api --port ${self.port}", PortRange: &config.PortRange{}},
+			"web": {Command: "web", Port: 5173, DependsOn: []string{"api"}},
+		},
+	}
+	s, procs, proxy := newTestSupervisor(t, cfg)
+
+	port := s.ports["api"]
+	if port == 0 {
+		t.Fatal("no port allocated for api")
+	}
+	assertPort(t, s, procs, proxy, port)
+
+	t.Run("restart keeps port", func(t *testing.T) {
+		before := procs.count()
+		if err := s.RestartService("api"); err != nil {
+			t.Fatal(err)
+		}
+		if got := s.ports["api"]; got != port {
+			t.Errorf("port after restart = %d, want %d", got, port)
+		}
+		// web keeps the address it has; only api starts again.
+		if got := procs.started(before); len(got) != 1 || got[0] != "api" {
+			t.Errorf("started %v, want [api]", got)
+		}
+		assertPort(t, s, procs, proxy, port)
+	})
+
+	t.Run("restart on a taken port", func(t *testing.T) {
+		if err := s.StopService("api"); err != nil {
+			t.Fatal(err)
+		}
+		listen(t, port)
+
+		before := procs.count()
+		if err := s.StartService("api"); err != nil {
+			t.Fatal(err)
+		}
+		moved := s.ports["api"]
+		if moved == port {
+			t.Fatalf("api kept port %d, which is in use", port)
+		}
+		// web depends on api and restarts to see the new port.
+		if got := procs.started(before); len(got) != 2 || got[0] != "api" || got[1] != "web" {
+			t.Errorf("started %v, want [api web]", got)
+		}
+		assertPort(t, s, procs, proxy, moved)
+	})
+}
+
+// assertPort checks that port reaches the api process, the proxy router,
+// the discovery env of web and the service list.
+func assertPort(t *testing.T, s *Supervisor, procs *fakeProcesses, proxy *fakeProxy, port int) {
+	t.Helper()
+
+	want := strconv.Itoa(port)
+	api, web := procs.latest("api"), procs.latest("web")
+	if got := api.svc.Command; got != "api --port "+want {
+		t.Errorf("api command = %q, want the port %s", got, want)
+	}
+	if got := api.svc.Env["PORT"]; got != want {
+		t.Errorf("api PORT = %q, want %s", got, want)
+	}
+	if got := proxy.ports["api"]; got != port {
+		t.Errorf("proxy port = %d, want %d", got, port)
+	}
+	if got := web.discovery["LOKL_API_PORT"]; got != want {
+		t.Errorf("web LOKL_API_PORT = %q, want %s", got, want)
+	}
+	if got := web.discovery["LOKL_API_URL"]; got != "http://localhost:"+want {
+		t.Errorf("web LOKL_API_URL = %q", got)
+	}
+	for _, info := range s.Services() {
+		if info.Name == "api" && info.Port != port {
+			t.Errorf("Services() api port = %d, want %d", info.Port, port)
+		}
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	port, err := ephemeralPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+// otherPort returns a free port other than port.
+func otherPort(t *testing.T, port int) int {
+	t.Helper()
+	for {
+		if p := freePort(t); p != port {
+			return p
+		}
+	}
+}
+
+// listen holds port until the test ends.
+func listen(t *testing.T, port int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+}
@@ -0,0 +1,207 @@
+package supervisor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+// ConfigLoader loads a fresh config for hot reload.
+type ConfigLoader func() (*config.Config, error)
+
+// SetConfigLoader enables ReloadConfig.
+func (s *Supervisor) SetConfigLoader(load ConfigLoader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loader = load
+}
+
+// ReloadConfig loads the config and applies it. A config that fails to load
+// or validate leaves every running service untouched.
+func (s *Supervisor) ReloadConfig() error {
+	s.mu.Lock()
+	load := s.loader
+	s.mu.Unlock()
+
+	if load == nil {
+		return fmt.Errorf("config reload not available")
+	}
+
+	cfg, err := load()
+	if err != nil {
+		s.setNotice("✗ Reload failed: " + err.Error())
+		return err
+	}
+	return s.Reload(cfg)
+}
+
+// Reload applies a new config: removed services are stopped, running
+// services whose effective config changed, or that depend on a service
+// whose address changed, are restarted, and new autostart services are
+// started. Proxy routes are rebuilt keeping toggle state. If
+// a service fails to start, the previous config is restored.
+func (s *Supervisor) Reload(cfg *config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	diff, restarted, err := s.reload(cfg)
+	if err != nil {
+		s.setNotice("✗ Reload failed: " + err.Error())
+		return err
+	}
+
+	s.setNotice(reloadSummary(diff, restarted))
+	return nil
+}
+
+func (s *Supervisor) reload(cfg *config.Config) (config.Diff, []string, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	if cfg.Proxy.Domain != s.cfg.Proxy.Domain {
+		return config.Diff{}, nil, fmt.Errorf("proxy.domain changed, restart lokl to apply")
+	}
+
+	diff := config.Compare(s.cfg, cfg)
+	if diff.IsEmpty() {
+		return diff, nil, nil
+	}
+
+	oldOrder, err := config.SortByDependency(s.cfg.Services)
+	if err != nil {
+		return diff, nil, err
+	}
+
+	// Detach affected processes in reverse dependency order and stop them
+	// without holding s.mu, so Services and the TUI stay responsive. They
+	// are marked as reloading so nothing starts them with the old config
+	// in the meantime.
+	var stopped []string
+	var procs []ProcessRunner
+	for _, name := range slices.Backward(oldOrder) {
+		p, running := s.processes[name]
+		if !running || (!slices.Contains(diff.Removed, name) && !slices.Contains(diff.Changed, name)) {
+			continue
+		}
+		delete(s.processes, name)
+		s.reloading[name] = true
+		stopped = append(stopped, name)
+		procs = append(procs, p)
+	}
+	s.mu.Unlock()
+	for i, p := range procs {
+		if err := p.Stop(); err != nil {
+			s.log.Errorf("✗ Failed to stop %s: %v\n", stopped[i], err)
+		}
+	}
+	s.mu.Lock()
+	for _, name := range stopped {
+		delete(s.reloading, name)
+	}
+
+	old := s.cfg
+	s.cfg = cfg
+	if err := s.proxyManager.Reload(cfg); err != nil {
+		s.rollback(old, nil, stopped)
+		return diff, nil, fmt.Errorf("reloading proxy: %w", err)
+	}
+	for name, port := range s.ports {
+		s.proxyManager.SetPort(name, port)
+	}
+
+	newOrder, err := config.SortByDependency(cfg.Services)
+	if err != nil {
+		s.rollback(old, nil, stopped)
+		return diff, nil, err
+	}
+
+	var restarted []string
+	for _, name := range newOrder {
+		svc := cfg.Services[name]
+		added := slices.Contains(diff.Added, name)
+		autostart := svc.AutoStart == nil || *svc.AutoStart
+		if !(slices.Contains(stopped, name) && slices.Contains(diff.Changed, name)) && (!added || !autostart) {
+			continue
+		}
+		if err := s.startService(name); err != nil {
+			s.rollback(old, restarted, stopped)
+			return diff, nil, fmt.Errorf("%w; kept the previous config", err)
+		}
+		restarted = append(restarted, name)
+	}
+
+	for _, name := range diff.Removed {
+		delete(s.ports, name)
+	}
+	return diff, restarted, nil
+}
+
+// rollback restores the previous config after a failed reload: services
+// started for the new config are stopped, and those stopped for it are
+// started again. The caller holds s.mu.
+func (s *Supervisor) rollback(old *config.Config, started, stopped []string) {
+	for _, name := range slices.Backward(started) {
+		if err := s.stopService(name); err != nil {
+			s.log.Errorf("✗ Failed to stop %s: %v\n", name, err)
+		}
+	}
+
+	s.cfg = old
+	if err := s.proxyManager.Reload(old); err != nil {
+		s.log.Errorf("✗ Failed to restore proxy routes: %v\n", err)
+	}
+	for name, port := range s.ports {
+		s.proxyManager.SetPort(name, port)
+	}
+
+	// stopped is in reverse dependency order.
+	for _, name := range slices.Backward(stopped) {
+		if err := s.startService(name); err != nil {
+			s.log.Errorf("✗ Failed to restart %s: %v\n", name, err)
+		}
+	}
+}
+
+// ConfigFiles returns the files the current config was composed from.
+func (s *Supervisor) ConfigFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.Files
+}
+
+// Notice returns the outcome of the last config reload, if any.
+func (s *Supervisor) Notice() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notice
+}
+
+func (s *Supervisor) setNotice(msg string) {
+	s.mu.Lock()
+	s.notice = msg
+	s.mu.Unlock()
+	s.emit("")
+}
+
+func reloadSummary(d config.Diff, started []string) string {
+	if d.IsEmpty() {
+		return "✓ Config reloaded, no changes"
+	}
+
+	var parts []string
+	if len(d.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(d.Removed, ", "))
+	}
+	if len(started) > 0 {
+		parts = append(parts, "started "+strings.Join(started, ", "))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no running services affected")
+	}
+	return "✓ Config reloaded: " + strings.Join(parts, "; ")
+}
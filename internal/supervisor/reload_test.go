@@ -0,0 +1,184 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+func newReloadConfig() *config.Config {
+	return &config.Config{
+		Name: "reload",
+		Services: map[string]config.Service{
+			"api":    {Command: "api", Port: 3000},
+			"web":    {Command: "web", Port: 5173, DependsOn: []string{"api"}},
+			"worker": {Command: "worker"},
+		},
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(*config.Config)
+		fail    string // command whose start fails
+		wantErr bool
+		// wantStarted are the processes started by the reload.
+		wantStarted string
+		wantRunning string
+		// wantCommands are the commands of the running processes.
+		wantCommands map[string]string
+	}{
+		{
+			name: "add",
+			update: func(c *config.Config) {
+				c.Services["db"] = config.Service{Command: "db", Port: 5432}
+			},
+			wantStarted: "db",
+			wantRunning: "api,db,web,worker",
+		},
+		{
+			name:        "remove",
+			update:      func(c *config.Config) { delete(c.Services, "worker") },
+			wantRunning: "api,web",
+		},
+		{
+			name: "change",
+			update: func(c *config.Config) {
+				c.Services["worker"] = config.Service{Command: "worker --v2"}
+			},
+			wantStarted:  "worker",
+			wantRunning:  "api,web,worker",
+			wantCommands: map[string]string{"worker": "worker --v2"},
+		},
+		{
+			name: "port change restarts dependents",
+			update: func(c *config.Config) {
+				c.Services["api"] = config.Service{Command: "api", Port: 3001}
+			},
+			wantStarted: "api,web",
+			wantRunning: "api,web,worker",
+		},
+		{
+			name: "rollback after failed start",
+			update: func(c *config.Config) {
+				delete(c.Services, "worker")
+				c.Services["api"] = config.Service{Command: "api --broken", Port: 3000}
+			},
+			fail:    "api --broken",
+			wantErr: true,
+			// the failed api start, then api and worker with the old config
+			wantStarted:  "api,api,worker",
+			wantRunning:  "api,web,worker",
+			wantCommands: map[string]string{"api": "api", "worker": "worker"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, procs, _ := newTestSupervisor(t, newReloadConfig())
+			procs.fail = tt.fail
+			before := procs.count()
+
+			cfg := newReloadConfig()
+			tt.update(cfg)
+			config.ApplyDefaults(cfg)
+
+			err := s.Reload(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && s.cfg.Services["api"].Command != "api" {
+				t.Error("config not rolled back")
+			}
+
+			if got := strings.Join(procs.started(before), ","); got != tt.wantStarted {
+				t.Errorf("started %q, want %q", got, tt.wantStarted)
+			}
+
+			var running []string
+			for _, info := range s.Services() {
+				if info.Running {
+					running = append(running, info.Name)
+				}
+			}
+			if got := strings.Join(running, ","); !sameSet(got, tt.wantRunning) {
+				t.Errorf("running %q, want %q", got, tt.wantRunning)
+			}
+
+			for name, want := range tt.wantCommands {
+				p, ok := s.processes[name].(*fakeProcess)
+				if !ok || p.svc.Command != want {
+					t.Errorf("%s runs %+v, want command %q", name, s.processes[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadBlocksStartWhileStopping(t *testing.T) {
+	s, procs, _ := newTestSupervisor(t, newReloadConfig())
+
+	// Processes started from here on block in Stop until released.
+	release := make(chan struct{})
+	procs.stop = release
+	if err := s.RestartService("worker"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newReloadConfig()
+	cfg.Services["worker"] = config.Service{Command: "worker --v2"}
+	config.ApplyDefaults(cfg)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Reload(cfg) }()
+
+	// Wait for the reload to detach worker and start stopping it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		reloading := s.reloading["worker"]
+		s.mu.Unlock()
+		if reloading {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("reload did not start stopping worker")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.StartService("worker"); err == nil {
+		t.Error("StartService during reload succeeded, want error")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if p := s.processes["worker"].(*fakeProcess); p.svc.Command != "worker --v2" {
+		t.Errorf("worker command = %q, want the reloaded one", p.svc.Command)
+	}
+}
+
+func sameSet(a, b string) bool {
+	as, bs := strings.Split(a, ","), strings.Split(b, ",")
+	if len(as) != len(bs) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, s := range as {
+		seen[s]++
+	}
+	for _, s := range bs {
+		seen[s]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
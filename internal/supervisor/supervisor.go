@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/shahin-bayat/lokl/internal/config"
 	"github.com/shahin-bayat/lokl/internal/types"
@@ -25,27 +26,39 @@ type ProxyManager interface {
 	Start() error
 	Stop(cleanupDNS bool) error
 	CertDir() string
-	Port() int
+	Addr() string
 	Domains() []string
 	UnresolvedDomains() []string
-	DNSBlock() string
-	EnableProxy(domain string) bool
-	DisableProxy(domain string) bool
-	IsProxyEnabled(domain string) bool
+	DNSHelp() string
+	EnableProxy(service string) bool
+	DisableProxy(service string) bool
+	IsProxyEnabled(service string) bool
+	SetPort(service string, port int) bool
+	// Publish sends route changes to a shared proxy. It is called without
+	// holding the supervisor lock.
+	Publish()
+	Reload(cfg *config.Config) error
 }
 
 const eventBufferSize = 100
 
-// ProcessFactory creates a new process runner.
-type ProcessFactory func(name string, svc config.Service, onChange func()) ProcessRunner
+// ProcessFactory creates a new process runner. discovery holds the
+// LOKL_<SERVICE>_* variables to inject into the process environment.
+type ProcessFactory func(name string, svc config.Service, discovery map[string]string, onChange func()) ProcessRunner
 
 type Supervisor struct {
 	cfg            *config.Config
 	proxyManager   ProxyManager
 	processFactory ProcessFactory
 	processes      map[string]ProcessRunner
+	ports          map[string]int  // dynamically allocated ports
+	reloading      map[string]bool // stopped by a reload that has not finished
 	log            Logger
 	events         chan types.Event
+	loader         ConfigLoader
+	notice         string // result of the last config reload
+	mu             sync.Mutex
+	reloadMu       sync.Mutex // serializes reloads, which release mu while stopping
 }
 
 func New(cfg *config.Config, pf ProcessFactory, pm ProxyManager, log Logger) *Supervisor {
@@ -54,11 +67,20 @@ func New(cfg *config.Config, pf ProcessFactory, pm ProxyManager, log Logger) *Su
 		proxyManager:   pm,
 		processFactory: pf,
 		processes:      make(map[string]ProcessRunner),
+		ports:          make(map[string]int),
+		reloading:      make(map[string]bool),
 		log:            log,
 		events:         make(chan types.Event, eventBufferSize),
 	}
 }
 
+// unlock releases s.mu, then publishes route changes made under it to a
+// shared proxy, so the round trip does not hold up other callers.
+func (s *Supervisor) unlock() {
+	s.mu.Unlock()
+	s.proxyManager.Publish()
+}
+
 func (s *Supervisor) Subscribe() <-chan types.Event {
 	return s.events
 }
@@ -71,27 +93,28 @@ func (s *Supervisor) emit(service string) {
 	}
 }
 
-func (s *Supervisor) Start() error {
-	// 1. Setup proxy (certs, DNS)
-	if err := s.setupProxy(); err != nil {
-		return err
-	}
+// Start sets up the proxy and starts services. names and profiles select
+// what to start, see config.SelectServices; both empty starts every
+// autostart service.
+func (s *Supervisor) Start(names, profiles []string) error {
+	s.mu.Lock()
+	defer s.unlock()
 
-	// 2. Start services in dependency order
-	order, err := config.SortByDependency(s.cfg.Services)
+	// 1. Resolve which services to start, in dependency order
+	order, err := config.SelectServices(s.cfg.Services, names, profiles)
 	if err != nil {
-		return fmt.Errorf("resolving dependencies: %w", err)
+		return fmt.Errorf("resolving services: %w", err)
 	}
 
+	// 2. Setup proxy (certs, DNS)
+	if err := s.setupProxy(); err != nil {
+		return err
+	}
+
+	// 3. Start services
 	var started []string
 	for _, name := range order {
-		svc := s.cfg.Services[name]
-
-		if svc.AutoStart != nil && !*svc.AutoStart {
-			continue
-		}
-
-		if err := s.StartService(name); err != nil {
+		if err := s.startService(name); err != nil {
 			s.cleanupStarted(started)
 			return err
 		}
@@ -99,7 +122,7 @@ func (s *Supervisor) Start() error {
 		s.log.Infof("✓ Started %s\n", name)
 	}
 
-	// 3. Start proxy server
+	// 4. Start proxy server
 	if err := s.startProxy(); err != nil {
 		s.cleanupStarted(started)
 		return err
@@ -110,13 +133,19 @@ func (s *Supervisor) Start() error {
 
 func (s *Supervisor) cleanupStarted(names []string) {
 	for _, name := range slices.Backward(names) {
-		if err := s.StopService(name); err != nil {
+		if err := s.stopService(name); err != nil {
 			s.log.Errorf("✗ Cleanup failed for %s: %v\n", name, err)
 		}
 	}
 }
 
 func (s *Supervisor) StartService(name string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.startService(name)
+}
+
+func (s *Supervisor) startService(name string) error {
 	svc, exists := s.cfg.Services[name]
 	if !exists {
 		return fmt.Errorf("unknown service: %s", name)
@@ -125,26 +154,80 @@ func (s *Supervisor) StartService(name string) error {
 	if _, running := s.processes[name]; running {
 		return nil // already running, not an error
 	}
+	if s.reloading[name] {
+		return fmt.Errorf("%s is being restarted by a config reload", name)
+	}
 
 	if svc.Image != "" {
 		return fmt.Errorf("docker services not yet supported")
 	}
 
+	portChanged := false
+	if svc.PortRange != nil {
+		port, err := s.allocatePort(name, svc.PortRange)
+		if err != nil {
+			return fmt.Errorf("starting %s: %w", name, err)
+		}
+		prev, had := s.ports[name]
+		portChanged = !had || prev != port
+		s.ports[name] = port
+		svc = svc.WithPort(port)
+
+		s.proxyManager.SetPort(name, port)
+	}
+
+	discovery, err := s.discoveryEnv()
+	if err != nil {
+		return fmt.Errorf("starting %s: %w", name, err)
+	}
+
 	onChange := func() {
 		s.emit(name)
 	}
-	p := s.processFactory(name, svc, onChange)
+	p := s.processFactory(name, svc, discovery, onChange)
 	if err := p.Start(); err != nil {
 		return fmt.Errorf("starting %s: %w", name, err)
 	}
 
 	s.processes[name] = p
+	if portChanged {
+		s.restartDependents(name)
+	}
 	return nil
 }
 
+// restartDependents restarts the running services that depend on name, so
+// they see its new address in their discovery env. Services that do not
+// list name in depends_on keep the address they started with.
+func (s *Supervisor) restartDependents(name string) {
+	if s.cfg.Discovery.Enabled != nil && !*s.cfg.Discovery.Enabled {
+		return
+	}
+
+	order, err := config.SortByDependency(s.cfg.Services)
+	if err != nil {
+		return
+	}
+	for _, dep := range order {
+		if _, running := s.processes[dep]; !running || !slices.Contains(s.cfg.Services[dep].DependsOn, name) {
+			continue
+		}
+		if err := s.stopService(dep); err != nil {
+			s.log.Errorf("✗ Failed to restart %s: %v\n", dep, err)
+			continue
+		}
+		if err := s.startService(dep); err != nil {
+			s.log.Errorf("✗ Failed to restart %s: %v\n", dep, err)
+		}
+	}
+}
+
 func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for name := range s.processes {
-		if err := s.StopService(name); err != nil {
+		if err := s.stopService(name); err != nil {
 			s.log.Errorf("✗ Failed to stop %s: %v\n", name, err)
 		} else {
 			s.log.Infof("✓ Stopped %s\n", name)
@@ -159,6 +242,12 @@ func (s *Supervisor) Stop() error {
 }
 
 func (s *Supervisor) StopService(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopService(name)
+}
+
+func (s *Supervisor) stopService(name string) error {
 	p, exists := s.processes[name]
 	if !exists {
 		return nil
@@ -173,49 +262,80 @@ func (s *Supervisor) StopService(name string) error {
 }
 
 func (s *Supervisor) RestartService(name string) error {
-	if err := s.StopService(name); err != nil {
+	s.mu.Lock()
+	defer s.unlock()
+
+	if err := s.stopService(name); err != nil {
 		return err
 	}
-	return s.StartService(name)
+	return s.startService(name)
 }
 
 // ToggleProxy toggles between local and remote routing for a service.
+// Running services that depend on it are restarted with its new address.
 func (s *Supervisor) ToggleProxy(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
 	svc, exists := s.cfg.Services[name]
 	if !exists {
 		return false, fmt.Errorf("unknown service: %s", name)
 	}
 
-	domain := s.serviceDomain(svc)
-	if domain == "" {
+	if s.serviceDomain(svc) == "" {
 		return false, fmt.Errorf("service %s has no proxy domain", name)
 	}
 
-	if s.proxyManager.IsProxyEnabled(domain) {
-		s.proxyManager.DisableProxy(domain)
-		return false, nil
+	enabled := !s.proxyManager.IsProxyEnabled(name)
+	if enabled {
+		s.proxyManager.EnableProxy(name)
+	} else {
+		s.proxyManager.DisableProxy(name)
 	}
+	s.restartDependents(name)
+	return enabled, nil
+}
 
-	s.proxyManager.EnableProxy(domain)
-	return true, nil
+// DiscoveryEnv returns the service-discovery variables for the current
+// routing state. Routes toggled to remote resolve to the remote host.
+func (s *Supervisor) DiscoveryEnv() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.discoveryEnv()
 }
 
-// serviceDomain returns the full domain for a service, handling both
-// simple subdomains (api -> api.example.com) and full domains (api.example.com).
-func (s *Supervisor) serviceDomain(svc config.Service) string {
-	if svc.Subdomain == "" {
-		return ""
-	}
-	if strings.Contains(svc.Subdomain, ".") {
-		return svc.Subdomain
+func (s *Supervisor) discoveryEnv() (map[string]string, error) {
+	return s.resolvedConfig().DiscoveryEnv(func(service string) bool {
+		return !s.proxyManager.IsProxyEnabled(service)
+	})
+}
+
+// resolvedConfig returns a copy of the config with allocated dynamic ports
+// filled in.
+func (s *Supervisor) resolvedConfig() *config.Config {
+	if len(s.ports) == 0 {
+		return s.cfg
 	}
-	if s.cfg.Proxy.Domain == "" {
-		return ""
+
+	cfg := *s.cfg
+	cfg.Services = make(map[string]config.Service, len(s.cfg.Services))
+	for name, svc := range s.cfg.Services {
+		if port, ok := s.ports[name]; ok {
+			svc.Port = port
+		}
+		cfg.Services[name] = svc
 	}
-	return svc.Subdomain + "." + s.cfg.Proxy.Domain
+	return &cfg
+}
+
+func (s *Supervisor) serviceDomain(svc config.Service) string {
+	return s.cfg.ServiceDomain(svc)
 }
 
 func (s *Supervisor) Services() []types.ServiceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	order, _ := config.SortByDependency(s.cfg.Services)
 
 	items := make([]types.ServiceInfo, 0, len(order))
@@ -225,10 +345,14 @@ func (s *Supervisor) Services() []types.ServiceInfo {
 			Name: name,
 			Port: svc.Port,
 		}
+		if port, ok := s.ports[name]; ok {
+			item.Port = port
+		}
 
 		if domain := s.serviceDomain(svc); domain != "" {
 			item.Domain = domain
-			item.ProxyEnabled = s.proxyManager.IsProxyEnabled(domain)
+			item.URL = s.cfg.ServiceURL(svc)
+			item.ProxyEnabled = s.proxyManager.IsProxyEnabled(name)
 		}
 
 		if p, ok := s.processes[name]; ok {
@@ -243,10 +367,15 @@ func (s *Supervisor) Services() []types.ServiceInfo {
 }
 
 func (s *Supervisor) ProjectName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.cfg.Name
 }
 
 func (s *Supervisor) ServiceLogs(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if p, ok := s.processes[name]; ok {
 		return p.Logs()
 	}
@@ -263,15 +392,14 @@ func (s *Supervisor) setupProxy() error {
 	if err := s.proxyManager.Setup(); err != nil {
 		return fmt.Errorf("proxy setup: %w", err)
 	}
-	s.log.Infof("✓ Certificates ready in %s\n", s.proxyManager.CertDir())
+	if s.cfg.Proxy.HTTPSEnabled() {
+		s.log.Infof("✓ Certificates ready in %s\n", s.proxyManager.CertDir())
+	}
 
 	unresolved := s.proxyManager.UnresolvedDomains()
 	if len(unresolved) > 0 {
 		s.log.Infof("\n⚠ DNS entries needed for: %s\n", strings.Join(unresolved, ", "))
-		s.log.Infof("\nOption 1 - Run:\n")
-		s.log.Infof("  sudo lokl dns setup\n")
-		s.log.Infof("\nOption 2 - Add manually to /etc/hosts:\n")
-		s.log.Infof("  %s\n", strings.ReplaceAll(s.proxyManager.DNSBlock(), "\n", "\n  "))
+		s.log.Infof("\n%s\n", s.proxyManager.DNSHelp())
 		return fmt.Errorf("DNS not configured")
 	}
 
@@ -290,6 +418,6 @@ func (s *Supervisor) startProxy() error {
 		}
 	}()
 
-	s.log.Infof("✓ Proxy listening on :%d\n", s.proxyManager.Port())
+	s.log.Infof("✓ Proxy listening on %s\n", s.proxyManager.Addr())
 	return nil
 }
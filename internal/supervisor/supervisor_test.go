@@ -0,0 +1,213 @@
+package supervisor
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+)
+
+// fakeProcess is a ProcessRunner that runs nothing.
+type fakeProcess struct {
+	name      string
+	svc       config.Service
+	discovery map[string]string
+	// stop, when set, blocks Stop until it is closed.
+	stop    chan struct{}
+	running bool
+	mu      sync.Mutex
+}
+
+func (p *fakeProcess) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = true
+	return nil
+}
+
+func (p *fakeProcess) Stop() error {
+	if p.stop != nil {
+		<-p.stop
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = false
+	return nil
+}
+
+func (p *fakeProcess) IsRunning() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+func (p *fakeProcess) IsHealthy() bool { return p.IsRunning() }
+func (p *fakeProcess) Logs() []string  { return nil }
+
+// fakeProcesses creates fakeProcesses and records every one it created.
+type fakeProcesses struct {
+	created []*fakeProcess
+	// fail makes starting a service with this command fail.
+	fail string
+	// stop is given to every process created.
+	stop chan struct{}
+	mu   sync.Mutex
+}
+
+func (f *fakeProcesses) factory(name string, svc config.Service, discovery map[string]string, _ func()) ProcessRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := &fakeProcess{name: name, svc: svc, discovery: discovery, stop: f.stop}
+	f.created = append(f.created, p)
+	if svc.Command != "" && svc.Command == f.fail {
+		return failingProcess{p}
+	}
+	return p
+}
+
+// started returns the names of the processes created after the first n.
+func (f *fakeProcesses) started(n int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for _, p := range f.created[n:] {
+		names = append(names, p.name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// latest returns the last process created for name.
+func (f *fakeProcesses) latest(name string) *fakeProcess {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := len(f.created) - 1; i >= 0; i-- {
+		if f.created[i].name == name {
+			return f.created[i]
+		}
+	}
+	return nil
+}
+
+func (f *fakeProcesses) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.created)
+}
+
+type failingProcess struct{ *fakeProcess }
+
+func (p failingProcess) Start() error { return fmt.Errorf("exit status 1") }
+
+// fakeProxy is a ProxyManager without a proxy. Every route is local.
+type fakeProxy struct {
+	ports    map[string]int
+	disabled map[string]bool
+	// publish, when set, is called by Publish.
+	publish func()
+}
+
+func newFakeProxy() *fakeProxy {
+	return &fakeProxy{ports: make(map[string]int), disabled: make(map[string]bool)}
+}
+
+func (p *fakeProxy) Setup() error                    { return nil }
+func (p *fakeProxy) Start() error                    { return nil }
+func (p *fakeProxy) Stop(bool) error                 { return nil }
+func (p *fakeProxy) CertDir() string                 { return "" }
+func (p *fakeProxy) Addr() string                    { return "" }
+func (p *fakeProxy) Domains() []string               { return nil }
+func (p *fakeProxy) UnresolvedDomains() []string     { return nil }
+func (p *fakeProxy) DNSHelp() string                 { return "" }
+func (p *fakeProxy) Reload(*config.Config) error     { return nil }
+func (p *fakeProxy) IsProxyEnabled(s string) bool    { return !p.disabled[s] }
+func (p *fakeProxy) EnableProxy(s string) bool       { delete(p.disabled, s); return true }
+func (p *fakeProxy) DisableProxy(s string) bool      { p.disabled[s] = true; return true }
+func (p *fakeProxy) SetPort(s string, port int) bool { p.ports[s] = port; return true }
+func (p *fakeProxy) Publish() {
+	if p.publish != nil {
+		p.publish()
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Infof(string, ...any)  {}
+func (discardLogger) Errorf(string, ...any) {}
+
+// newTestSupervisor starts every autostart service of cfg with fake
+// processes.
+func newTestSupervisor(t *testing.T, cfg *config.Config) (*Supervisor, *fakeProcesses, *fakeProxy) {
+	t.Helper()
+
+	config.ApplyDefaults(cfg)
+	procs := &fakeProcesses{}
+	proxy := newFakeProxy()
+	s := New(cfg, procs.factory, proxy, discardLogger{})
+	if err := s.Start(nil, nil); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Stop() })
+	return s, procs, proxy
+}
+
+func TestPublishWithoutLock(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Name:  "publish",
+			Proxy: config.ProxyConfig{Domain: "publish.test"},
+			Services: map[string]config.Service{
+				"api": {Command: "api", PortRange: &config.PortRange{}, Subdomain: "api"},
+				"web": {Command: "web", Port: 5173, Subdomain: "app", DependsOn: []string{"api"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		run  func(*Supervisor) error
+	}{
+		{name: "start service", run: func(s *Supervisor) error {
+			if err := s.StopService("api"); err != nil {
+				return err
+			}
+			return s.StartService("api")
+		}},
+		{name: "restart service", run: func(s *Supervisor) error { return s.RestartService("api") }},
+		{name: "toggle proxy", run: func(s *Supervisor) error { _, err := s.ToggleProxy("api"); return err }},
+		{name: "reload", run: func(s *Supervisor) error {
+			cfg := newConfig()
+			cfg.Services["api"] = config.Service{Command: "api --v2", PortRange: &config.PortRange{}, Subdomain: "api"}
+			config.ApplyDefaults(cfg)
+			return s.Reload(cfg)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, proxy := newTestSupervisor(t, newConfig())
+
+			published := 0
+			proxy.publish = func() {
+				published++
+				if !s.mu.TryLock() {
+					t.Error("Publish called with the supervisor lock held")
+					return
+				}
+				s.mu.Unlock()
+			}
+
+			if err := tt.run(s); err != nil {
+				t.Fatal(err)
+			}
+			if published == 0 {
+				t.Error("route changes were not published")
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ type ServiceController interface {
 	StopService(name string) error
 	RestartService(name string) error
 	ToggleProxy(name string) (bool, error)
+	ReloadConfig() error
+	Notice() string
 	Services() []types.ServiceInfo
 	ServiceLogs(name string) []string
 	ProjectName() string
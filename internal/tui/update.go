@@ -13,10 +13,22 @@ const logPollInterval = 200 * time.Millisecond
 type eventMsg types.Event
 type logTickMsg struct{}
 
+// actionDoneMsg reports that a background action finished.
+type actionDoneMsg struct{}
+
 func (m Model) waitForEvent() tea.Msg {
 	return eventMsg(<-m.events)
 }
 
+// background runs an action that may stop and start services off the UI
+// goroutine, so the UI stays responsive.
+func background(action func()) tea.Cmd {
+	return func() tea.Msg {
+		action()
+		return actionDoneMsg{}
+	}
+}
+
 func logTick() tea.Cmd {
 	return tea.Tick(logPollInterval, func(time.Time) tea.Msg {
 		return logTickMsg{}
@@ -41,6 +53,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.refreshServices()
 		return m, m.waitForEvent
 
+	case actionDoneMsg:
+		m.refreshServices()
+		return m, nil
+
 	case logTickMsg:
 		if m.showLogs {
 			return m, logTick()
@@ -96,10 +112,13 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "p":
 		if svc := m.selectedService(); svc != nil && svc.Domain != "" {
-			_, _ = m.controller.ToggleProxy(svc.Name)
-			m.refreshServices()
+			name := svc.Name
+			return m, background(func() { _, _ = m.controller.ToggleProxy(name) })
 		}
 
+	case "R":
+		return m, background(func() { _ = m.controller.ReloadConfig() })
+
 	case "l":
 		m.showLogs = !m.showLogs
 		if m.showLogs {
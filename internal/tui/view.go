@@ -28,6 +28,11 @@ func (m Model) View() string {
 		b.WriteString(m.renderLogs())
 	}
 
+	if notice := m.controller.Notice(); notice != "" {
+		b.WriteString("\n")
+		b.WriteString(m.renderNotice(notice))
+	}
+
 	b.WriteString("\n")
 	b.WriteString(m.renderStatusBar())
 
@@ -87,8 +92,7 @@ func (m Model) renderServiceRow(svc types.ServiceInfo, selected bool) string {
 	if svc.Domain == "" {
 		domain = styleDomain.Render(fmt.Sprintf("%-36s", "-"))
 	} else if svc.ProxyEnabled {
-		url := fmt.Sprintf("https://%s", svc.Domain)
-		domain = "  " + styleLink.Render(url)
+		domain = "  " + styleLink.Render(svc.URL)
 	} else {
 		url := fmt.Sprintf("https://%s", svc.Domain)
 		domain = styleFailed.Render("↗") + " " + styleDomain.Render(url)
@@ -155,6 +159,13 @@ func (m Model) renderLogs() string {
 	return b.String()
 }
 
+func (m Model) renderNotice(notice string) string {
+	if strings.HasPrefix(notice, "✗") {
+		return styleFailed.Render(notice)
+	}
+	return styleRunning.Render(notice)
+}
+
 func (m Model) renderStatusBar() string {
 	keys := []string{
 		styleKeyHint.Render("j/k") + " navigate",
@@ -163,6 +174,7 @@ func (m Model) renderStatusBar() string {
 		styleKeyHint.Render("r") + " restart",
 		styleKeyHint.Render("p") + " toggle",
 		styleKeyHint.Render("l") + " logs",
+		styleKeyHint.Render("R") + " reload",
 		styleKeyHint.Render("?") + " help",
 		styleKeyHint.Render("q") + " quit",
 	}
@@ -184,6 +196,7 @@ func (m Model) renderHelp() string {
 		{"r", "Restart selected service"},
 		{"p", "Toggle proxy (local/remote)"},
 		{"l", "Toggle log view"},
+		{"R", "Reload lokl.yaml"},
 		{"?", "Show/hide this help"},
 		{"q", "Quit lokl"},
 	}
@@ -4,6 +4,7 @@ package types
 type ServiceInfo struct {
 	Name         string
 	Domain       string
+	URL          string // where the proxy serves Domain
 	Port         int
 	Running      bool
 	Healthy      bool
@@ -0,0 +1,158 @@
+// Package config is the public Go API for lokl configuration. Tools can use
+// it to build, load, validate and write lokl configs without running the
+// lokl binary.
+//
+// The types mirror lokl.yaml field for field. lokl.Up runs a config built
+// here through the steps Load applies after reading a file, such as env
+// files and ${services.<name>.port} references, so it behaves like the same
+// file. Use Marshal or Write to encode them.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/shahin-bayat/lokl/internal/config"
+	"github.com/shahin-bayat/lokl/internal/configapi"
+)
+
+// Config is a lokl configuration, as in lokl.yaml.
+type Config = configapi.Config
+
+// ProxyConfig configures the HTTPS proxy (proxy in lokl.yaml).
+type ProxyConfig = configapi.ProxyConfig
+
+// DiscoveryConfig controls the service discovery env vars.
+type DiscoveryConfig = configapi.DiscoveryConfig
+
+// Service is one entry of services in lokl.yaml.
+type Service = configapi.Service
+
+// PortRange describes a port picked at start time.
+type PortRange = configapi.PortRange
+
+// RouteConfig mounts a service under a path of a host.
+type RouteConfig = configapi.RouteConfig
+
+// RewriteConfig changes request paths before they reach the service.
+type RewriteConfig = configapi.RewriteConfig
+
+// RewriteRule rewrites, redirects or falls back requests whose path
+// matches a regular expression.
+type RewriteRule = configapi.RewriteRule
+
+type HealthConfig = configapi.HealthConfig
+
+type LimitsConfig = configapi.LimitsConfig
+
+// Shell is the argv prefix used to run a service command.
+type Shell = configapi.Shell
+
+// StringList is a list written as a single string or a list in lokl.yaml.
+type StringList = configapi.StringList
+
+// Severity classifies a validation issue.
+type Severity = configapi.Severity
+
+// Issue is a single validation finding.
+type Issue = configapi.Issue
+
+// Issues is a list of validation findings.
+type Issues = configapi.Issues
+
+const (
+	// CurrentVersion is the config version written by this lokl release.
+	CurrentVersion = config.CurrentVersion
+
+	FormatYAML = config.FormatYAML
+	FormatJSON = config.FormatJSON
+
+	// Values of ProxyConfig.CA.
+	CALokl   = config.CALokl
+	CAMkcert = config.CAMkcert
+
+	// Values of ProxyConfig.DNS.
+	DNSServer = config.DNSServer
+	DNSHosts  = config.DNSHosts
+
+	SeverityError   = configapi.SeverityError
+	SeverityWarning = configapi.SeverityWarning
+)
+
+// ErrNotFound is returned by Find when no config file is found.
+var ErrNotFound = config.ErrNotFound
+
+// Load reads, composes and validates a lokl.yaml, lokl.json or lokl.toml.
+// Relative service paths are made absolute, relative to the config file.
+func Load(path string) (*Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return configapi.FromInternal(cfg), nil
+}
+
+// LoadAll is like Load but returns validation errors and warnings instead
+// of failing on them.
+func LoadAll(path string) (*Config, Issues, error) {
+	cfg, issues, err := config.LoadAll(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return configapi.FromInternal(cfg), configapi.IssuesFromInternal(issues), nil
+}
+
+// Find returns the nearest config file in dir or one of its parents.
+func Find(dir string) (string, error) {
+	return config.Find(dir)
+}
+
+// ApplyDefaults fills in default values, as Load does.
+func ApplyDefaults(cfg *Config) {
+	c := configapi.ToInternal(cfg)
+	config.ApplyDefaults(c)
+	*cfg = *configapi.FromInternal(c)
+}
+
+// Validate checks a config built in code and returns every error and
+// warning. Use Issues.Err to get a single error.
+func Validate(cfg *Config) Issues {
+	return configapi.IssuesFromInternal(config.ValidateAll(configapi.ToInternal(cfg)))
+}
+
+// SortByDependency returns service names in start order.
+func SortByDependency(services map[string]Service) ([]string, error) {
+	return config.SortByDependency(configapi.ServicesToInternal(services))
+}
+
+// SelectServices returns the services lokl up would start for the given
+// service names and profiles, dependencies included, in start order.
+func SelectServices(services map[string]Service, names, profiles []string) ([]string, error) {
+	return config.SelectServices(configapi.ServicesToInternal(services), names, profiles)
+}
+
+// Marshal encodes cfg in the given format (FormatYAML or FormatJSON).
+func Marshal(cfg *Config, format string) ([]byte, error) {
+	return config.Marshal(configapi.ToInternal(cfg), format)
+}
+
+// Write validates cfg and writes it to path, choosing the format from the
+// extension. Configs with validation errors are not written.
+func Write(cfg *Config, path string) error {
+	if filepath.Ext(path) == ".toml" {
+		return fmt.Errorf("writing TOML is not supported; use .yaml or .json")
+	}
+	if err := Validate(cfg).Err(); err != nil {
+		return fmt.Errorf("validating config: %w", err)
+	}
+
+	data, err := Marshal(cfg, config.FormatFor(path))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shahin-bayat/lokl/pkg/config"
+)
+
+func newConfig() *config.Config {
+	return &config.Config{
+		Name:    "generated",
+		Version: "2",
+		Proxy:   config.ProxyConfig{Domain: "gen.dev"},
+		Services: map[string]config.Service{
+			"web": {Command: "pnpm dev", Port: 5173, Subdomain: "app", DependsOn: []string{"api"}},
+			"api": {Command: "go run .", PortRange: &config.PortRange{}},
+		},
+	}
+}
+
+func TestValidateAndSort(t *testing.T) {
+	cfg := newConfig()
+	if err := config.Validate(cfg).Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order, err := config.SortByDependency(cfg.Services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"api", "web"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+
+	cfg.Services["web"] = config.Service{Command: "x", DependsOn: []string{"missing"}}
+	if err := config.Validate(cfg).Err(); err == nil || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("err = %v, want unknown service error", err)
+	}
+}
+
+func TestWriteAndLoad(t *testing.T) {
+	for _, name := range []string{"lokl.yaml", "lokl.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := config.Write(newConfig(), path); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			cfg, err := config.Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Services["api"].PortRange == nil {
+				t.Error("api port range lost in round trip")
+			}
+			if cfg.Services["web"].Port != 5173 {
+				t.Errorf("web port = %d, want 5173", cfg.Services["web"].Port)
+			}
+			if cfg.Dir != filepath.Dir(path) {
+				t.Errorf("Dir = %q, want %q", cfg.Dir, filepath.Dir(path))
+			}
+			if len(cfg.Files) == 0 || cfg.Files[0] != path {
+				t.Errorf("Files = %v, want %s first", cfg.Files, path)
+			}
+		})
+	}
+}
+
+func TestWriteRejectsInvalid(t *testing.T) {
+	cfg := newConfig()
+	cfg.Name = ""
+	if err := config.Write(cfg, filepath.Join(t.TempDir(), "lokl.yaml")); err == nil {
+		t.Error("expected error for invalid config")
+	}
+}
+
+func TestLoadAllIssues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lokl.yaml")
+	data := "name: x\nservices:\n  api:\n    command: run\n    restart: sometimes\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, issues, err := config.LoadAll(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Services["api"].Command != "run" {
+		t.Errorf("api command = %q, want %q", cfg.Services["api"].Command, "run")
+	}
+
+	errs := issues.Errors()
+	if len(errs) != 1 || errs[0].Line != 5 || errs[0].Severity != config.SeverityError {
+		t.Errorf("errors = %v, want one error on line 5", errs)
+	}
+}
@@ -0,0 +1,299 @@
+// Package lokl runs a lokl environment from Go code, for example to boot a
+// stack from integration tests. It uses the same supervisor, processes and
+// proxy as the lokl command.
+package lokl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	internalconfig "github.com/shahin-bayat/lokl/internal/config"
+	"github.com/shahin-bayat/lokl/internal/configapi"
+	"github.com/shahin-bayat/lokl/internal/logger"
+	"github.com/shahin-bayat/lokl/internal/process"
+	"github.com/shahin-bayat/lokl/internal/proxy"
+	"github.com/shahin-bayat/lokl/internal/supervisor"
+	"github.com/shahin-bayat/lokl/pkg/config"
+)
+
+const (
+	pollInterval = 100 * time.Millisecond
+	// logTailLines is how much output is included in errors about a service
+	// that exited.
+	logTailLines = 20
+)
+
+// Options controls what Up starts.
+type Options struct {
+	// Services and Profiles select what to start, as with lokl up. Both
+	// empty starts every autostart service.
+	Services []string
+	Profiles []string
+
+	// Proxy runs the HTTPS proxy for services with a subdomain. It needs
+	// certificates and DNS entries, like lokl up. When false, subdomains,
+	// hosts and routes are ignored and services are reached directly on
+	// localhost.
+	Proxy bool
+
+	// Log receives lokl's own progress output. Nil discards it.
+	Log io.Writer
+
+	// Dir is the project directory, as the directory of lokl.yaml is for
+	// lokl up: certificates are kept in its .lokl directory and the shared
+	// proxy tells projects apart by it. It defaults to the config's Dir,
+	// which config.Load sets, and then to the working directory.
+	Dir string
+}
+
+// Env is a running lokl environment.
+type Env struct {
+	cfg      *internalconfig.Config
+	sup      *supervisor.Supervisor
+	services []string
+	started  time.Time
+
+	mu sync.Mutex
+	// healthyAfter records when WaitHealthy first saw each service healthy,
+	// relative to Up.
+	healthyAfter map[string]time.Duration
+}
+
+// ServiceStatus describes a started service.
+type ServiceStatus struct {
+	Name    string
+	Running bool
+	Healthy bool
+	// HealthyAfter is the time from Up until WaitHealthy first saw the
+	// service healthy, or zero if it has not.
+	HealthyAfter time.Duration
+}
+
+// Up validates cfg and starts the selected services. A config built in code
+// first goes through the steps config.Load applies after reading a file:
+// env files, defaults, paths relative to Options.Dir, and ${...} in env and
+// commands. If ctx is done before startup finishes, whatever was started is
+// stopped and ctx's error is returned.
+func Up(ctx context.Context, cfg *config.Config, opts Options) (*Env, error) {
+	c, issues, err := prepare(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, internalconfig.ValidateAll(c)...)
+	if err := issues.Err(); err != nil {
+		return nil, fmt.Errorf("validating config: %w", err)
+	}
+
+	services, err := internalconfig.SelectServices(c.Services, opts.Services, opts.Profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	w := opts.Log
+	if w == nil {
+		w = io.Discard
+	}
+	processFactory := func(name string, svc internalconfig.Service, discovery map[string]string, onChange func()) supervisor.ProcessRunner {
+		return process.New(name, svc, discovery, onChange)
+	}
+	sup := supervisor.New(c, processFactory, proxy.New(c), logger.New(w))
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- sup.Start(opts.Services, opts.Profiles)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		// Starting does not wait for health, so wait for it to finish and
+		// stop what it started before returning.
+		if <-done == nil {
+			_ = sup.Stop()
+		}
+		return nil, ctx.Err()
+	}
+
+	return &Env{
+		cfg:          c,
+		sup:          sup,
+		services:     services,
+		started:      started,
+		healthyAfter: make(map[string]time.Duration),
+	}, nil
+}
+
+// prepare converts cfg to lokl's internal config and, for a config built in
+// code, resolves it as Load would have. Without the proxy it drops domains,
+// hosts and routes so every service is addressed on localhost.
+func prepare(cfg *config.Config, opts Options) (*internalconfig.Config, internalconfig.Issues, error) {
+	c := configapi.ToInternal(cfg)
+	if !opts.Proxy {
+		c.Proxy.Domain = ""
+		for name, svc := range c.Services {
+			svc.Subdomain = ""
+			svc.Hosts = nil
+			svc.Routes = nil
+			c.Services[name] = svc
+		}
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = c.Dir
+	}
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolving project directory: %w", err)
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving project directory: %w", err)
+	}
+	c.Dir = dir
+
+	// A loaded config lists its files and has been resolved by Load.
+	if len(c.Files) > 0 {
+		internalconfig.ApplyDefaults(c)
+		return c, nil, nil
+	}
+	return c, internalconfig.Resolve(c), nil
+}
+
+// Services returns the names of the started services in start order.
+func (e *Env) Services() []string {
+	return e.services
+}
+
+// WaitHealthy blocks until every started service is running and passes its
+// health check. It fails early if a service exits.
+func (e *Env) WaitHealthy(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending, err := e.pending()
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s to become healthy: %w", strings.Join(pending, ", "), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending returns the started services that are not healthy yet.
+func (e *Env) pending() ([]string, error) {
+	started := make(map[string]bool, len(e.services))
+	for _, name := range e.services {
+		started[name] = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var pending []string
+	for _, info := range e.sup.Services() {
+		if !started[info.Name] {
+			continue
+		}
+		if !info.Running {
+			return nil, fmt.Errorf("service %s is not running%s", info.Name, e.logTail(info.Name))
+		}
+		if !info.Healthy {
+			pending = append(pending, info.Name)
+			continue
+		}
+		if _, ok := e.healthyAfter[info.Name]; !ok {
+			e.healthyAfter[info.Name] = time.Since(e.started)
+		}
+	}
+	return pending, nil
+}
+
+// Status reports the state of every started service, in start order.
+func (e *Env) Status() []ServiceStatus {
+	infos := make(map[string]ServiceStatus)
+	for _, info := range e.sup.Services() {
+		infos[info.Name] = ServiceStatus{Name: info.Name, Running: info.Running, Healthy: info.Healthy}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]ServiceStatus, 0, len(e.services))
+	for _, name := range e.services {
+		st := infos[name]
+		st.HealthyAfter = e.healthyAfter[name]
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// DiscoveryEnv returns the LOKL_<SERVICE>_* variables for the running
+// environment, for passing to processes started outside lokl.
+func (e *Env) DiscoveryEnv() (map[string]string, error) {
+	return e.sup.DiscoveryEnv()
+}
+
+func (e *Env) logTail(name string) string {
+	lines := e.Logs(name)
+	if len(lines) == 0 {
+		return ""
+	}
+	lines = lines[max(0, len(lines)-logTailLines):]
+	return "; last output:\n  " + strings.Join(lines, "\n  ")
+}
+
+// ServiceURL returns the URL other code should use to reach a service: its
+// proxy domain when the proxy runs, otherwise localhost and its (possibly
+// allocated) port.
+func (e *Env) ServiceURL(name string) (string, error) {
+	for _, info := range e.sup.Services() {
+		if info.Name != name {
+			continue
+		}
+		switch {
+		case info.Domain != "" && info.ProxyEnabled:
+			return info.URL, nil
+		case info.Port != 0:
+			return fmt.Sprintf("http://localhost:%d", info.Port), nil
+		default:
+			return "", fmt.Errorf("service %s has no port or domain", name)
+		}
+	}
+	return "", fmt.Errorf("unknown service: %s", name)
+}
+
+// Logs returns the captured output of a service.
+func (e *Env) Logs(name string) []string {
+	return e.sup.ServiceLogs(name)
+}
+
+// Down stops every service and the proxy.
+func (e *Env) Down() error {
+	return e.sup.Stop()
+}
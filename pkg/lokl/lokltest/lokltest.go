@@ -0,0 +1,80 @@
+// Package lokltest ties a lokl environment to a test: it is started before
+// the test body, stopped in cleanup, and its service logs are written to
+// the test log when the test fails.
+package lokltest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahin-bayat/lokl/pkg/config"
+	"github.com/shahin-bayat/lokl/pkg/lokl"
+)
+
+// Timeout bounds how long Up waits for services to become healthy.
+var Timeout = 2 * time.Minute
+
+// Up starts the environment described by cfg and waits until it is healthy.
+// The environment is stopped when the test finishes.
+func Up(t testing.TB, cfg *config.Config, opts lokl.Options) *lokl.Env {
+	t.Helper()
+
+	env, err := lokl.Up(t.Context(), cfg, opts)
+	if err != nil {
+		t.Fatalf("lokl up: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if t.Failed() {
+			dumpLogs(t, env)
+		}
+		if err := env.Down(); err != nil {
+			t.Errorf("lokl down: %v", err)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := env.WaitHealthy(ctx); err != nil {
+		t.Fatalf("lokl: %v", err)
+	}
+
+	return env
+}
+
+// UpFile loads a config file and starts it with Up.
+func UpFile(t testing.TB, path string, opts lokl.Options) *lokl.Env {
+	t.Helper()
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("loading %s: %v", path, err)
+	}
+	return Up(t, cfg, opts)
+}
+
+// URL returns the URL of a service, failing the test if it has none.
+func URL(t testing.TB, env *lokl.Env, name string) string {
+	t.Helper()
+
+	url, err := env.ServiceURL(name)
+	if err != nil {
+		t.Fatalf("lokl: %v", err)
+	}
+	return url
+}
+
+func dumpLogs(t testing.TB, env *lokl.Env) {
+	t.Helper()
+
+	for _, name := range env.Services() {
+		lines := env.Logs(name)
+		if len(lines) == 0 {
+			t.Logf("lokl: %s: no output", name)
+			continue
+		}
+		t.Logf("lokl: %s output:\n%s", name, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,130 @@
+package lokltest_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shahin-bayat/lokl/pkg/config"
+	"github.com/shahin-bayat/lokl/pkg/lokl"
+	"github.com/shahin-bayat/lokl/pkg/lokl/lokltest"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestUp(t *testing.T) {
+	port := freePort(t)
+	cfg := &config.Config{
+		Name: "lokltest",
+		Services: map[string]config.Service{
+			"api":    {Command: `sh -c "echo api ready; exec sleep 30"`, Port: port},
+			"worker": {Command: `sh -c "echo worker ready; exec sleep 30"`, DependsOn: []string{"api"}},
+			"extra":  {Command: "sleep 30", AutoStart: new(bool)},
+		},
+	}
+
+	env := lokltest.Up(t, cfg, lokl.Options{})
+
+	if got := env.Services(); strings.Join(got, ",") != "api,worker" {
+		t.Errorf("services = %v, want [api worker]", got)
+	}
+
+	url := lokltest.URL(t, env, "api")
+	if want := "http://localhost:" + strconv.Itoa(port); url != want {
+		t.Errorf("url = %q, want %q", url, want)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(strings.Join(env.Logs("worker"), "\n"), "worker ready") {
+		if time.Now().After(deadline) {
+			t.Fatalf("worker logs = %v", env.Logs("worker"))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestUpWithoutProxy(t *testing.T) {
+	port := freePort(t)
+	cfg := &config.Config{
+		Name:  "lokltest",
+		Proxy: config.ProxyConfig{Domain: "lokltest.dev"},
+		Services: map[string]config.Service{
+			"api": {
+				Command:   `sh -c "echo listening on ${self.port}; exec sleep 30"`,
+				Port:      port,
+				Subdomain: "api",
+				Hosts:     []string{"www.example.com", "*.tenants"},
+				Routes:    []config.RouteConfig{{Host: "app", PathPrefix: "/api"}},
+			},
+			"web": {
+				Command: `sh -c "echo api at $API_URL; exec sleep 30"`,
+				Routes:  []config.RouteConfig{{PathPrefix: "/"}},
+				Env:     map[string]string{"API_URL": "${services.api.url}"},
+			},
+		},
+	}
+
+	env := lokltest.Up(t, cfg, lokl.Options{})
+
+	apiURL := "http://localhost:" + strconv.Itoa(port)
+	if url := lokltest.URL(t, env, "api"); url != apiURL {
+		t.Errorf("url = %q, want %q", url, apiURL)
+	}
+
+	want := map[string]string{
+		"api": "listening on " + strconv.Itoa(port),
+		"web": "api at " + apiURL,
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for name, line := range want {
+		for !strings.Contains(strings.Join(env.Logs(name), "\n"), line) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s logs = %v, want %q", name, env.Logs(name), line)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func TestWaitHealthyFailsWhenServiceExits(t *testing.T) {
+	cfg := &config.Config{
+		Name: "lokltest",
+		Services: map[string]config.Service{
+			"crash": {Command: `sh -c "echo boom; exit 1"`},
+		},
+	}
+
+	env, err := lokl.Up(context.Background(), cfg, lokl.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Down() }()
+
+	// Give the process time to exit before the first check.
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = env.WaitHealthy(ctx)
+	if err == nil || !strings.Contains(err.Error(), "crash is not running") || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v, want not running error with output", err)
+	}
+}
+
+func TestUpRejectsInvalidConfig(t *testing.T) {
+	_, err := lokl.Up(context.Background(), &config.Config{Name: "x"}, lokl.Options{})
+	if err == nil {
+		t.Error("expected error for config without services")
+	}
+}
@@ -28,6 +28,10 @@ export default defineConfig({
 						{ label: 'Proxy & HTTPS', slug: 'config/proxy' },
 					],
 				},
+				{
+					label: 'Go API',
+					items: [{ label: 'Embedding lokl', slug: 'go-api' }],
+				},
 				{
 					label: 'CLI Reference',
 					autogenerate: { directory: 'cli' },